@@ -0,0 +1,90 @@
+package main
+
+import (
+	"GraphUserAdmin/internal/users"
+
+	"github.com/spf13/cobra"
+)
+
+// setupUsersAccountCommands creates the commands that allow or block sign-in
+func setupUsersAccountCommands(usersCmd *cobra.Command) {
+	disableCmd := &cobra.Command{
+		Use:   "disable [UPN]",
+		Short: "Block sign-in for users",
+		Long: `Block sign-in for a user, or for every user given with --users or --file.
+
+Disabling an account stops new sign-ins, but sessions that are already open stay valid until their
+tokens expire. Add --revoke-sessions to sign the users out everywhere as well.`,
+		Example: `  gua users disable jdoe@example.com --revoke-sessions
+  gua users disable --file leavers.txt`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			upns, err := userTargets(cmd, args)
+			if err != nil {
+				return err
+			}
+			revoke, _ := cmd.Flags().GetBool("revoke-sessions")
+
+			errs := users.SetAccountsEnabled(client, upns, false)
+			if revoke {
+				// Only the disabled accounts are signed out, so a failure leaves nothing half done
+				var disabled []string
+				var indexes []int
+				for i, err := range errs {
+					if err == nil {
+						disabled = append(disabled, upns[i])
+						indexes = append(indexes, i)
+					}
+				}
+				for i, err := range users.RevokeSignInSessions(client, disabled) {
+					errs[indexes[i]] = err
+				}
+			}
+			return reportBulk("Disable", upns, errs)
+		},
+	}
+	addUserListFlags(disableCmd)
+	disableCmd.Flags().Bool("revoke-sessions", false, "Also revoke the users' sign-in sessions")
+
+	enableCmd := &cobra.Command{
+		Use:   "enable [UPN]",
+		Short: "Allow sign-in for users",
+		Long:  "Allow sign-in again for a user, or for every user given with --users or --file.",
+		Example: `  gua users enable jdoe@example.com
+  gua users enable --users jdoe@example.com,jsmith@example.com`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			upns, err := userTargets(cmd, args)
+			if err != nil {
+				return err
+			}
+
+			errs := users.SetAccountsEnabled(client, upns, true)
+			return reportBulk("Enable", upns, errs)
+		},
+	}
+	addUserListFlags(enableCmd)
+
+	revokeSessionsCmd := &cobra.Command{
+		Use:   "revoke-sessions [UPN]",
+		Short: "Sign users out of all sessions",
+		Long: `Revoke the refresh tokens and session cookies of a user, or of every user given with --users or
+--file, so they must sign in again everywhere. Access tokens already issued stay valid until they
+expire, usually within an hour.`,
+		Example: `  gua users revoke-sessions jdoe@example.com
+  gua users revoke-sessions --file compromised.txt`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			upns, err := userTargets(cmd, args)
+			if err != nil {
+				return err
+			}
+
+			errs := users.RevokeSignInSessions(client, upns)
+			return reportBulk("Session revocation", upns, errs)
+		},
+	}
+	addUserListFlags(revokeSessionsCmd)
+
+	usersCmd.AddCommand(disableCmd, enableCmd, revokeSessionsCmd)
+}
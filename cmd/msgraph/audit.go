@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"GraphUserAdmin/internal/audit"
+	"GraphUserAdmin/internal/config"
+	"GraphUserAdmin/internal/graph"
+	"GraphUserAdmin/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+var auditColumns = []output.Column{
+	{Header: "Time", Compute: func(record map[string]interface{}) interface{} {
+		t, err := time.Parse(time.RFC3339Nano, output.FormatValue(record["time"]))
+		if err != nil {
+			return record["time"]
+		}
+		return t.Local().Format("2006-01-02 15:04:05")
+	}},
+	{Header: "User", Field: "user"},
+	{Header: "Profile", Field: "profile"},
+	{Header: "Command", Field: "command"},
+	{Header: "Method", Field: "method"},
+	{Header: "Target", Field: "target"},
+	{Header: "Status", Field: "status"},
+	{Header: "Request ID", Field: "requestId"},
+}
+
+// setupAuditCommands creates the audit command and its subcommands
+func setupAuditCommands(rootCmd *cobra.Command) {
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Review the local log of changes made with gua",
+	}
+
+	var since, until, target, command string
+	auditShowCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show audit log entries",
+		Long: `Show the changes recorded in the audit log, oldest first.
+
+Every request that changes data is recorded with the time, operating system user, profile, tenant,
+command, target object, request body (passwords and secrets redacted), result status and Graph
+request ID. The log is written to the profile's auditLog path (default: gua/audit.jsonl in your
+user config directory).
+
+--since and --until take a date (2024-05-01), a date and time (2024-05-01T09:00:00Z) or an age
+such as 24h or 7d.`,
+		Example: `  gua audit show --since 7d
+  gua audit show --target jdoe@example.com
+  gua audit show --command "users delete" -o json`,
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{skipAuthAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log, err := auditLog()
+			if err != nil {
+				return err
+			}
+			if log == nil {
+				return fmt.Errorf("the audit log is turned off for profile %s", cfg.Name)
+			}
+
+			filter := audit.Filter{Target: target, Command: command}
+			if filter.Since, err = parseAuditTime(since); err != nil {
+				return fmt.Errorf("invalid --since: %w", err)
+			}
+			if filter.Until, err = parseAuditTime(until); err != nil {
+				return fmt.Errorf("invalid --until: %w", err)
+			}
+
+			entries, err := log.Read(filter)
+			if err != nil {
+				return err
+			}
+
+			if len(entries) == 0 && printer.Format == output.Table {
+				fmt.Println("No matching audit entries.")
+				return nil
+			}
+
+			return printer.List(entries, auditColumns)
+		},
+	}
+	auditShowCmd.Flags().StringVar(&since, "since", "", "Show entries at or after this date, time or age (e.g. 2024-05-01 or 7d)")
+	auditShowCmd.Flags().StringVar(&until, "until", "", "Show entries before this date, time or age")
+	auditShowCmd.Flags().StringVar(&target, "target", "", "Show entries whose target contains this text (e.g. a UPN or group ID)")
+	auditShowCmd.Flags().StringVar(&command, "command", "", "Show entries whose command contains this text (e.g. \"users delete\")")
+
+	auditCmd.AddCommand(auditShowCmd)
+	rootCmd.AddCommand(auditCmd)
+}
+
+// auditLog returns the profile's audit log, or nil when auditing is turned off
+func auditLog() (*audit.Log, error) {
+	path := cfg.AuditLog
+	if strings.EqualFold(path, config.AuditLogOff) {
+		return nil, nil
+	}
+	if path == "" {
+		var err error
+		if path, err = audit.DefaultPath(); err != nil {
+			return nil, err
+		}
+	}
+	return &audit.Log{Path: path}, nil
+}
+
+// auditRecorder returns a Graph client observer that records every change made by the command.
+// A failure to write the log is reported but does not fail the command, whose change has already been made.
+func auditRecorder(cmd *cobra.Command, log *audit.Log) func(graph.Exchange) {
+	user := audit.CurrentUser()
+	return func(exchange graph.Exchange) {
+		entry := &audit.Entry{
+			Time:            time.Now().UTC(),
+			User:            user,
+			Profile:         cfg.Name,
+			TenantID:        cfg.TenantID,
+			Command:         cmd.CommandPath(),
+			Method:          exchange.Method,
+			URL:             exchange.URL,
+			Target:          audit.Target(client.BaseURL, exchange.URL, exchange.Body),
+			Body:            audit.Redact(exchange.Body),
+			Status:          exchange.StatusCode,
+			RequestID:       exchange.RequestID,
+			ClientRequestID: exchange.ClientRequestID,
+		}
+		if exchange.Err != nil {
+			entry.Error = exchange.Err.Error()
+		}
+
+		if err := log.Append(entry); err != nil {
+			statusf("⚠ Warning: %v\n", err)
+		}
+	}
+}
+
+// parseAuditTime accepts a date, an RFC 3339 time, or an age such as 36h or 7d before now
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+	if age, err := time.ParseDuration(value); err == nil && age >= 0 {
+		return time.Now().Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date (2006-01-02), time (RFC 3339) or age (e.g. 24h or 7d)", value)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"GraphUserAdmin/internal/auth"
+	"GraphUserAdmin/internal/config"
+	"GraphUserAdmin/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+// setupAuthCommands creates the login command and the auth command with its subcommands
+func setupAuthCommands(rootCmd *cobra.Command) {
+	loginCmd := &cobra.Command{
+		Use:   "login",
+		Short: "Sign in as an administrator using the device code flow",
+		Long: `Sign in interactively so that changes are made (and audited) as you rather than as the application.
+
+Open the URL shown in a browser on any device and enter the code. The sign-in is saved and renewed
+automatically with its refresh token. Set "credentialType": "delegated" in the config file to use it.
+
+The app registration must allow public client flows and have the delegated permissions
+User.ReadWrite.All, Group.ReadWrite.All and Directory.ReadWrite.All.`,
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{skipAuthAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deviceCode, err := auth.RequestDeviceCode(cfg.TenantID, cfg.ClientID, auth.DelegatedScopes())
+			if err != nil {
+				return fmt.Errorf("failed to start sign-in: %w", err)
+			}
+
+			// The message goes to stderr so it is visible even when stdout is redirected
+			fmt.Fprintln(os.Stderr, deviceCode.Message)
+
+			token, err := auth.PollDeviceCode(cfg.TenantID, cfg.ClientID, deviceCode)
+			if err != nil {
+				return fmt.Errorf("sign-in failed: %w", err)
+			}
+
+			cache, err := tokenCache()
+			if err != nil {
+				return err
+			}
+			entry := &auth.CacheEntry{TenantID: cfg.TenantID, ClientID: cfg.ClientID, Scope: auth.DelegatedScope(), Token: *token}
+			if err := cache.Put(entry); err != nil {
+				return err
+			}
+
+			statusf("✓ Signed in as %s\n", token.Account)
+			if cfg.Credential() != config.CredentialDelegated {
+				statusf("Note: set \"credentialType\": \"delegated\" in the config file to run commands with this sign-in.\n")
+			}
+			return nil
+		},
+	}
+
+	authCmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Inspect and clear cached credentials",
+	}
+
+	authStatusCmd := &cobra.Command{
+		Use:         "status",
+		Short:       "Show cached tokens and when they expire",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{skipAuthAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cache, err := tokenCache()
+			if err != nil {
+				return err
+			}
+
+			entries, err := cache.Entries()
+			if err != nil {
+				return err
+			}
+
+			statusf("Credential type: %s\n", cfg.Credential())
+			statusf("Token cache:     %s\n\n", cache.Path)
+
+			if len(entries) == 0 && printer.Format == output.Table {
+				fmt.Println("No cached tokens.")
+				return nil
+			}
+
+			// Tokens themselves are never printed
+			views := make([]cachedTokenView, len(entries))
+			for i, entry := range entries {
+				kind := "application"
+				if entry.Delegated() {
+					kind = "delegated"
+				}
+
+				views[i] = cachedTokenView{
+					TenantID:  entry.TenantID,
+					ClientID:  entry.ClientID,
+					Type:      kind,
+					Account:   entry.Account,
+					ExpiresAt: entry.ExpiresAt,
+					Expires:   describeExpiry(entry),
+					Current:   strings.EqualFold(entry.TenantID, cfg.TenantID) && strings.EqualFold(entry.ClientID, cfg.ClientID),
+				}
+			}
+
+			return printer.List(views, []output.Column{
+				{Header: "Tenant ID", Field: "tenantId"},
+				{Header: "Client ID", Field: "clientId"},
+				{Header: "Type", Field: "type"},
+				{Header: "Account", Field: "account"},
+				{Header: "Expires", Field: "expires"},
+				{Header: "Current", Compute: func(record map[string]interface{}) interface{} {
+					if record["current"] == true {
+						return "*"
+					}
+					return ""
+				}},
+			})
+		},
+	}
+
+	var logoutAll bool
+	authLogoutCmd := &cobra.Command{
+		Use:         "logout",
+		Short:       "Remove cached tokens for the configured tenant and client",
+		Long:        "Remove cached tokens (including a delegated sign-in) for the tenant and client in the config file. Use --all to clear the whole cache.",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{skipAuthAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cache, err := tokenCache()
+			if err != nil {
+				return err
+			}
+
+			if logoutAll {
+				if err := cache.Clear(); err != nil {
+					return err
+				}
+				statusf("✓ Cleared all cached tokens\n")
+				return nil
+			}
+
+			removed, err := cache.Remove(cfg.TenantID, cfg.ClientID)
+			if err != nil {
+				return err
+			}
+			statusf("✓ Removed %d cached token(s) for tenant %s\n", removed, cfg.TenantID)
+			return nil
+		},
+	}
+	authLogoutCmd.Flags().BoolVar(&logoutAll, "all", false, "Clear cached tokens for every tenant and client")
+
+	authCmd.AddCommand(authStatusCmd, authLogoutCmd)
+	rootCmd.AddCommand(loginCmd, authCmd)
+}
+
+// cachedTokenView is what 'auth status' shows for a cache entry
+type cachedTokenView struct {
+	TenantID  string    `json:"tenantId"`
+	ClientID  string    `json:"clientId"`
+	Type      string    `json:"type"`
+	Account   string    `json:"account,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Expires   string    `json:"expires"`
+	Current   bool      `json:"current"`
+}
+
+// tokenCache returns the on-disk token cache
+func tokenCache() (*auth.Cache, error) {
+	path, err := auth.DefaultCachePath()
+	if err != nil {
+		return nil, err
+	}
+	return &auth.Cache{Path: path}, nil
+}
+
+// describeExpiry summarises when a cached token expires
+func describeExpiry(entry *auth.CacheEntry) string {
+	remaining := time.Until(entry.ExpiresAt).Round(time.Minute)
+	switch {
+	case remaining > 0:
+		return fmt.Sprintf("in %s", remaining)
+	case entry.RefreshToken != "":
+		return "expired (will refresh)"
+	}
+	return "expired"
+}
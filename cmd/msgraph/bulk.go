@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"GraphUserAdmin/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+// bulkResult is the outcome of a bulk operation for one target
+type bulkResult struct {
+	Target string `json:"target"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+var bulkResultColumns = []output.Column{
+	{Header: "Target", Field: "target"},
+	{Header: "Status", Field: "status"},
+	{Header: "Error", Field: "error"},
+}
+
+// addUserListFlags adds --users and --file to a bulk command
+func addUserListFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("users", nil, "User principal names (comma-separated)")
+	cmd.Flags().String("file", "", "File with one user principal name per line ('-' for stdin)")
+}
+
+// readUserList returns the UPNs from --users and --file. Blank lines and lines starting with # are skipped.
+func readUserList(cmd *cobra.Command) ([]string, error) {
+	upns, _ := cmd.Flags().GetStringSlice("users")
+	path, _ := cmd.Flags().GetString("file")
+
+	if path != "" {
+		file := os.Stdin
+		if path != "-" {
+			var err error
+			if file, err = os.Open(path); err != nil {
+				return nil, fmt.Errorf("failed to open user list: %w", err)
+			}
+			defer file.Close()
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				upns = append(upns, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read user list: %w", err)
+		}
+	}
+
+	if len(upns) == 0 {
+		return nil, fmt.Errorf("no users given: use --users or --file")
+	}
+	return upns, nil
+}
+
+// userTargets returns the UPN argument, or the UPNs from --users and --file when none is given
+func userTargets(cmd *cobra.Command, args []string) ([]string, error) {
+	if len(args) == 0 {
+		return readUserList(cmd)
+	}
+	if cmd.Flags().Changed("users") || cmd.Flags().Changed("file") {
+		return nil, fmt.Errorf("give either a UPN argument or --users/--file, not both")
+	}
+	return args, nil
+}
+
+// reportBulk prints one result per target and a summary, and fails when any target failed.
+// Dry runs change nothing, so only the targets that would fail are reported.
+func reportBulk(action string, targets []string, errs []error) error {
+	results := make([]bulkResult, len(targets))
+	failed := 0
+	for i, target := range targets {
+		results[i] = bulkResult{Target: target, Status: "ok"}
+		if errs[i] != nil {
+			results[i].Status = "failed"
+			results[i].Error = errs[i].Error()
+			failed++
+		}
+	}
+
+	if dryRun {
+		for _, result := range results {
+			if result.Status == "failed" {
+				statusf("✗ %s: %s\n", result.Target, result.Error)
+			}
+		}
+	} else {
+		if err := printer.List(results, bulkResultColumns); err != nil {
+			return err
+		}
+		statusf("\n✓ %s: %d succeeded, %d failed\n", action, len(targets)-failed, failed)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d failed", failed, len(targets))
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"GraphUserAdmin/internal/cloud"
+	"GraphUserAdmin/internal/config"
+	"GraphUserAdmin/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+// setupConfigCommands creates the config command and its profile subcommands
+func setupConfigCommands(rootCmd *cobra.Command) {
+	// None of these commands need a valid profile or a token
+	noConfig := map[string]string{skipConfigAnnotation: "true", skipAuthAnnotation: "true"}
+
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage configuration profiles",
+	}
+
+	profilesCmd := &cobra.Command{
+		Use:   "profiles",
+		Short: "Manage named tenant profiles",
+		Long: `Manage named profiles in the config file. Each profile holds the tenant, client, credential,
+default output format and cloud for one tenant. Select a profile per command with --profile
+(or GUA_PROFILE), or set the default with 'gua config profiles use'.`,
+	}
+
+	profilesListCmd := &cobra.Command{
+		Use:         "list",
+		Short:       "List profiles",
+		Args:        cobra.NoArgs,
+		Annotations: noConfig,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, err := config.ReadFile(configPath)
+			if err != nil {
+				return err
+			}
+
+			if len(file.Profiles) == 0 && printer.Format == output.Table {
+				fmt.Printf("No profiles in %s. Add one with 'gua config profiles add'.\n", configPath)
+				return nil
+			}
+
+			views := make([]profileView, 0, len(file.Profiles))
+			for _, name := range file.Names() {
+				profile := *file.Profiles[name]
+				profile.Name = name
+				views = append(views, newProfileView(&profile, file.DefaultProfile))
+			}
+
+			return printer.List(views, []output.Column{
+				{Header: "Default", Compute: func(record map[string]interface{}) interface{} {
+					if record["default"] == true {
+						return "*"
+					}
+					return ""
+				}},
+				{Header: "Name", Field: "name"},
+				{Header: "Tenant ID", Field: "tenantId"},
+				{Header: "Client ID", Field: "clientId"},
+				{Header: "Credential", Field: "credential"},
+				{Header: "Output", Field: "output"},
+				{Header: "Cloud", Field: "cloud"},
+			})
+		},
+	}
+
+	profilesShowCmd := &cobra.Command{
+		Use:         "show [NAME]",
+		Short:       "Show the settings of a profile (secrets are masked)",
+		Long:        "Show the settings of a profile. Without NAME, shows the profile that would be used.",
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: noConfig,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, err := config.ReadFile(configPath)
+			if err != nil {
+				return err
+			}
+
+			name := profileName
+			if len(args) == 1 {
+				name = args[0]
+			}
+			if name == "" {
+				name = os.Getenv("GUA_PROFILE")
+			}
+
+			profile, err := file.Select(name)
+			if err != nil {
+				return err
+			}
+
+			return printer.Object(newProfileView(profile, file.DefaultProfile), []output.Column{
+				{Header: "Profile", Field: "name"},
+				{Header: "Default", Field: "default"},
+				{Header: "Tenant ID", Field: "tenantId"},
+				{Header: "Client ID", Field: "clientId"},
+				{Header: "Credential", Field: "credential"},
+				{Header: "Client Secret", Field: "clientSecret"},
+				{Header: "Secret Command", Field: "secretCommand"},
+				{Header: "Certificate Path", Field: "certificatePath"},
+				{Header: "Certificate Password", Field: "certificatePassword"},
+				{Header: "Certificate Thumbprint", Field: "certificateThumbprint"},
+				{Header: "Output", Field: "output"},
+				{Header: "Cloud", Field: "cloud"},
+			})
+		},
+	}
+
+	profilesUseCmd := &cobra.Command{
+		Use:         "use NAME",
+		Short:       "Set the default profile",
+		Args:        cobra.ExactArgs(1),
+		Annotations: noConfig,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, err := config.ReadFile(configPath)
+			if err != nil {
+				return err
+			}
+
+			if _, ok := file.Profiles[args[0]]; !ok {
+				return fmt.Errorf("profile %q not found (profiles: %v)", args[0], file.Names())
+			}
+
+			file.DefaultProfile = args[0]
+			if err := file.Save(configPath); err != nil {
+				return err
+			}
+
+			statusf("✓ Default profile is now %s\n", args[0])
+			return nil
+		},
+	}
+
+	var newProfile config.Config
+	var secretStdin, certPasswordStdin, makeDefault bool
+	profilesAddCmd := &cobra.Command{
+		Use:   "add NAME",
+		Short: "Add or update a profile",
+		Long: `Add a profile, or update an existing one with the same name.
+
+When the profile exists, only the settings given as flags are changed; everything else in it,
+including secrets and settings edited by hand, is kept. Pass an empty value (for example
+--secret-command "") to clear a setting.
+
+Secrets are never taken as command-line arguments. Use --client-secret-stdin or
+--certificate-password-stdin, --secret-command, or the GUA_CLIENT_SECRET and
+GUA_CERTIFICATE_PASSWORD environment variables.
+
+--default-output sets the profile's output format, used whenever --output is not given.`,
+		Example: `  gua config profiles add prod --tenant-id <TENANT> --client-id <CLIENT> --secret-command "pass show gua/prod"
+  gua config profiles add gcc --tenant-id <TENANT> --client-id <CLIENT> --credential-type delegated --cloud usgov
+  gua config profiles add scripts --tenant-id <TENANT> --client-id <CLIENT> --secret-command "pass show gua/prod" --default-output json
+  gua config profiles add scripts --cloud usgov
+  echo "$SECRET" | gua config profiles add test --tenant-id <TENANT> --client-id <CLIENT> --client-secret-stdin
+  echo "$PFX_PASSWORD" | gua config profiles add cert --certificate-path app.pfx --certificate-password-stdin`,
+		Args:        cobra.ExactArgs(1),
+		Annotations: noConfig,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+
+			if secretStdin && certPasswordStdin {
+				return fmt.Errorf("--client-secret-stdin and --certificate-password-stdin cannot be used together")
+			}
+
+			file, err := config.ReadFile(configPath)
+			if err != nil {
+				return err
+			}
+
+			// Start from the existing profile so settings not given as flags are kept
+			var profile config.Config
+			existing, replaced := file.Profiles[name]
+			if replaced {
+				profile = *existing
+			}
+
+			flags := cmd.Flags()
+			for flag, field := range map[string]*string{
+				"tenant-id":              &profile.TenantID,
+				"client-id":              &profile.ClientID,
+				"credential-type":        &profile.CredentialType,
+				"secret-command":         &profile.SecretCommand,
+				"certificate-path":       &profile.CertificatePath,
+				"certificate-thumbprint": &profile.CertificateThumbprint,
+				"default-output":         &profile.Output,
+				"cloud":                  &profile.Cloud,
+			} {
+				if flags.Changed(flag) {
+					value, _ := flags.GetString(flag)
+					*field = value
+				}
+			}
+
+			if secretStdin {
+				profile.ClientSecret, err = readStdinSecret("client secret")
+				if err != nil {
+					return err
+				}
+			}
+			if certPasswordStdin {
+				profile.CertificatePassword, err = readStdinSecret("certificate password")
+				if err != nil {
+					return err
+				}
+			}
+
+			if profile.TenantID == "" || profile.ClientID == "" {
+				return fmt.Errorf("--tenant-id and --client-id are required")
+			}
+			switch profile.CredentialType {
+			case "", config.CredentialSecret, config.CredentialCertificate, config.CredentialDelegated:
+			default:
+				return fmt.Errorf("unknown --credential-type %q: use %s, %s or %s",
+					profile.CredentialType, config.CredentialSecret, config.CredentialCertificate, config.CredentialDelegated)
+			}
+			if _, err := cloud.Lookup(profile.Cloud); err != nil {
+				return err
+			}
+			if _, err := output.ParseFormat(profile.Output); err != nil {
+				return err
+			}
+
+			file.Profiles[name] = &profile
+			if makeDefault || file.DefaultProfile == "" {
+				file.DefaultProfile = name
+			}
+
+			if err := file.Save(configPath); err != nil {
+				return err
+			}
+
+			if replaced {
+				statusf("✓ Updated profile %s\n", name)
+			} else {
+				statusf("✓ Added profile %s\n", name)
+			}
+			return nil
+		},
+	}
+	profilesAddCmd.Flags().StringVar(&newProfile.TenantID, "tenant-id", "", "Tenant ID (required for a new profile)")
+	profilesAddCmd.Flags().StringVar(&newProfile.ClientID, "client-id", "", "Application (client) ID (required for a new profile)")
+	profilesAddCmd.Flags().StringVar(&newProfile.CredentialType, "credential-type", "", "Credential kind: secret, certificate or delegated (default: inferred)")
+	profilesAddCmd.Flags().StringVar(&newProfile.SecretCommand, "secret-command", "", "Command that prints the client secret (or the certificate password)")
+	profilesAddCmd.Flags().StringVar(&newProfile.CertificatePath, "certificate-path", "", "PEM or PFX certificate file for certificate authentication")
+	profilesAddCmd.Flags().StringVar(&newProfile.CertificateThumbprint, "certificate-thumbprint", "", "Certificate SHA-1 thumbprint (only for PEM files without a certificate)")
+	profilesAddCmd.Flags().StringVar(&newProfile.Output, "default-output", "", "Default output format for this profile: table, json, jsonl, csv or yaml")
+	profilesAddCmd.Flags().StringVar(&newProfile.Cloud, "cloud", "", "Microsoft cloud of the tenant: "+strings.Join(cloud.Names(), ", "))
+	profilesAddCmd.Flags().BoolVar(&secretStdin, "client-secret-stdin", false, "Read the client secret from standard input")
+	profilesAddCmd.Flags().BoolVar(&certPasswordStdin, "certificate-password-stdin", false, "Read the PFX certificate password from standard input")
+	profilesAddCmd.Flags().BoolVar(&makeDefault, "default", false, "Make this the default profile")
+
+	profilesRemoveCmd := &cobra.Command{
+		Use:         "remove NAME",
+		Short:       "Remove a profile",
+		Args:        cobra.ExactArgs(1),
+		Annotations: noConfig,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, err := config.ReadFile(configPath)
+			if err != nil {
+				return err
+			}
+
+			if _, ok := file.Profiles[args[0]]; !ok {
+				return fmt.Errorf("profile %q not found (profiles: %v)", args[0], file.Names())
+			}
+
+			delete(file.Profiles, args[0])
+			if file.DefaultProfile == args[0] {
+				file.DefaultProfile = ""
+			}
+
+			if err := file.Save(configPath); err != nil {
+				return err
+			}
+
+			statusf("✓ Removed profile %s\n", args[0])
+			if file.DefaultProfile == "" && len(file.Profiles) > 1 {
+				statusf("Note: there is no default profile now; set one with 'gua config profiles use <name>'.\n")
+			}
+			return nil
+		},
+	}
+
+	profilesCmd.AddCommand(profilesListCmd, profilesShowCmd, profilesUseCmd, profilesAddCmd, profilesRemoveCmd)
+	configCmd.AddCommand(profilesCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// profileView is what the profile commands show; secrets are masked
+type profileView struct {
+	Name                  string `json:"name"`
+	Default               bool   `json:"default"`
+	TenantID              string `json:"tenantId"`
+	ClientID              string `json:"clientId"`
+	Credential            string `json:"credential"`
+	ClientSecret          string `json:"clientSecret,omitempty"`
+	SecretCommand         string `json:"secretCommand,omitempty"`
+	CertificatePath       string `json:"certificatePath,omitempty"`
+	CertificatePassword   string `json:"certificatePassword,omitempty"`
+	CertificateThumbprint string `json:"certificateThumbprint,omitempty"`
+	Output                string `json:"output,omitempty"`
+	Cloud                 string `json:"cloud,omitempty"`
+}
+
+func newProfileView(profile *config.Config, defaultProfile string) profileView {
+	return profileView{
+		Name:                  profile.Name,
+		Default:               profile.Name == defaultProfile,
+		TenantID:              profile.TenantID,
+		ClientID:              profile.ClientID,
+		Credential:            profile.Credential(),
+		ClientSecret:          mask(profile.ClientSecret),
+		SecretCommand:         profile.SecretCommand,
+		CertificatePath:       profile.CertificatePath,
+		CertificatePassword:   mask(profile.CertificatePassword),
+		CertificateThumbprint: profile.CertificateThumbprint,
+		Output:                profile.Output,
+		Cloud:                 profile.Cloud,
+	}
+}
+
+// mask hides a secret while still showing whether it is set
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "********"
+}
+
+// readStdinSecret reads one line from standard input for profiles add
+func readStdinSecret(what string) (string, error) {
+	secret, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	secret = strings.TrimRight(secret, "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("no %s on standard input: %v", what, err)
+	}
+	return secret, nil
+}
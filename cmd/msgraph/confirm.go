@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// addConfirmFlags adds --yes and its alias --force to a destructive command
+func addConfirmFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("yes", "y", false, "Don't ask for confirmation (for scripts and scheduled jobs)")
+	cmd.Flags().Bool("force", false, "Same as --yes")
+}
+
+// confirm asks before a destructive change and reports whether to go ahead
+func confirm(cmd *cobra.Command, warning string) (bool, error) {
+	return askConfirmation(cmd, warning, "Continue? (yes/no): ", "yes")
+}
+
+// confirmTyped asks before a change that can't be undone; the user has to type expected to go ahead
+func confirmTyped(cmd *cobra.Command, warning, expected string) (bool, error) {
+	return askConfirmation(cmd, warning, fmt.Sprintf("Type %s to confirm: ", expected), expected)
+}
+
+// askConfirmation shows the warning and prompt and compares the reply with answer. Dry runs change
+// nothing and --yes answers for the user, so neither asks. Otherwise stdin must be a terminal: a
+// script or scheduled job fails straight away instead of waiting for a reply that never comes.
+func askConfirmation(cmd *cobra.Command, warning, prompt, answer string) (bool, error) {
+	yes, _ := cmd.Flags().GetBool("yes")
+	force, _ := cmd.Flags().GetBool("force")
+	if dryRun || yes || force {
+		return true, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("%s needs confirmation, but stdin is not a terminal: add --yes to confirm", cmd.CommandPath())
+	}
+
+	statusf("⚠ Warning: %s\n", warning)
+	statusf("%s", prompt)
+	reply, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("failed to read confirmation: %w", err)
+	}
+
+	if !strings.EqualFold(strings.TrimSpace(reply), answer) {
+		statusf("Cancelled.\n")
+		return false, nil
+	}
+	return true, nil
+}
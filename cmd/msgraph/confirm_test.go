@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// deletedLeaver adds jdoe@contoso.com, deleted with ID u1, to the leaver fixture
+func deletedLeaver(method, path string) (int, string) {
+	if method == http.MethodGet && path == "/directory/deletedItems/microsoft.graph.user" {
+		return http.StatusOK, `{"value":[{"id":"u1","displayName":"Jane Doe","userPrincipalName":"u1jdoe@contoso.com","deletedDateTime":"2024-05-01T09:00:00Z"}]}`
+	}
+	return leaver(method, path)
+}
+
+func TestConfirmation(t *testing.T) {
+	// stdin is a file with the answers ready, so only the terminal check stops the prompt
+	stdin := captureFile(t)
+	stdin.WriteString("yes\njdoe@contoso.com\n")
+	stdin.Seek(0, io.SeekStart)
+	savedStdin := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = savedStdin }()
+
+	tests := []struct {
+		name string
+		args []string
+		// want is the change sent, or empty when none may be
+		want    string
+		wantErr bool
+	}{
+		{"delete without --yes", []string{"users", "delete", "jdoe@contoso.com"}, "", true},
+		{"delete --yes", []string{"users", "delete", "jdoe@contoso.com", "--yes"}, "DELETE /users/jdoe@contoso.com", false},
+		{"delete -y", []string{"users", "delete", "jdoe@contoso.com", "-y"}, "DELETE /users/jdoe@contoso.com", false},
+		{"delete --force", []string{"users", "delete", "jdoe@contoso.com", "--force"}, "DELETE /users/jdoe@contoso.com", false},
+		{"delete --dry-run", []string{"users", "delete", "jdoe@contoso.com", "--dry-run"}, "", false},
+		{"purge without --yes", []string{"users", "deleted", "purge", "u1"}, "", true},
+		{"purge --yes", []string{"users", "deleted", "purge", "u1", "--yes"}, "DELETE /directory/deletedItems/u1", false},
+		{"purge --dry-run", []string{"users", "deleted", "purge", "u1", "--dry-run"}, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := newFakeGraph(t, deletedLeaver)
+
+			_, stderr, err := runCommand(t, g, test.args...)
+			if test.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "stdin is not a terminal") {
+					t.Errorf("error is %v, want one about stdin", err)
+				}
+				if strings.Contains(stderr, "Continue?") || strings.Contains(stderr, "to confirm:") {
+					t.Errorf("prompted without a terminal:\n%s", stderr)
+				}
+			} else if err != nil {
+				t.Errorf("%s: %v\n%s", test.name, err, stderr)
+			}
+
+			if sent := strings.Join(g.sent(), ","); sent != test.want {
+				t.Errorf("sent %q, want %q", sent, test.want)
+			}
+		})
+	}
+}
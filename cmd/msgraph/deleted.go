@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"GraphUserAdmin/internal/output"
+	"GraphUserAdmin/internal/users"
+
+	"github.com/spf13/cobra"
+)
+
+// deletedUserRow is a deleted user as shown by users deleted list
+type deletedUserRow struct {
+	ID                string    `json:"id"`
+	DisplayName       string    `json:"displayName"`
+	UserPrincipalName string    `json:"userPrincipalName"`
+	DeletedDateTime   time.Time `json:"deletedDateTime"`
+	PurgeDateTime     time.Time `json:"purgeDateTime"`
+	DaysRemaining     int       `json:"daysRemaining"`
+}
+
+var deletedUserColumns = []output.Column{
+	{Header: "Display Name", Field: "displayName"},
+	{Header: "User Principal Name", Field: "userPrincipalName"},
+	{Header: "ID", Field: "id"},
+	{Header: "Deleted", Compute: func(record map[string]interface{}) interface{} {
+		return localDate(record["deletedDateTime"])
+	}},
+	{Header: "Purged After", Compute: func(record map[string]interface{}) interface{} {
+		return localDate(record["purgeDateTime"])
+	}},
+	{Header: "Days Left", Field: "daysRemaining"},
+}
+
+// setupUsersDeletedCommands creates the users deleted command and its subcommands
+func setupUsersDeletedCommands(usersCmd *cobra.Command) {
+	deletedCmd := &cobra.Command{
+		Use:   "deleted",
+		Short: "Restore or purge deleted users",
+		Long: fmt.Sprintf(`Deleted users stay in the directory's recycle bin for %d days. Until then they can be restored
+with their licenses and group memberships, or purged to remove them for good.`, users.RetentionDays),
+	}
+
+	deletedListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List deleted users that can still be restored",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deleted, err := users.ListDeletedUsers(client)
+			if err != nil {
+				return err
+			}
+
+			if len(deleted) == 0 && printer.Format == output.Table {
+				fmt.Println("No deleted users.")
+				return nil
+			}
+
+			now := time.Now()
+			rows := make([]deletedUserRow, len(deleted))
+			for i, user := range deleted {
+				rows[i] = deletedUserRow{
+					ID:                user.ID,
+					DisplayName:       user.DisplayName,
+					UserPrincipalName: user.OriginalUserPrincipalName(),
+					DeletedDateTime:   user.DeletedDateTime,
+					PurgeDateTime:     user.PurgeDate(),
+					DaysRemaining:     user.DaysRemaining(now),
+				}
+			}
+			return printer.List(rows, deletedUserColumns)
+		},
+	}
+
+	deletedRestoreCmd := &cobra.Command{
+		Use:   "restore [ID|UPN]",
+		Short: "Restore a deleted user",
+		Long: `Restore a deleted user by object ID or by the UPN they had before deletion. The user comes back
+with their licenses, group memberships and UPN. Restoring fails when another user has taken the UPN
+in the meantime.`,
+		Example: `  gua users deleted restore jdoe@example.com
+  gua users deleted restore 3f1c2a9e-0d4b-4c55-9a7e-2b8e51f0c6d1`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deleted, err := users.FindDeletedUser(client, args[0])
+			if err != nil {
+				return err
+			}
+
+			if _, err := users.RestoreDeletedUser(client, deleted.ID); err != nil {
+				return err
+			}
+			if dryRun {
+				return nil
+			}
+
+			// The restore response leaves out properties such as accountEnabled
+			user, err := users.GetUser(client, deleted.ID)
+			if err != nil {
+				return err
+			}
+
+			statusf("✓ Successfully restored user %s\n", deleted.OriginalUserPrincipalName())
+			return printer.Object(user, userDetailColumns)
+		},
+	}
+
+	deletedPurgeCmd := &cobra.Command{
+		Use:   "purge [ID]",
+		Short: "Permanently delete a deleted user",
+		Long: `Permanently delete a user from the recycle bin. The user can never be restored afterwards.
+The object ID is required, as shown by 'gua users deleted list', and you are asked to type the user's
+UPN to confirm (or pass --yes).`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deleted, err := users.FindDeletedUser(client, args[0])
+			if err != nil {
+				return err
+			}
+			// Object IDs are GUIDs, which compare without case
+			if !strings.EqualFold(deleted.ID, args[0]) {
+				return fmt.Errorf("purge needs the object ID of the deleted user: %s", deleted.ID)
+			}
+			upn := deleted.OriginalUserPrincipalName()
+
+			warning := fmt.Sprintf("This will permanently delete %s (%s), deleted on %s. The user can NOT be restored afterwards.",
+				upn, deleted.DisplayName, localDate(deleted.DeletedDateTime))
+			if ok, err := confirmTyped(cmd, warning, upn); !ok || err != nil {
+				return err
+			}
+
+			if err := users.PurgeDeletedUser(client, deleted.ID); err != nil {
+				return err
+			}
+
+			successf("✓ Permanently deleted user %s\n", upn)
+			return nil
+		},
+	}
+
+	addConfirmFlags(deletedPurgeCmd)
+
+	deletedCmd.AddCommand(deletedListCmd, deletedRestoreCmd, deletedPurgeCmd)
+	usersCmd.AddCommand(deletedCmd)
+}
+
+// localDate formats a time, or its JSON value, as a local date
+func localDate(value interface{}) string {
+	t, ok := value.(time.Time)
+	if !ok {
+		parsed, err := time.Parse(time.RFC3339Nano, output.FormatValue(value))
+		if err != nil {
+			return output.FormatValue(value)
+		}
+		t = parsed
+	}
+	return t.Local().Format("2006-01-02")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	"GraphUserAdmin/internal/audit"
+	"GraphUserAdmin/internal/groups"
+	"GraphUserAdmin/internal/users"
+)
+
+// dryRun is the value of the --dry-run flag
+var dryRun bool
+
+// planned counts the requests shown instead of sent in dry-run mode
+var planned struct {
+	sync.Mutex
+	count int
+}
+
+// printPlannedRequest shows a request that dry-run mode kept from being sent. Passwords are
+// redacted as in the audit log, so the output can be shared for review. The plan goes to stderr
+// so that stdout holds only the command's results in the selected output format.
+func printPlannedRequest(method, url string, body []byte) {
+	planned.Lock()
+	defer planned.Unlock()
+	planned.count++
+
+	statusf("%s %s\n", method, url)
+	if len(body) > 0 {
+		body = audit.Redact(body)
+		var indented bytes.Buffer
+		if json.Indent(&indented, body, "", "  ") == nil {
+			body = indented.Bytes()
+		}
+		statusf("%s\n", body)
+	}
+	statusf("\n")
+}
+
+// printDryRunSummary reports how many requests a dry run held back
+func printDryRunSummary() {
+	planned.Lock()
+	defer planned.Unlock()
+	statusf("Dry run: %d request(s) would have been sent. Nothing was changed.\n", planned.count)
+}
+
+// successf reports a completed change. Dry runs change nothing, so the message is left out.
+func successf(format string, args ...interface{}) {
+	if !dryRun {
+		statusf(format, args...)
+	}
+}
+
+// checkUser looks the user up in dry-run mode, so a mistyped UPN shows up before the real run.
+// A real run finds out from the change request itself.
+func checkUser(userPrincipalName string) error {
+	if !dryRun {
+		return nil
+	}
+	_, err := users.GetUser(client, userPrincipalName)
+	return err
+}
+
+// checkGroup looks the group up in dry-run mode, like checkUser
+func checkGroup(groupID string) error {
+	if !dryRun {
+		return nil
+	}
+	_, err := groups.GetGroup(client, groupID)
+	return err
+}
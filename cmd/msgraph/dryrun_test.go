@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// leaver answers the lookups for offboarding jdoe@contoso.com (ID u1), who has a direct E3
+// license and is a member of one security group. Changes succeed.
+func leaver(method, path string) (int, string) {
+	if method != http.MethodGet {
+		return http.StatusNoContent, ""
+	}
+	switch path {
+	case "/users/jdoe@contoso.com":
+		return http.StatusOK, `{"id":"u1","displayName":"Jane Doe","userPrincipalName":"jdoe@contoso.com","accountEnabled":true}`
+	case "/users/u1":
+		return http.StatusOK, `{"licenseAssignmentStates":[{"skuId":"sku-e3","assignedByGroup":null,"state":"Active"}]}`
+	case "/users/u1/licenseDetails":
+		return http.StatusOK, `{"value":[{"skuId":"sku-e3","skuPartNumber":"ENTERPRISEPACK"}]}`
+	case "/users/u1/memberOf/microsoft.graph.group":
+		return http.StatusOK, `{"value":[{"id":"g1","displayName":"Sales","securityEnabled":true}]}`
+	}
+	return http.StatusNotFound, `{"error":{"code":"Request_ResourceNotFound","message":"Resource does not exist."}}`
+}
+
+func TestDryRunKeepsStdoutMachineReadable(t *testing.T) {
+	tests := []struct {
+		format string
+		check  func(t *testing.T, stdout string)
+	}{
+		{"json", func(t *testing.T, stdout string) {
+			var rows []offboardRow
+			if err := json.Unmarshal([]byte(stdout), &rows); err != nil {
+				t.Fatalf("stdout is not JSON: %v\n%s", err, stdout)
+			}
+			if len(rows) == 0 || rows[0].Step != "disable" || rows[0].Status != "planned" {
+				t.Errorf("rows are %+v", rows)
+			}
+		}},
+		{"jsonl", func(t *testing.T, stdout string) {
+			for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+				var row offboardRow
+				if err := json.Unmarshal([]byte(line), &row); err != nil {
+					t.Fatalf("line %q is not JSON: %v", line, err)
+				}
+			}
+		}},
+		{"csv", func(t *testing.T, stdout string) {
+			records, err := csv.NewReader(strings.NewReader(stdout)).ReadAll()
+			if err != nil {
+				t.Fatalf("stdout is not CSV: %v\n%s", err, stdout)
+			}
+			if len(records) == 0 || records[0][0] != "Step" {
+				t.Errorf("records are %q", records)
+			}
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			g := newFakeGraph(t, leaver)
+
+			stdout, stderr, err := runCommand(t, g, "users", "offboard", "jdoe@contoso.com",
+				"--dry-run", "-o", test.format, "--state-dir", t.TempDir(), "--delete-after", "0")
+			if err != nil {
+				t.Fatalf("offboard: %v\n%s", err, stderr)
+			}
+
+			test.check(t, stdout)
+			for _, planned := range []string{"PATCH ", "POST ", "DELETE "} {
+				if strings.Contains(stdout, planned) {
+					t.Errorf("stdout contains a planned %srequest:\n%s", planned, stdout)
+				}
+				if !strings.Contains(stderr, planned) {
+					t.Errorf("stderr has no planned %srequest:\n%s", planned, stderr)
+				}
+			}
+			if sent := g.sent(); len(sent) != 0 {
+				t.Errorf("dry run sent %q", sent)
+			}
+		})
+	}
+}
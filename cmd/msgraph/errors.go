@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"GraphUserAdmin/internal/graph"
+)
+
+// Exit codes let scripts react to a class of failure; keep them stable
+const (
+	exitError      = 1
+	exitValidation = 2
+	exitNotFound   = 3
+	exitForbidden  = 4
+	exitConflict   = 5
+	exitThrottled  = 6
+)
+
+// exitCode maps an error returned by a command to the process exit code
+func exitCode(err error) int {
+	var graphErr *graph.GraphError
+	if !errors.As(err, &graphErr) {
+		return exitError
+	}
+
+	switch graphErr.Kind() {
+	case graph.KindValidation:
+		return exitValidation
+	case graph.KindNotFound:
+		return exitNotFound
+	case graph.KindForbidden:
+		return exitForbidden
+	case graph.KindConflict:
+		return exitConflict
+	case graph.KindThrottled:
+		return exitThrottled
+	}
+	return exitError
+}
+
+// printError writes an error to stderr, with Graph diagnostics when available
+func printError(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+
+	var graphErr *graph.GraphError
+	if !errors.As(err, &graphErr) {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "  Status:            %d (%s)\n", graphErr.StatusCode, graphErr.Kind())
+	if graphErr.RequestID != "" {
+		fmt.Fprintf(os.Stderr, "  Request ID:        %s\n", graphErr.RequestID)
+	}
+	if graphErr.ClientRequestID != "" {
+		fmt.Fprintf(os.Stderr, "  Client Request ID: %s\n", graphErr.ClientRequestID)
+	}
+	if verbose && graphErr.InnerError != nil && graphErr.InnerError.Date != "" {
+		fmt.Fprintf(os.Stderr, "  Date:              %s\n", graphErr.InnerError.Date)
+	}
+}
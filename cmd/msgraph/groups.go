@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"GraphUserAdmin/internal/groups"
+	"GraphUserAdmin/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+var groupDetailColumns = []output.Column{
+	{Header: "ID", Field: "id"},
+	{Header: "Display Name", Field: "displayName"},
+	{Header: "Type", Compute: func(record map[string]interface{}) interface{} {
+		group := groups.Group{}
+		group.MailEnabled, _ = record["mailEnabled"].(bool)
+		group.SecurityEnabled, _ = record["securityEnabled"].(bool)
+		groupTypes, _ := record["groupTypes"].([]interface{})
+		for _, groupType := range groupTypes {
+			group.GroupTypes = append(group.GroupTypes, output.FormatValue(groupType))
+		}
+		return group.Kind()
+	}},
+	{Header: "Mail", Field: "mail"},
+	{Header: "Mail Nickname", Field: "mailNickname"},
+	{Header: "Visibility", Field: "visibility"},
+	{Header: "Description", Field: "description"},
+}
+
+var deletedGroupColumns = []output.Column{
+	{Header: "Display Name", Field: "displayName"},
+	{Header: "Mail", Field: "mail"},
+	{Header: "ID", Field: "id"},
+	{Header: "Deleted", Compute: func(record map[string]interface{}) interface{} {
+		return localDate(record["deletedDateTime"])
+	}},
+	{Header: "Purged After", Compute: func(record map[string]interface{}) interface{} {
+		return localDate(record["purgeDateTime"])
+	}},
+}
+
+// deletedGroupRow is a deleted group as shown by groups deleted list
+type deletedGroupRow struct {
+	groups.DeletedGroup
+	PurgeDateTime time.Time `json:"purgeDateTime"`
+}
+
+// setupGroupsManageCommands creates the groups create, update, delete and deleted commands
+func setupGroupsManageCommands(groupsCmd *cobra.Command) {
+	var groupType, mailNickname, description, visibility string
+	groupsCreateCmd := &cobra.Command{
+		Use:   "create [DISPLAY_NAME]",
+		Short: "Create a group",
+		Long: `Create a group. Group types:
+  security  security group for access and license assignment (default)
+  m365      Microsoft 365 group with a shared mailbox, calendar and SharePoint site
+
+The mail nickname is derived from the display name unless --mail-nickname is given. Visibility
+(Private, Public or HiddenMembership) applies to Microsoft 365 groups only; HiddenMembership can't be
+changed after creation. Microsoft Graph can't create mail-enabled security groups or distribution
+lists; create those in the Exchange admin center.`,
+		Example: `  gua groups create "Engineering"
+  gua groups create "Project Falcon" --type m365 --visibility Private --description "Falcon project team"
+  gua groups create "Finance Team" --type m365 --mail-nickname finance-team`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			displayName := args[0]
+
+			nickname := mailNickname
+			if nickname == "" {
+				nickname = deriveMailNickname(displayName)
+				if nickname == "" {
+					return fmt.Errorf("can't derive a mail nickname from %q: use --mail-nickname", displayName)
+				}
+			}
+
+			createReq, err := groups.NewCreateGroupRequest(groupType, displayName, nickname)
+			if err != nil {
+				return err
+			}
+			createReq.Description = description
+			if visibility != "" {
+				if len(createReq.GroupTypes) == 0 {
+					return fmt.Errorf("--visibility only applies to Microsoft 365 groups (--type %s)", groups.TypeMicrosoft365)
+				}
+				if createReq.Visibility, err = groupVisibility(visibility); err != nil {
+					return err
+				}
+			}
+
+			group, err := groups.CreateGroup(client, createReq)
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				return nil
+			}
+
+			statusf("✓ Successfully created group!\n")
+			return printer.Object(group, groupDetailColumns)
+		},
+	}
+	groupsCreateCmd.Flags().StringVar(&groupType, "type", groups.TypeSecurity, "Group type: security or m365")
+	groupsCreateCmd.Flags().StringVar(&mailNickname, "mail-nickname", "", "Mail nickname (default: derived from the display name)")
+	groupsCreateCmd.Flags().StringVar(&description, "description", "", "Group description")
+	groupsCreateCmd.Flags().StringVar(&visibility, "visibility", "", "Visibility of a Microsoft 365 group: Private, Public or HiddenMembership")
+
+	groupsUpdateCmd := &cobra.Command{
+		Use:   "update [GROUP_ID] [PROPERTY] [VALUE]",
+		Short: "Update a group property",
+		Long: `Update a group property. Common properties:
+  - displayName
+  - description
+  - mailNickname
+  - visibility (Private or Public, Microsoft 365 groups only)`,
+		Example: `  gua groups update <GROUP_ID> description "Engineering team, all locations"
+  gua groups update <GROUP_ID> visibility Private`,
+		Args: cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			groupID := args[0]
+			property := args[1]
+			value := args[2]
+
+			// Try to parse value as JSON for complex properties
+			var parsedValue interface{}
+			if err := json.Unmarshal([]byte(value), &parsedValue); err != nil {
+				// If not valid JSON, treat as string
+				parsedValue = value
+			}
+			if strings.EqualFold(property, "visibility") {
+				normalized, err := groupVisibility(value)
+				if err != nil {
+					return err
+				}
+				if normalized == "HiddenMembership" {
+					return fmt.Errorf("HiddenMembership can only be set when the group is created: use Private or Public")
+				}
+				parsedValue = normalized
+			}
+
+			if err := checkGroup(groupID); err != nil {
+				return err
+			}
+
+			if err := groups.UpdateGroup(client, groupID, map[string]interface{}{property: parsedValue}); err != nil {
+				return err
+			}
+
+			successf("✓ Successfully updated %s for group %s\n", property, groupID)
+			return nil
+		},
+	}
+
+	groupsDeleteCmd := &cobra.Command{
+		Use:   "delete [GROUP_ID]",
+		Short: "Delete a group",
+		Long: fmt.Sprintf(`Delete a group. Microsoft 365 groups can be restored within %d days with 'gua groups deleted restore'.
+Security and mail-enabled security groups are deleted for good, so you are asked to type the group's
+display name to confirm (or pass --yes).`, groups.RetentionDays),
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			groupID := args[0]
+
+			group, err := groups.GetGroup(client, groupID)
+			if err != nil {
+				return err
+			}
+			if group.OnPremisesSyncEnabled {
+				return fmt.Errorf("group %s is synced from on-premises Active Directory: delete it there", group.DisplayName)
+			}
+
+			if group.Unified() {
+				warning := fmt.Sprintf("This will delete Microsoft 365 group %s (%s) with its mailbox and site. It can be restored within %d days.",
+					group.DisplayName, groupID, groups.RetentionDays)
+				if ok, err := confirm(cmd, warning); !ok || err != nil {
+					return err
+				}
+			} else {
+				warning := fmt.Sprintf("This will permanently delete %s group %s (%s). It can NOT be restored afterwards.",
+					strings.ToLower(group.Kind()), group.DisplayName, groupID)
+				if ok, err := confirmTyped(cmd, warning, group.DisplayName); !ok || err != nil {
+					return err
+				}
+			}
+
+			if err := groups.DeleteGroup(client, groupID); err != nil {
+				return err
+			}
+
+			successf("✓ Successfully deleted group %s\n", group.DisplayName)
+			return nil
+		},
+	}
+	addConfirmFlags(groupsDeleteCmd)
+
+	deletedCmd := &cobra.Command{
+		Use:   "deleted",
+		Short: "List and restore deleted groups",
+		Long: fmt.Sprintf(`Deleted Microsoft 365 groups stay in the directory's recycle bin for %d days. Until then they
+can be restored with their members, owners, mailbox and site. Other groups are not kept.`, groups.RetentionDays),
+	}
+
+	deletedListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List deleted groups that can still be restored",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deleted, err := groups.ListDeletedGroups(client)
+			if err != nil {
+				return err
+			}
+
+			if len(deleted) == 0 && printer.Format == output.Table {
+				fmt.Println("No deleted groups.")
+				return nil
+			}
+
+			rows := make([]deletedGroupRow, len(deleted))
+			for i, group := range deleted {
+				rows[i] = deletedGroupRow{DeletedGroup: group, PurgeDateTime: group.PurgeDate()}
+			}
+			return printer.List(rows, deletedGroupColumns)
+		},
+	}
+
+	deletedRestoreCmd := &cobra.Command{
+		Use:   "restore [ID|NAME]",
+		Short: "Restore a deleted group",
+		Long: `Restore a deleted group by object ID, display name, mail address or mail nickname. Restoring
+fails when another group has taken the mail address in the meantime.`,
+		Example: `  gua groups deleted restore "Project Falcon"
+  gua groups deleted restore 5b2c7e1a-9f3d-4a86-b0e4-6d1f2a3c8e97`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deleted, err := groups.FindDeletedGroup(client, args[0])
+			if err != nil {
+				return err
+			}
+
+			if _, err := groups.RestoreDeletedGroup(client, deleted.ID); err != nil {
+				return err
+			}
+			if dryRun {
+				return nil
+			}
+
+			// The restore response may leave out properties such as groupTypes and visibility
+			group, err := groups.GetGroup(client, deleted.ID)
+			if err != nil {
+				return err
+			}
+
+			statusf("✓ Successfully restored group %s\n", deleted.DisplayName)
+			return printer.Object(group, groupDetailColumns)
+		},
+	}
+
+	deletedCmd.AddCommand(deletedListCmd, deletedRestoreCmd)
+	groupsCmd.AddCommand(groupsCreateCmd, groupsUpdateCmd, groupsDeleteCmd, deletedCmd)
+}
+
+// groupVisibility checks a visibility value and returns it as Graph spells it
+func groupVisibility(value string) (string, error) {
+	for _, visibility := range groups.Visibilities {
+		if strings.EqualFold(value, visibility) {
+			return visibility, nil
+		}
+	}
+	return "", fmt.Errorf("unknown visibility %q: use %s", value, strings.Join(groups.Visibilities, ", "))
+}
+
+// deriveMailNickname turns a display name into a mail nickname by dropping the characters Graph
+// doesn't accept, e.g. "Project Falcon (EU)" becomes "ProjectFalconEU"
+func deriveMailNickname(displayName string) string {
+	var b strings.Builder
+	for _, r := range displayName {
+		if r < 128 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			b.WriteRune(r)
+		}
+	}
+	return strings.Trim(b.String(), ".")
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeriveMailNickname(t *testing.T) {
+	tests := []struct {
+		displayName string
+		want        string
+	}{
+		{"Sales", "Sales"},
+		{"Project Falcon (EU)", "ProjectFalconEU"},
+		{"team-alpha_2024.q1", "team-alpha_2024.q1"},
+		{"Équipe Café Zürich", "quipeCafZrich"},
+		{"sales@contoso.com", "salescontoso.com"},
+		{`Ops ()\[]";:<>, Team`, "OpsTeam"},
+		{"tab\tand\nnewline", "tabandnewline"},
+		{"...dots...", "dots"},
+		{"", ""},
+		{"   ", ""},
+		{"営業部", ""},
+		{"(@)", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.displayName, func(t *testing.T) {
+			if got := deriveMailNickname(test.displayName); got != test.want {
+				t.Errorf("deriveMailNickname(%q) = %q, want %q", test.displayName, got, test.want)
+			}
+		})
+	}
+}
+
+func TestGroupsCreateWithoutMailNickname(t *testing.T) {
+	g := newFakeGraph(t, leaver)
+
+	// Nothing is left of the display name, so no request is sent with an empty nickname
+	_, _, err := runCommand(t, g, "groups", "create", "営業部")
+	if err == nil || !strings.Contains(err.Error(), "--mail-nickname") {
+		t.Errorf("error is %v, want one asking for --mail-nickname", err)
+	}
+	if sent := g.sent(); len(sent) != 0 {
+		t.Errorf("sent %q", sent)
+	}
+}
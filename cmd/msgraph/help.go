@@ -3,21 +3,107 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"os"
-	"text/tabwriter"
+	"strconv"
+	"strings"
 
 	"GraphUserAdmin/internal/groups"
 	"GraphUserAdmin/internal/licenses"
+	"GraphUserAdmin/internal/output"
 	"GraphUserAdmin/internal/users"
 
 	"github.com/spf13/cobra"
 )
 
+// Columns shown by the table and CSV output formats
+var (
+	userListColumns = []output.Column{
+		{Header: "Display Name", Field: "displayName"},
+		{Header: "User Principal Name", Field: "userPrincipalName"},
+		{Header: "Mail", Field: "mail"},
+	}
+	userDetailColumns = []output.Column{
+		{Header: "ID", Field: "id"},
+		{Header: "Display Name", Field: "displayName"},
+		{Header: "User Principal Name", Field: "userPrincipalName"},
+		{Header: "Mail", Field: "mail"},
+		{Header: "Mail Nickname", Field: "mailNickname"},
+		{Header: "Account Enabled", Field: "accountEnabled"},
+	}
+	skuColumns = []output.Column{
+		{Header: "SKU Part Number", Field: "skuPartNumber"},
+		{Header: "SKU ID", Field: "skuId"},
+		{Header: "Consumed", Field: "consumedUnits"},
+		{Header: "Total", Field: "prepaidUnits.enabled"},
+		{Header: "Remaining", Compute: func(record map[string]interface{}) interface{} {
+			total, _ := strconv.Atoi(output.FormatValue(output.Lookup(record, "prepaidUnits.enabled")))
+			consumed, _ := strconv.Atoi(output.FormatValue(output.Lookup(record, "consumedUnits")))
+			return total - consumed
+		}},
+	}
+	licenseColumns = []output.Column{
+		{Header: "SKU Part Number", Field: "skuPartNumber"},
+		{Header: "SKU ID", Field: "skuId"},
+	}
+	groupListColumns = []output.Column{
+		{Header: "Display Name", Field: "displayName"},
+		{Header: "ID", Field: "id"},
+		{Header: "Description", Field: "description"},
+	}
+	userGroupColumns = []output.Column{
+		{Header: "Display Name", Field: "displayName"},
+		{Header: "ID", Field: "id"},
+	}
+)
+
+// selectColumns returns the columns for --properties and --columns. Extra properties are appended
+// to the defaults; columns replaces them entirely. Properties already shown by a default column keep
+// its header, any other property is headed by its name.
+func selectColumns(defaults []output.Column, properties, columns []string) []output.Column {
+	// Both slices are new, so appending never writes into defaults or userDetailColumns
+	knownColumns := append(append([]output.Column{}, userDetailColumns...), defaults...)
+	fields := properties
+	selected := append([]output.Column{}, defaults...)
+	if len(columns) > 0 {
+		fields = columns
+		selected = nil
+	}
+
+	for _, field := range fields {
+		column := output.Column{Header: field, Field: field}
+		for _, known := range knownColumns {
+			if strings.EqualFold(known.Field, field) {
+				column = known
+				break
+			}
+		}
+		if len(columns) == 0 && containsColumn(selected, column.Field) {
+			continue
+		}
+		selected = append(selected, column)
+	}
+
+	return selected
+}
+
+// containsColumn reports whether a column already shows field
+func containsColumn(columns []output.Column, field string) bool {
+	for _, column := range columns {
+		if strings.EqualFold(column.Field, field) {
+			return true
+		}
+	}
+	return false
+}
+
 // setupCommands creates and configures all CLI commands
 func setupCommands(rootCmd *cobra.Command) {
 	setupUsersCommands(rootCmd)
 	setupLicensesCommands(rootCmd)
 	setupGroupsCommands(rootCmd)
+	setupAuthCommands(rootCmd)
+	setupConfigCommands(rootCmd)
+	setupAuditCommands(rootCmd)
+	setupReportCommands(rootCmd)
 }
 
 // setupUsersCommands creates the users command and its subcommands
@@ -30,71 +116,129 @@ func setupUsersCommands(rootCmd *cobra.Command) {
 	usersListCmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all users in the tenant",
+		Long: `List all users in the tenant.
+
+Use --properties to request additional properties (for example jobTitle,department) and show them
+after the default columns, or --columns to choose exactly which columns are shown. Only the
+requested properties are retrieved from Microsoft Graph ($select).
+
+--filter takes an OData filter, --search a property:text search (join several with AND or OR)
+and --orderby a sort expression.
+Searches, counts and filters combined with --orderby are sent as advanced queries
+(ConsistencyLevel: eventual). Use --advanced for filters that need it too, such as endsWith or ne.`,
+		Example: `  gua users list --filter "startsWith(displayName,'John')"
+  gua users list --search "displayName:john" --orderby displayName
+  gua users list --search "displayName:john AND mail:contoso"
+  gua users list --filter "endsWith(mail,'@example.com')" --advanced
+  gua users list --filter "accountEnabled eq false" --count
+  gua users list --orderby "displayName desc" --top 10`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			userList, err := users.ListUsers(token, "")
-			if err != nil {
-				return err
+			properties, _ := cmd.Flags().GetStringSlice("properties")
+			columns, _ := cmd.Flags().GetStringSlice("columns")
+			opts := users.ListOptions{Select: append(properties, columns...)}
+			opts.Filter, _ = cmd.Flags().GetString("filter")
+			opts.Search, _ = cmd.Flags().GetString("search")
+			opts.OrderBy, _ = cmd.Flags().GetString("orderby")
+			opts.Top, _ = cmd.Flags().GetInt("top")
+			opts.Advanced, _ = cmd.Flags().GetBool("advanced")
+
+			if count, _ := cmd.Flags().GetBool("count"); count {
+				if cmd.Flags().Changed("top") {
+					return fmt.Errorf("--count cannot be combined with --top: the count covers every user matching --filter and --search")
+				}
+				total, err := users.CountUsers(client, opts)
+				if err != nil {
+					return err
+				}
+				return printer.Object(map[string]int{"count": total}, []output.Column{{Header: "Count", Field: "count"}})
 			}
 
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "Display Name\tUser Principal Name\tMail")
-			fmt.Fprintln(w, "------------\t-------------------\t----")
-			for _, user := range userList {
-				fmt.Fprintf(w, "%s\t%s\t%s\n", user.DisplayName, user.UserPrincipalName, user.Mail)
+			userList, err := users.ListUsers(client, opts)
+			if err != nil {
+				return err
 			}
-			w.Flush()
 
-			return nil
+			return printer.List(userList, selectColumns(userListColumns, properties, columns))
 		},
 	}
+	usersListCmd.Flags().StringSlice("properties", nil, "Additional user properties to retrieve and show (comma-separated)")
+	usersListCmd.Flags().StringSlice("columns", nil, "User properties to show instead of the default columns (comma-separated)")
+	usersListCmd.Flags().String("filter", "", "OData filter expression, e.g. \"startsWith(displayName,'J')\"")
+	usersListCmd.Flags().String("search", "", "Search expression, e.g. \"displayName:john\" (advanced query)")
+	usersListCmd.Flags().String("orderby", "", "Sort expression, e.g. \"displayName desc\"")
+	usersListCmd.Flags().Int("top", 0, "Return at most this many users (default: all)")
+	usersListCmd.Flags().Bool("count", false, "Print the number of users matching --filter and --search instead of listing them (not with --top)")
+	usersListCmd.Flags().Bool("advanced", false, "Send as an advanced query (ConsistencyLevel: eventual) for endsWith, ne, not and similar filters")
 
 	usersGetCmd := &cobra.Command{
 		Use:   "get [UPN]",
 		Short: "Get details for a specific user",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			user, err := users.GetUser(token, args[0])
+			properties, _ := cmd.Flags().GetStringSlice("properties")
+			columns, _ := cmd.Flags().GetStringSlice("columns")
+
+			user, err := users.GetUser(client, args[0], append(properties, columns...)...)
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("ID:                  %s\n", user.ID)
-			fmt.Printf("Display Name:        %s\n", user.DisplayName)
-			fmt.Printf("User Principal Name: %s\n", user.UserPrincipalName)
-			fmt.Printf("Mail:                %s\n", user.Mail)
-			fmt.Printf("Mail Nickname:       %s\n", user.MailNickname)
-			fmt.Printf("Account Enabled:     %t\n", user.AccountEnabled)
-
-			return nil
+			return printer.Object(user, selectColumns(userDetailColumns, properties, columns))
 		},
 	}
+	usersGetCmd.Flags().StringSlice("properties", nil, "Additional user properties to retrieve and show (comma-separated)")
+	usersGetCmd.Flags().StringSlice("columns", nil, "User properties to show instead of the default fields (comma-separated)")
 
 	usersCreateCmd := &cobra.Command{
-		Use:   "create [UPN] [DISPLAY_NAME] [MAIL_NICKNAME] [PASSWORD]",
+		Use:   "create [UPN] [DISPLAY_NAME] [MAIL_NICKNAME]",
 		Short: "Create a new user",
-		Long:  "Create a new user with the specified details. The user will be required to change password on first sign-in.",
-		Args:  cobra.ExactArgs(4),
+		Long: `Create a new user with the specified details. The user will be required to change password on first sign-in.
+
+The password is prompted for without echo. Use --generate-password to create a random one that is
+shown once (or written to --password-file), or --password-stdin to read it from a pipe.
+Passing the password as a fourth argument still works but is deprecated, because it is visible in
+shell history and process lists.`,
+		Example: `  gua users create jdoe@example.com "John Doe" jdoe
+  gua users create jdoe@example.com "John Doe" jdoe --generate-password --password-file jdoe.txt
+  pass show onboarding/jdoe | gua users create jdoe@example.com "John Doe" jdoe --password-stdin`,
+		Args: cobra.RangeArgs(3, 4),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			upn := args[0]
 			displayName := args[1]
 			mailNickname := args[2]
-			password := args[3]
 
-			user, err := users.CreateUser(token, displayName, upn, mailNickname, password, true)
+			var positional string
+			if len(args) == 4 {
+				positional = args[3]
+			}
+			password, generated, err := newPassword(cmd, positional)
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("✓ Successfully created user!\n")
-			fmt.Printf("ID:                  %s\n", user.ID)
-			fmt.Printf("Display Name:        %s\n", user.DisplayName)
-			fmt.Printf("User Principal Name: %s\n", user.UserPrincipalName)
-			fmt.Printf("Mail Nickname:       %s\n", user.MailNickname)
+			user, err := users.CreateUser(client, displayName, upn, mailNickname, password, true)
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				return nil
+			}
 
-			return nil
+			statusf("✓ Successfully created user!\n")
+			if generated {
+				deliverPassword(cmd, upn, password)
+			}
+			return printer.Object(user, []output.Column{
+				{Header: "ID", Field: "id"},
+				{Header: "Display Name", Field: "displayName"},
+				{Header: "User Principal Name", Field: "userPrincipalName"},
+				{Header: "Mail Nickname", Field: "mailNickname"},
+			})
 		},
 	}
 
+	addPasswordInputFlags(usersCreateCmd)
+
 	usersUpdateCmd := &cobra.Command{
 		Use:   "update [UPN] [PROPERTY] [VALUE]",
 		Short: "Update a user property",
@@ -123,13 +267,20 @@ func setupUsersCommands(rootCmd *cobra.Command) {
 			properties := map[string]interface{}{
 				property: parsedValue,
 			}
+			if strings.EqualFold(property, "passwordProfile") {
+				statusf("⚠ Warning: the password is visible in shell history and process lists. Use 'gua users reset-password' instead.\n")
+			}
+
+			if err := checkUser(upn); err != nil {
+				return err
+			}
 
-			err = users.UpdateUser(token, upn, properties)
+			err = users.UpdateUser(client, upn, properties)
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("✓ Successfully updated %s for %s\n", property, upn)
+			successf("✓ Successfully updated %s for %s\n", property, upn)
 			return nil
 		},
 	}
@@ -137,33 +288,37 @@ func setupUsersCommands(rootCmd *cobra.Command) {
 	usersDeleteCmd := &cobra.Command{
 		Use:   "delete [UPN]",
 		Short: "Delete a user",
-		Long:  "Delete a user from the tenant. This action can be undone within 30 days by restoring from deleted users.",
+		Long:  "Delete a user from the tenant. This action can be undone within 30 days with 'gua users deleted restore'.",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			upn := args[0]
 
-			// Confirm deletion
-			fmt.Printf("⚠ Warning: This will delete user %s\n", upn)
-			fmt.Printf("Continue? (yes/no): ")
-			var response string
-			fmt.Scanln(&response)
-
-			if response != "yes" {
-				fmt.Println("Cancelled.")
-				return nil
+			if err := checkUser(upn); err != nil {
+				return err
+			}
+			if ok, err := confirm(cmd, fmt.Sprintf("This will delete user %s", upn)); !ok || err != nil {
+				return err
 			}
 
-			err := users.DeleteUser(token, upn)
+			err := users.DeleteUser(client, upn)
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("✓ Successfully deleted user %s\n", upn)
+			successf("✓ Successfully deleted user %s\n", upn)
 			return nil
 		},
 	}
 
+	addConfirmFlags(usersDeleteCmd)
+
 	usersCmd.AddCommand(usersListCmd, usersGetCmd, usersCreateCmd, usersUpdateCmd, usersDeleteCmd)
+	setupUsersImportCommand(usersCmd)
+	setupUsersResetPasswordCommand(usersCmd)
+	setupUsersAccountCommands(usersCmd)
+	setupUsersOffboardCommand(usersCmd)
+	setupUsersDeletedCommands(usersCmd)
+	setupUsersManagerCommands(usersCmd)
 	rootCmd.AddCommand(usersCmd)
 }
 
@@ -178,22 +333,12 @@ func setupLicensesCommands(rootCmd *cobra.Command) {
 		Use:   "list-skus",
 		Short: "List all available SKUs in the tenant",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			skus, err := licenses.GetSubscribedSkus(token)
+			skus, err := licenses.GetSubscribedSkus(client)
 			if err != nil {
 				return err
 			}
 
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "SKU Part Number\tSKU ID\tConsumed\tTotal\tRemaining")
-			fmt.Fprintln(w, "---------------\t------\t--------\t-----\t---------")
-			for _, sku := range skus {
-				total := sku.PrepaidUnits.Enabled
-				remaining := total - sku.ConsumedUnits
-				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\n", sku.SkuPartNumber, sku.SkuID, sku.ConsumedUnits, total, remaining)
-			}
-			w.Flush()
-
-			return nil
+			return printer.List(skus, skuColumns)
 		},
 	}
 
@@ -202,43 +347,41 @@ func setupLicensesCommands(rootCmd *cobra.Command) {
 		Short: "Show license details for a specific user",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			licenseList, err := licenses.GetUserLicenses(token, args[0])
+			licenseList, err := licenses.GetUserLicenses(client, args[0])
 			if err != nil {
 				return err
 			}
 
-			if len(licenseList) == 0 {
+			if len(licenseList) == 0 && printer.Format == output.Table {
 				fmt.Println("No licenses assigned to this user.")
 				return nil
 			}
 
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "SKU Part Number\tSKU ID")
-			fmt.Fprintln(w, "---------------\t------")
-			for _, license := range licenseList {
-				fmt.Fprintf(w, "%s\t%s\n", license.SkuPartNumber, license.SkuID)
-			}
-			w.Flush()
-
-			return nil
+			return printer.List(licenseList, licenseColumns)
 		},
 	}
 
 	licensesAddUserCmd := &cobra.Command{
 		Use:   "add-user [UPN] [SKU_ID]",
 		Short: "Add a license to a user",
-		Long:  "Add one or more licenses to a user by SKU ID. Use 'licenses list-skus' to see available SKU IDs.",
+		Long:  "Add one or more licenses to a user by SKU ID or SKU part number (e.g. ENTERPRISEPACK). Use 'licenses list-skus' to see available SKUs.",
 		Args:  cobra.MinimumNArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			upn := args[0]
-			skuIDs := args[1:]
+			skuIDs, err := licenses.ResolveSkuIDs(client, args[1:], dryRun)
+			if err != nil {
+				return err
+			}
+			if err := checkUser(upn); err != nil {
+				return err
+			}
 
-			err := licenses.AssignLicense(token, upn, skuIDs, []string{})
+			err = licenses.AssignLicense(client, upn, skuIDs, []string{})
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("✓ Successfully added %d license(s) to %s\n", len(skuIDs), upn)
+			successf("✓ Successfully added %d license(s) to %s\n", len(skuIDs), upn)
 			return nil
 		},
 	}
@@ -246,64 +389,125 @@ func setupLicensesCommands(rootCmd *cobra.Command) {
 	licensesRemoveUserCmd := &cobra.Command{
 		Use:   "remove-user [UPN] [SKU_ID]",
 		Short: "Remove a license from a user",
-		Long:  "Remove one or more licenses from a user by SKU ID. Use 'licenses get [UPN]' to see user's current licenses.",
+		Long:  "Remove one or more licenses from a user by SKU ID or SKU part number. Use 'licenses get [UPN]' to see user's current licenses.",
 		Args:  cobra.MinimumNArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			upn := args[0]
-			skuIDs := args[1:]
+			skuIDs, err := licenses.ResolveSkuIDs(client, args[1:], dryRun)
+			if err != nil {
+				return err
+			}
+			if err := checkUser(upn); err != nil {
+				return err
+			}
+			if ok, err := confirm(cmd, fmt.Sprintf("This will remove %d license(s) from %s", len(skuIDs), upn)); !ok || err != nil {
+				return err
+			}
 
-			err := licenses.AssignLicense(token, upn, []string{}, skuIDs)
+			err = licenses.AssignLicense(client, upn, []string{}, skuIDs)
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("✓ Successfully removed %d license(s) from %s\n", len(skuIDs), upn)
+			successf("✓ Successfully removed %d license(s) from %s\n", len(skuIDs), upn)
 			return nil
 		},
 	}
+	addConfirmFlags(licensesRemoveUserCmd)
+
+	licensesAddUsersCmd := &cobra.Command{
+		Use:   "add-users [SKU_ID]...",
+		Short: "Add licenses to many users",
+		Long: `Add one or more licenses (SKU IDs or part numbers) to every user given with --users or --file.
+Requests are sent in JSON batches of 20. Use --usage-location to set the users' usage location first,
+which Graph requires before a license can be assigned.`,
+		Example: `  gua licenses add-users ENTERPRISEPACK --file new-starters.txt --usage-location US
+  gua licenses add-users <SKU_ID> --users jdoe@example.com,jsmith@example.com`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			upns, err := readUserList(cmd)
+			if err != nil {
+				return err
+			}
+			skuIDs, err := licenses.ResolveSkuIDs(client, args, dryRun)
+			if err != nil {
+				return err
+			}
+			usageLocation, _ := cmd.Flags().GetString("usage-location")
+
+			errs := licenses.AssignLicenses(client, upns, skuIDs, []string{}, usageLocation)
+			return reportBulk("License assignment", upns, errs)
+		},
+	}
+	addUserListFlags(licensesAddUsersCmd)
+	licensesAddUsersCmd.Flags().String("usage-location", "", "Two-letter country code to set on each user before assigning (e.g. US)")
+
+	licensesRemoveUsersCmd := &cobra.Command{
+		Use:   "remove-users [SKU_ID]...",
+		Short: "Remove licenses from many users",
+		Long:  "Remove one or more licenses (SKU IDs or part numbers) from every user given with --users or --file. Requests are sent in JSON batches of 20.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			upns, err := readUserList(cmd)
+			if err != nil {
+				return err
+			}
+			skuIDs, err := licenses.ResolveSkuIDs(client, args, dryRun)
+			if err != nil {
+				return err
+			}
+
+			if ok, err := confirm(cmd, fmt.Sprintf("This will remove %d license(s) from %d user(s)", len(skuIDs), len(upns))); !ok || err != nil {
+				return err
+			}
+
+			errs := licenses.AssignLicenses(client, upns, []string{}, skuIDs, "")
+			return reportBulk("License removal", upns, errs)
+		},
+	}
+	addUserListFlags(licensesRemoveUsersCmd)
+	addConfirmFlags(licensesRemoveUsersCmd)
 
 	licensesGetGroupCmd := &cobra.Command{
 		Use:   "get-group [GROUP_ID]",
 		Short: "Show license details for a specific group",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			licenseList, err := licenses.GetGroupLicenses(token, args[0])
+			licenseList, err := licenses.GetGroupLicenses(client, args[0])
 			if err != nil {
 				return err
 			}
 
-			if len(licenseList) == 0 {
+			if len(licenseList) == 0 && printer.Format == output.Table {
 				fmt.Println("No licenses assigned to this group.")
 				return nil
 			}
 
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "SKU Part Number\tSKU ID")
-			fmt.Fprintln(w, "---------------\t------")
-			for _, license := range licenseList {
-				fmt.Fprintf(w, "%s\t%s\n", license.SkuPartNumber, license.SkuID)
-			}
-			w.Flush()
-
-			return nil
+			return printer.List(licenseList, licenseColumns)
 		},
 	}
 
 	licensesAddGroupCmd := &cobra.Command{
 		Use:   "add-group [GROUP_ID] [SKU_ID]",
 		Short: "Add a license to a group",
-		Long:  "Add one or more licenses to a group by SKU ID. Group-based licensing will assign licenses to all members.",
+		Long:  "Add one or more licenses to a group by SKU ID or SKU part number. Group-based licensing will assign licenses to all members.",
 		Args:  cobra.MinimumNArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			groupID := args[0]
-			skuIDs := args[1:]
+			skuIDs, err := licenses.ResolveSkuIDs(client, args[1:], dryRun)
+			if err != nil {
+				return err
+			}
+			if err := checkGroup(groupID); err != nil {
+				return err
+			}
 
-			err := licenses.AssignGroupLicense(token, groupID, skuIDs, []string{})
+			err = licenses.AssignGroupLicense(client, groupID, skuIDs, []string{})
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("✓ Successfully added %d license(s) to group %s\n", len(skuIDs), groupID)
+			successf("✓ Successfully added %d license(s) to group %s\n", len(skuIDs), groupID)
 			return nil
 		},
 	}
@@ -311,27 +515,39 @@ func setupLicensesCommands(rootCmd *cobra.Command) {
 	licensesRemoveGroupCmd := &cobra.Command{
 		Use:   "remove-group [GROUP_ID] [SKU_ID]",
 		Short: "Remove a license from a group",
-		Long:  "Remove one or more licenses from a group by SKU ID.",
+		Long:  "Remove one or more licenses from a group by SKU ID or SKU part number.",
 		Args:  cobra.MinimumNArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			groupID := args[0]
-			skuIDs := args[1:]
+			skuIDs, err := licenses.ResolveSkuIDs(client, args[1:], dryRun)
+			if err != nil {
+				return err
+			}
+			if err := checkGroup(groupID); err != nil {
+				return err
+			}
+			if ok, err := confirm(cmd, fmt.Sprintf("This will remove %d license(s) from group %s and from every member who gets them through it", len(skuIDs), groupID)); !ok || err != nil {
+				return err
+			}
 
-			err := licenses.AssignGroupLicense(token, groupID, []string{}, skuIDs)
+			err = licenses.AssignGroupLicense(client, groupID, []string{}, skuIDs)
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("✓ Successfully removed %d license(s) from group %s\n", len(skuIDs), groupID)
+			successf("✓ Successfully removed %d license(s) from group %s\n", len(skuIDs), groupID)
 			return nil
 		},
 	}
+	addConfirmFlags(licensesRemoveGroupCmd)
 
 	licensesCmd.AddCommand(
 		licensesListSkusCmd,
 		licensesGetUserCmd,
 		licensesAddUserCmd,
 		licensesRemoveUserCmd,
+		licensesAddUsersCmd,
+		licensesRemoveUsersCmd,
 		licensesGetGroupCmd,
 		licensesAddGroupCmd,
 		licensesRemoveGroupCmd,
@@ -351,20 +567,12 @@ func setupGroupsCommands(rootCmd *cobra.Command) {
 		Use:   "list",
 		Short: "List all groups in the tenant",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			groupList, err := groups.ListGroups(token)
+			groupList, err := groups.ListGroups(client)
 			if err != nil {
 				return err
 			}
 
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "Display Name\tID\tDescription")
-			fmt.Fprintln(w, "------------\t--\t-----------")
-			for _, group := range groupList {
-				fmt.Fprintf(w, "%s\t%s\t%s\n", group.DisplayName, group.ID, group.Description)
-			}
-			w.Flush()
-
-			return nil
+			return printer.List(groupList, groupListColumns)
 		},
 	}
 
@@ -373,25 +581,17 @@ func setupGroupsCommands(rootCmd *cobra.Command) {
 		Short: "Show group memberships for a specific user",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			groupList, err := groups.GetUserGroups(token, args[0])
+			groupList, err := groups.GetUserGroups(client, args[0])
 			if err != nil {
 				return err
 			}
 
-			if len(groupList) == 0 {
+			if len(groupList) == 0 && printer.Format == output.Table {
 				fmt.Println("User is not a member of any groups.")
 				return nil
 			}
 
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "Display Name\tID")
-			fmt.Fprintln(w, "------------\t--")
-			for _, group := range groupList {
-				fmt.Fprintf(w, "%s\t%s\n", group.DisplayName, group.ID)
-			}
-			w.Flush()
-
-			return nil
+			return printer.List(groupList, userGroupColumns)
 		},
 	}
 
@@ -405,17 +605,20 @@ func setupGroupsCommands(rootCmd *cobra.Command) {
 			upn := args[1]
 
 			// Get the user ID from UPN
-			user, err := users.GetUser(token, upn)
+			user, err := users.GetUser(client, upn)
 			if err != nil {
-				return fmt.Errorf("failed to get user: %w", err)
+				return err
+			}
+			if err := checkGroup(groupID); err != nil {
+				return err
 			}
 
-			err = groups.AddMemberToGroup(token, groupID, user.ID)
+			err = groups.AddMemberToGroup(client, groupID, user.ID)
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("✓ Successfully added user %s to group %s\n", upn, groupID)
+			successf("✓ Successfully added user %s to group %s\n", upn, groupID)
 			return nil
 		},
 	}
@@ -430,21 +633,67 @@ func setupGroupsCommands(rootCmd *cobra.Command) {
 			upn := args[1]
 
 			// Get the user ID from UPN
-			user, err := users.GetUser(token, upn)
+			user, err := users.GetUser(client, upn)
 			if err != nil {
-				return fmt.Errorf("failed to get user: %w", err)
+				return err
+			}
+			if err := checkGroup(groupID); err != nil {
+				return err
+			}
+			if ok, err := confirm(cmd, fmt.Sprintf("This will remove user %s from group %s", upn, groupID)); !ok || err != nil {
+				return err
 			}
 
-			err = groups.RemoveMemberFromGroup(token, groupID, user.ID)
+			err = groups.RemoveMemberFromGroup(client, groupID, user.ID)
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("✓ Successfully removed user %s from group %s\n", upn, groupID)
+			successf("✓ Successfully removed user %s from group %s\n", upn, groupID)
 			return nil
 		},
 	}
+	addConfirmFlags(groupsRemoveUserCmd)
+
+	groupsAddUsersCmd := &cobra.Command{
+		Use:   "add-users [GROUP_ID]",
+		Short: "Add many users to a group",
+		Long:  "Add every user given with --users or --file to a group. Lookups and additions are sent in JSON batches of 20.",
+		Example: `  gua groups add-users <GROUP_ID> --file engineering.txt
+  gua groups add-users <GROUP_ID> --users jdoe@example.com,jsmith@example.com`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			groupID := args[0]
+			upns, err := readUserList(cmd)
+			if err != nil {
+				return err
+			}
+			if err := checkGroup(groupID); err != nil {
+				return err
+			}
+
+			// Members are referenced by object ID
+			ids, errs := users.GetUserIDs(client, upns)
+			var found []int
+			var foundIDs []string
+			for i, id := range ids {
+				if errs[i] == nil {
+					found = append(found, i)
+					foundIDs = append(foundIDs, id)
+				}
+			}
+
+			addErrs := groups.AddMembersToGroup(client, groupID, foundIDs)
+			for j, i := range found {
+				errs[i] = addErrs[j]
+			}
+
+			return reportBulk("Group membership", upns, errs)
+		},
+	}
+	addUserListFlags(groupsAddUsersCmd)
 
-	groupsCmd.AddCommand(groupsListCmd, groupsGetUserCmd, groupsAddUserCmd, groupsRemoveUserCmd)
+	groupsCmd.AddCommand(groupsListCmd, groupsGetUserCmd, groupsAddUserCmd, groupsRemoveUserCmd, groupsAddUsersCmd)
+	setupGroupsManageCommands(groupsCmd)
 	rootCmd.AddCommand(groupsCmd)
 }
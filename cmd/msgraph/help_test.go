@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"GraphUserAdmin/internal/output"
+)
+
+func headerList(columns []output.Column) string {
+	headers := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = column.Header
+	}
+	return strings.Join(headers, ",")
+}
+
+func TestSelectColumns(t *testing.T) {
+	// Spare capacity would let an append write past the defaults' length
+	defaults := make([]output.Column, 2, 10)
+	copy(defaults, userListColumns)
+	detailHeaders := headerList(userDetailColumns)
+
+	tests := []struct {
+		name       string
+		properties []string
+		columns    []string
+		want       string
+	}{
+		{"defaults", nil, nil, "Display Name,User Principal Name"},
+		{"extra properties", []string{"jobTitle", "MAIL", "displayName"}, nil, "Display Name,User Principal Name,jobTitle,Mail"},
+		{"columns", nil, []string{"accountEnabled", "displayName", "department"}, "Account Enabled,Display Name,department"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := selectColumns(defaults, test.properties, test.columns)
+			if headers := headerList(got); headers != test.want {
+				t.Errorf("headers are %s, want %s", headers, test.want)
+			}
+			if headers := headerList(defaults[:cap(defaults)][:3]); headers != "Display Name,User Principal Name," {
+				t.Errorf("defaults were changed: %s", headers)
+			}
+			if headers := headerList(userDetailColumns[:cap(userDetailColumns)]); headers != detailHeaders {
+				t.Errorf("userDetailColumns were changed: %s", headers)
+			}
+		})
+	}
+}
+
+func TestUsersListCount(t *testing.T) {
+	g := newFakeGraph(t, func(method, path string) (int, string) {
+		return http.StatusOK, `{"@odata.count":42,"value":[{"id":"u1"}]}`
+	})
+
+	stdout, stderr, err := runCommand(t, g, "users", "list", "--filter", "accountEnabled eq false", "--count")
+	if err != nil {
+		t.Fatalf("users list --count: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, "42") {
+		t.Errorf("output is %q, want the count", stdout)
+	}
+	if query := g.query("GET /users"); query.Get("$filter") != "accountEnabled eq false" || query.Get("$count") != "true" {
+		t.Errorf("query is %v", query)
+	}
+
+	// The count always covers the whole filter, so a limit is rejected rather than ignored
+	g.requests = nil
+	if _, _, err := runCommand(t, g, "users", "list", "--count", "--top", "10"); err == nil || !strings.Contains(err.Error(), "--top") {
+		t.Errorf("error is %v, want one about --top", err)
+	}
+	if len(g.requests) != 0 {
+		t.Errorf("sent %q", g.requests)
+	}
+}
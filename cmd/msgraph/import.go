@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"GraphUserAdmin/internal/fileutil"
+	"GraphUserAdmin/internal/graph"
+	"GraphUserAdmin/internal/output"
+	"GraphUserAdmin/internal/password"
+	"GraphUserAdmin/internal/users"
+
+	"github.com/spf13/cobra"
+)
+
+// Import result statuses
+const (
+	importCreated = "created"
+	importPartial = "partial"
+	importFailed  = "failed"
+)
+
+// importResult is the outcome of importing one CSV row
+type importResult struct {
+	Line              int    `json:"line"`
+	UserPrincipalName string `json:"userPrincipalName"`
+	Status            string `json:"status"`
+	ID                string `json:"id,omitempty"`
+	Error             string `json:"error,omitempty"`
+	// Password is set when it was generated; it is only written to the results file
+	Password string `json:"-"`
+}
+
+var importResultColumns = []output.Column{
+	{Header: "Line", Field: "line"},
+	{Header: "User Principal Name", Field: "userPrincipalName"},
+	{Header: "Status", Field: "status"},
+	{Header: "ID", Field: "id"},
+	{Header: "Error", Field: "error"},
+}
+
+// setupUsersImportCommand adds the import command to the users command
+func setupUsersImportCommand(usersCmd *cobra.Command) {
+	importCmd := &cobra.Command{
+		Use:   "import [CSV_FILE]",
+		Short: "Create users in bulk from a CSV file",
+		Long: `Create one user per row of a CSV file.
+
+The header row names the user properties. userPrincipalName and displayName are required.
+Optional columns:
+  mailNickname                    Defaults to the part of the UPN before @
+  password                        Generated when empty
+  forceChangePasswordNextSignIn   true (default) or false
+  accountEnabled                  true (default) or false
+  manager                         UPN or object ID of the manager, who may be imported in the same file
+Any other column, such as usageLocation, department or jobTitle, is set as the property it names.
+businessPhones and otherMails take several values separated by semicolons.
+
+Users are created in JSON batches of 20, --concurrency batches at a time. A results CSV with each row's status, the new object IDs and any
+generated passwords is written next to the input file (or to --results). The file must not exist
+yet, so the passwords of an earlier import are never overwritten. Keep it safe: it is readable only by
+you, and should be deleted once the passwords have been handed out.`,
+		Example: `  gua users import new-starters.csv
+  gua users import new-starters.csv --concurrency 8 --results created.csv`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			concurrency, _ := cmd.Flags().GetInt("concurrency")
+			resultsPath, _ := cmd.Flags().GetString("results")
+			policy, err := passwordPolicy(cmd)
+			if err != nil {
+				return err
+			}
+			if concurrency < 1 {
+				return fmt.Errorf("--concurrency must be at least 1")
+			}
+			if resultsPath == "" {
+				resultsPath = strings.TrimSuffix(args[0], filepath.Ext(args[0])) + "-results.csv"
+			}
+			// Checked before any user is created, so the new passwords always have somewhere to go
+			if _, err := os.Lstat(resultsPath); err == nil && !dryRun {
+				return fmt.Errorf("results file %s already exists: move it away or choose another path with --results", resultsPath)
+			}
+
+			file, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open import file: %w", err)
+			}
+			rows, err := users.ReadImportFile(file)
+			file.Close()
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", args[0], err)
+			}
+			if len(rows) == 0 {
+				return fmt.Errorf("%s contains no users", args[0])
+			}
+
+			results, err := importUsers(rows, concurrency, policy)
+			if err != nil {
+				return err
+			}
+
+			// A dry run created nothing, so there are no results or passwords to keep; only invalid rows are reported
+			if dryRun {
+				invalid := 0
+				for _, result := range results {
+					if result.Status == importFailed {
+						statusf("✗ Line %d (%s): %s\n", result.Line, result.UserPrincipalName, result.Error)
+						invalid++
+					}
+				}
+				if invalid > 0 {
+					return fmt.Errorf("%d of %d rows cannot be imported", invalid, len(results))
+				}
+				return nil
+			}
+
+			if err := writeImportResults(resultsPath, results); err != nil {
+				return err
+			}
+
+			created, incomplete := 0, 0
+			for _, result := range results {
+				if result.Status != importFailed {
+					created++
+				}
+				if result.Status != importCreated {
+					incomplete++
+				}
+			}
+
+			if err := printer.List(results, importResultColumns); err != nil {
+				return err
+			}
+			statusf("\n✓ Created %d of %d users. Results written to %s\n", created, len(results), resultsPath)
+
+			if incomplete > 0 {
+				return fmt.Errorf("%d of %d rows were not fully imported; see %s", incomplete, len(results), resultsPath)
+			}
+			return nil
+		},
+	}
+	importCmd.Flags().Int("concurrency", 4, "Number of batches of 20 users created at the same time")
+	importCmd.Flags().String("results", "", "Path of the results CSV (default: <CSV_FILE>-results.csv)")
+	addPasswordPolicyFlags(importCmd)
+
+	usersCmd.AddCommand(importCmd)
+}
+
+// importUsers creates the users and then assigns their managers, so managers can be imported
+// in the same file. It returns one result per row in file order.
+func importUsers(rows []users.ImportRow, concurrency int, policy password.Policy) ([]importResult, error) {
+	results := make([]importResult, len(rows))
+	for i, row := range rows {
+		results[i] = importResult{Line: row.Line, UserPrincipalName: row.Request.UserPrincipalName}
+		if row.Err != nil {
+			results[i].Status = importFailed
+			results[i].Error = row.Err.Error()
+			continue
+		}
+		if row.Request.PasswordProfile.Password == "" {
+			generated, err := policy.Generate()
+			if err != nil {
+				return nil, err
+			}
+			rows[i].Request.PasswordProfile.Password = generated
+			results[i].Password = generated
+		}
+	}
+
+	// Valid rows are created in JSON batches, several batches at a time
+	var pending []int
+	for i, result := range results {
+		if result.Status != importFailed {
+			pending = append(pending, i)
+		}
+	}
+	batches := (len(pending) + graph.MaxBatchSize - 1) / graph.MaxBatchSize
+
+	statusf("Creating %d users in %d batch(es), %d at a time...\n", len(pending), batches, concurrency)
+	runConcurrently(batches, concurrency, func(b int) {
+		batch := pending[b*graph.MaxBatchSize : min((b+1)*graph.MaxBatchSize, len(pending))]
+		createReqs := make([]users.CreateUserRequest, len(batch))
+		for j, i := range batch {
+			createReqs[j] = rows[i].Request
+		}
+
+		created, errs := users.CreateUsers(client, createReqs)
+		for j, i := range batch {
+			if errs[j] != nil {
+				results[i].Status = importFailed
+				results[i].Error = errs[j].Error()
+				results[i].Password = ""
+				continue
+			}
+			results[i].Status = importCreated
+			results[i].ID = created[j].ID
+			if dryRun {
+				// Nothing was created; later requests refer to the user by UPN instead
+				results[i].ID = rows[i].Request.UserPrincipalName
+			}
+		}
+	})
+
+	// Managers created by this import are resolved without another lookup
+	managerIDs := map[string]string{}
+	for _, result := range results {
+		if result.Status == importCreated {
+			managerIDs[strings.ToLower(result.UserPrincipalName)] = result.ID
+			managerIDs[strings.ToLower(result.ID)] = result.ID
+		}
+	}
+	var lookups []string
+	for i, result := range results {
+		manager := strings.ToLower(rows[i].Manager)
+		if _, known := managerIDs[manager]; manager != "" && !known && result.Status == importCreated {
+			managerIDs[manager] = ""
+			lookups = append(lookups, manager)
+		}
+	}
+	ids, lookupErrs := users.GetUserIDs(client, lookups)
+	// A manager that doesn't exist is reported as not found; any other lookup failure as it is
+	managerErrs := map[string]error{}
+	for j, manager := range lookups {
+		managerIDs[manager] = ids[j]
+		var graphErr *graph.GraphError
+		if lookupErrs[j] != nil && !(errors.As(lookupErrs[j], &graphErr) && graphErr.Kind() == graph.KindNotFound) {
+			managerErrs[manager] = lookupErrs[j]
+		}
+	}
+
+	var assignments []users.ManagerAssignment
+	var assigned []int
+	for i, result := range results {
+		manager := rows[i].Manager
+		if manager == "" || result.Status != importCreated {
+			continue
+		}
+		managerID := managerIDs[strings.ToLower(manager)]
+		if managerID == "" {
+			results[i].Status = importPartial
+			if err := managerErrs[strings.ToLower(manager)]; err != nil {
+				results[i].Error = fmt.Sprintf("manager %s: %v", manager, err)
+			} else {
+				results[i].Error = fmt.Sprintf("manager %s not found", manager)
+			}
+			continue
+		}
+		assignments = append(assignments, users.ManagerAssignment{User: result.ID, ManagerID: managerID})
+		assigned = append(assigned, i)
+	}
+
+	errs := users.SetManagers(client, assignments)
+	for j, i := range assigned {
+		if errs[j] != nil {
+			results[i].Status = importPartial
+			results[i].Error = errs[j].Error()
+		}
+	}
+
+	return results, nil
+}
+
+// runConcurrently calls fn for every index in [0, n), at most limit at a time
+func runConcurrently(n, limit int, fn func(i int)) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, limit)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// writeImportResults writes the results CSV, including generated passwords, readable only by the current user
+func writeImportResults(path string, results []importResult) error {
+	file, err := fileutil.CreateExclusive(path, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"line", "userPrincipalName", "status", "id", "password", "error"})
+	for _, result := range results {
+		writer.Write([]string{strconv.Itoa(result.Line), result.UserPrincipalName, result.Status, result.ID, result.Password, result.Error})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// importFile is a CSV of 23 valid rows, so they are created in two batches, and one invalid row.
+// boss is created by the same import, existing@contoso.com already exists, gone@contoso.com
+// does not, looking up hidden@contoso.com is forbidden, and creating eve fails.
+func importFile(t *testing.T) string {
+	t.Helper()
+
+	lines := []string{
+		"userPrincipalName,displayName,manager",
+		"boss@contoso.com,Boss,",
+		"alice@contoso.com,Alice,BOSS@contoso.com",
+		"bob@contoso.com,Bob,existing@contoso.com",
+		"carol@contoso.com,Carol,gone@contoso.com",
+		"dave@contoso.com,Dave,hidden@contoso.com",
+		"eve@contoso.com,Eve,evesboss@contoso.com",
+		"nameless@contoso.com,,",
+	}
+	for i := 1; i <= 17; i++ {
+		lines = append(lines, fmt.Sprintf("user%02d@contoso.com,User %d,", i, i))
+	}
+
+	path := filepath.Join(t.TempDir(), "new-starters.csv")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestImportUsers(t *testing.T) {
+	path := importFile(t)
+
+	// The first user of each batch waits for the other batch, so the test fails unless both run at once
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	concurrent := true
+
+	var mu sync.Mutex
+	managers := map[string]string{}
+
+	g := newFakeGraphWithBody(t, func(method, path string, body []byte) (int, string) {
+		switch {
+		case method == http.MethodPost && path == "/users":
+			var user struct {
+				UserPrincipalName string `json:"userPrincipalName"`
+			}
+			if err := json.Unmarshal(body, &user); err != nil {
+				t.Errorf("failed to decode create request: %v", err)
+			}
+			name := strings.Split(user.UserPrincipalName, "@")[0]
+			if name == "boss" || name == "user15" {
+				barrier.Done()
+				waited := make(chan struct{})
+				go func() { barrier.Wait(); close(waited) }()
+				select {
+				case <-waited:
+				case <-time.After(5 * time.Second):
+					mu.Lock()
+					concurrent = false
+					mu.Unlock()
+				}
+			}
+			if name == "eve" {
+				return http.StatusBadRequest, `{"error":{"code":"Request_BadRequest","message":"The domain portion of the userPrincipalName property is invalid."}}`
+			}
+			return http.StatusCreated, fmt.Sprintf(`{"id":"id-%s","userPrincipalName":%q}`, name, user.UserPrincipalName)
+		case method == http.MethodGet && path == "/users/existing@contoso.com":
+			return http.StatusOK, `{"id":"id-existing"}`
+		case method == http.MethodGet && path == "/users/hidden@contoso.com":
+			return http.StatusForbidden, `{"error":{"code":"Authorization_RequestDenied","message":"Insufficient privileges to complete the operation."}}`
+		case method == http.MethodPut && strings.HasSuffix(path, "/manager/$ref"):
+			var ref struct {
+				ID string `json:"@odata.id"`
+			}
+			if err := json.Unmarshal(body, &ref); err != nil {
+				t.Errorf("failed to decode manager reference: %v", err)
+			}
+			mu.Lock()
+			managers[strings.Split(path, "/")[2]] = ref.ID[strings.LastIndex(ref.ID, "/")+1:]
+			mu.Unlock()
+			return http.StatusNoContent, ""
+		}
+		return http.StatusNotFound, `{"error":{"code":"Request_ResourceNotFound","message":"Resource does not exist."}}`
+	})
+
+	_, stderr, err := runCommand(t, g, "users", "import", path, "--concurrency", "2")
+	if err == nil || !strings.Contains(err.Error(), "4 of 24 rows were not fully imported") {
+		t.Fatalf("error is %v, want 4 of 24 rows reported\n%s", err, stderr)
+	}
+	if !concurrent {
+		t.Error("the two batches were not created concurrently")
+	}
+
+	resultsPath := strings.TrimSuffix(path, ".csv") + "-results.csv"
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(resultsPath); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("results file is %v (%v), want mode 0600", info, err)
+		}
+	}
+	file, err := os.Open(resultsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 25 || strings.Join(records[0], ",") != "line,userPrincipalName,status,id,password,error" {
+		t.Fatalf("results file has %d records, header %q", len(records), records[0])
+	}
+
+	results := map[string][]string{}
+	for _, record := range records[1:] {
+		results[strings.Split(record[1], "@")[0]] = record
+	}
+	tests := []struct {
+		user, status, id, error string
+		password                bool
+	}{
+		{"boss", "created", "id-boss", "", true},
+		{"alice", "created", "id-alice", "", true},
+		{"bob", "created", "id-bob", "", true},
+		{"carol", "partial", "id-carol", "manager gone@contoso.com not found", true},
+		{"dave", "partial", "id-dave", "manager hidden@contoso.com: failed to get user: Authorization_RequestDenied", true},
+		{"eve", "failed", "", "The domain portion", false},
+		{"nameless", "failed", "", "displayName is empty", false},
+		{"user17", "created", "id-user17", "", true},
+	}
+	for _, test := range tests {
+		record := results[test.user]
+		if record == nil {
+			t.Errorf("no result for %s", test.user)
+			continue
+		}
+		if record[2] != test.status || record[3] != test.id || (record[4] != "") != test.password ||
+			(test.error == "") != (record[5] == "") || !strings.Contains(record[5], test.error) {
+			t.Errorf("result for %s is %q, want %s, %q, password %v, error %q", test.user, record, test.status, test.id, test.password, test.error)
+		}
+	}
+
+	// A manager created by the import is assigned without a lookup, and eve, who was not
+	// created, gets no manager step at all
+	want := map[string]string{"id-alice": "id-boss", "id-bob": "id-existing"}
+	if fmt.Sprint(managers) != fmt.Sprint(want) {
+		t.Errorf("assigned managers %v, want %v", managers, want)
+	}
+	var lookups []string
+	for _, request := range g.requests {
+		if strings.HasPrefix(request, "GET ") {
+			lookups = append(lookups, request)
+		}
+	}
+	if got := strings.Join(lookups, ","); got != "GET /users/existing@contoso.com,GET /users/gone@contoso.com,GET /users/hidden@contoso.com" {
+		t.Errorf("manager lookups are %s", got)
+	}
+	if created := strings.Count(strings.Join(g.sent(), ","), "POST /users"); created != 23 {
+		t.Errorf("sent %d create requests, want 23", created)
+	}
+}
+
+func TestImportUsersKeepsExistingResults(t *testing.T) {
+	path := importFile(t)
+	resultsPath := strings.TrimSuffix(path, ".csv") + "-results.csv"
+	if err := os.WriteFile(resultsPath, []byte("passwords of an earlier import"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	g := newFakeGraph(t, leaver)
+	if _, _, err := runCommand(t, g, "users", "import", path); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("error is %v, want one about the existing results file", err)
+	}
+	if sent := g.sent(); len(sent) != 0 {
+		t.Errorf("sent %q", sent)
+	}
+}
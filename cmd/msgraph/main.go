@@ -3,73 +3,241 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"GraphUserAdmin/internal/auth"
+	"GraphUserAdmin/internal/cloud"
 	"GraphUserAdmin/internal/config"
+	"GraphUserAdmin/internal/graph"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	configPath string
-	cfg        *config.Config
-	token      string
-	version    = "1.0.0"
-	buildDate  = "unknown"
-	verbose    bool
+	configPath  string
+	profileName string
+	cfg         *config.Config
+	environment cloud.Environment
+	client      *graph.Client
+	version     = "1.0.0"
+	buildDate   = "unknown"
+	verbose     bool
+
+	maxRetries   int
+	maxRetryWait time.Duration
 )
 
 func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		printError(err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// newRootCmd creates the gua command with all of its subcommands
+func newRootCmd() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "gua",
 		Short: "GraphUserAdmin - Microsoft 365 User & License Management using Microsoft Graph API",
 		Long: `GraphUserAdmin (gua) is a command-line tool for managing Microsoft 365 users, licenses, and groups
-using the Microsoft Graph REST API with client credentials authentication.`,
+using the Microsoft Graph REST API with client credentials or delegated (device code) authentication.`,
 		Version: version,
+		// Errors are rendered by printError so Graph details and exit codes stay consistent
+		SilenceErrors: true,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Arguments are valid at this point; failures from here on are not usage errors
+			cmd.SilenceUsage = true
+
 			// Skip authentication for help command
 			if cmd.Name() == "help" {
 				return nil
 			}
 
+			// Profile management works on the config file directly
+			if cmd.Annotations[skipConfigAnnotation] == "true" {
+				return setupPrinter(cmd)
+			}
+
 			// Load configuration
 			var err error
-			cfg, err = config.LoadConfig(configPath)
+			cfg, err = config.LoadConfig(configPath, profileName)
 			if err != nil {
 				return fmt.Errorf("failed to load config: %w", err)
 			}
 
-			// Authenticate
-			if verbose {
-				fmt.Println("Authenticating with Microsoft Graph...")
-				fmt.Printf("Tenant ID: %s\n", cfg.TenantID)
-				fmt.Printf("Client ID: %s\n", cfg.ClientID)
-			} else {
-				fmt.Println("Authenticating with Microsoft Graph...")
+			if err := setupPrinter(cmd); err != nil {
+				return err
+			}
+
+			// The profile's cloud selects both the token authority and the Graph endpoint
+			environment, err = cloud.Lookup(cfg.Cloud)
+			if err != nil {
+				return err
+			}
+			auth.AuthorityHost = environment.AuthorityHost
+			auth.GraphResource = environment.GraphEndpoint
+
+			// Commands such as 'login' authenticate on their own
+			if cmd.Annotations[skipAuthAnnotation] == "true" {
+				return nil
 			}
-			token, err = auth.GetAccessToken(cfg.TenantID, cfg.ClientID, cfg.ClientSecret)
+
+			retry, err := retryPolicy(cmd)
+			if err != nil {
+				return err
+			}
+
+			tokens, err := newTokenSource()
 			if err != nil {
+				return err
+			}
+			// Fail fast on bad credentials rather than on the first Graph request
+			if _, err := tokens.Token(); err != nil {
 				return fmt.Errorf("authentication failed: %w", err)
 			}
+
+			client = graph.NewClient(tokens)
+			client.BaseURL = environment.GraphBaseURL()
+			client.UserAgent = "GraphUserAdmin/" + version
+			client.Retry = retry
+			if dryRun {
+				client.DryRun = printPlannedRequest
+			}
+			auditTo, err := auditLog()
+			if err != nil {
+				return err
+			}
+			if auditTo != nil {
+				client.Observe = auditRecorder(cmd, auditTo)
+			}
 			if verbose {
-				fmt.Println("✓ Authentication successful!")
-				fmt.Printf("Token length: %d characters\n", len(token))
-			} else {
-				fmt.Println("✓ Authentication successful!")
+				client.Logf = func(format string, args ...interface{}) {
+					fmt.Fprintf(os.Stderr, format+"\n", args...)
+				}
 			}
-			fmt.Println()
 
 			return nil
 		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			if dryRun && client != nil {
+				printDryRunSummary()
+			}
+		},
 	}
 
 	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "config.json", "Path to configuration file")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "", "Output format: table, json, jsonl, csv or yaml (default: the profile's output setting, else table)")
+	rootCmd.PersistentFlags().StringVarP(&profileName, "profile", "p", "", "Configuration profile to use (default: GUA_PROFILE or the config file's default profile)")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Show the requests that would change data without sending them")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output for debugging")
+	rootCmd.PersistentFlags().IntVar(&maxRetries, "max-retries", graph.DefaultRetryPolicy.MaxRetries, "Retries for throttled (429) or unavailable (503/504) requests; overrides maxRetries in config")
+	rootCmd.PersistentFlags().DurationVar(&maxRetryWait, "max-retry-wait", graph.DefaultRetryPolicy.MaxWait, "Longest single wait between retries (must be above 0); overrides maxRetryWaitSeconds in config")
 
 	// Setup all commands (users, licenses, groups)
 	setupCommands(rootCmd)
 
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+	return rootCmd
+}
+
+const (
+	// skipAuthAnnotation marks commands that must run without a Graph access token
+	skipAuthAnnotation = "gua/skip-auth"
+	// skipConfigAnnotation marks commands that must run without loading a profile
+	skipConfigAnnotation = "gua/skip-config"
+)
+
+// newTokenSource returns the cached token source for the configured credential.
+// Tokens are reused across invocations until shortly before they expire.
+func newTokenSource() (*auth.CachedTokenSource, error) {
+	cache, err := tokenCache()
+	if err != nil {
+		return nil, err
+	}
+
+	source := &auth.CachedTokenSource{
+		Cache:    cache,
+		TenantID: cfg.TenantID,
+		ClientID: cfg.ClientID,
+		Scope:    auth.GraphScope(),
+		Fetch:    acquireToken,
+	}
+
+	// Delegated tokens come from 'gua login' and are renewed with their refresh token
+	if cfg.Credential() == config.CredentialDelegated {
+		source.Scope = auth.DelegatedScope()
+		source.Fetch = nil
+	}
+
+	return source, nil
+}
+
+// acquireToken authenticates as the application with a certificate when one is configured,
+// otherwise with the client secret
+func acquireToken() (*auth.Token, error) {
+	if verbose {
+		statusf("Authenticating with Microsoft Graph...\n")
+		statusf("Tenant ID: %s\n", cfg.TenantID)
+		statusf("Client ID: %s\n", cfg.ClientID)
+		statusf("Cloud:     %s (%s)\n", environment.Name, environment.GraphEndpoint)
+	} else {
+		statusf("Authenticating with Microsoft Graph...\n")
+	}
+
+	if err := cfg.ResolveSecret(); err != nil {
+		return nil, err
+	}
+
+	var token *auth.Token
+	var err error
+	if cfg.Credential() == config.CredentialCertificate {
+		var cert *auth.Certificate
+		cert, err = auth.LoadCertificate(cfg.CertificatePath, cfg.CertificatePassword, cfg.CertificateThumbprint)
+		if err != nil {
+			return nil, err
+		}
+		token, err = auth.GetAccessTokenWithCertificate(cfg.TenantID, cfg.ClientID, cert)
+	} else {
+		token, err = auth.GetAccessToken(cfg.TenantID, cfg.ClientID, cfg.ClientSecret)
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	if verbose {
+		statusf("✓ Authentication successful!\n")
+		statusf("Token length: %d characters\n", len(token.AccessToken))
+		statusf("Token expires: %s\n", token.ExpiresAt.Local().Format(time.RFC1123))
+	} else {
+		statusf("✓ Authentication successful!\n")
+	}
+	statusf("\n")
+
+	return token, nil
+}
+
+// retryPolicy combines the defaults, config.json and command-line flags (highest precedence)
+func retryPolicy(cmd *cobra.Command) (graph.RetryPolicy, error) {
+	policy := graph.DefaultRetryPolicy
+
+	if cfg.MaxRetries != nil {
+		policy.MaxRetries = *cfg.MaxRetries
+	}
+	if cfg.MaxRetryWaitSeconds > 0 {
+		policy.MaxWait = time.Duration(cfg.MaxRetryWaitSeconds) * time.Second
+	}
+
+	if cmd.Flags().Changed("max-retries") {
+		if maxRetries < 0 {
+			return policy, fmt.Errorf("--max-retries must not be negative")
+		}
+		policy.MaxRetries = maxRetries
+	}
+	if cmd.Flags().Changed("max-retry-wait") {
+		if maxRetryWait <= 0 {
+			return policy, fmt.Errorf("--max-retry-wait must be longer than 0, e.g. 30s")
+		}
+		policy.MaxWait = maxRetryWait
+	}
+
+	return policy, nil
 }
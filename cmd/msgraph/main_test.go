@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"GraphUserAdmin/internal/config"
+	"GraphUserAdmin/internal/graph"
+
+	"github.com/spf13/cobra"
+)
+
+// fakeGraph is a Graph endpoint for command tests. respond answers each request, including each
+// request of a $batch call, by method and path; the requests are recorded in order, and the query
+// of the last request outside a batch by method and path.
+type fakeGraph struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []string
+	queries  map[string]url.Values
+	respond  func(method, path string, body []byte) (int, string)
+}
+
+func newFakeGraph(t *testing.T, respond func(method, path string) (int, string)) *fakeGraph {
+	return newFakeGraphWithBody(t, func(method, path string, body []byte) (int, string) {
+		return respond(method, path)
+	})
+}
+
+// newFakeGraphWithBody is newFakeGraph for tests that answer by request body, too
+func newFakeGraphWithBody(t *testing.T, respond func(method, path string, body []byte) (int, string)) *fakeGraph {
+	g := &fakeGraph{respond: respond, queries: map[string]url.Values{}}
+	g.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v1.0")
+		if r.Method != http.MethodPost || path != "/$batch" {
+			g.mu.Lock()
+			g.queries[r.Method+" "+path] = r.URL.Query()
+			g.mu.Unlock()
+			requestBody, _ := io.ReadAll(r.Body)
+			status, body := g.answer(r.Method, path, requestBody)
+			w.WriteHeader(status)
+			io.WriteString(w, body)
+			return
+		}
+
+		var batch struct {
+			Requests []struct {
+				ID     string          `json:"id"`
+				Method string          `json:"method"`
+				URL    string          `json:"url"`
+				Body   json.RawMessage `json:"body"`
+			} `json:"requests"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Errorf("failed to decode batch: %v", err)
+		}
+		var result struct {
+			Responses []map[string]interface{} `json:"responses"`
+		}
+		for _, request := range batch.Requests {
+			status, body := g.answer(request.Method, strings.SplitN(request.URL, "?", 2)[0], request.Body)
+			response := map[string]interface{}{"id": request.ID, "status": status}
+			if body != "" {
+				response["body"] = json.RawMessage(body)
+			}
+			result.Responses = append(result.Responses, response)
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	t.Cleanup(g.Close)
+	return g
+}
+
+func (g *fakeGraph) answer(method, path string, body []byte) (int, string) {
+	g.mu.Lock()
+	g.requests = append(g.requests, method+" "+path)
+	g.mu.Unlock()
+	return g.respond(method, path, body)
+}
+
+// query returns the query of the last request sent with method and path, as "GET /users"
+func (g *fakeGraph) query(request string) url.Values {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.queries[request]
+}
+
+// sent returns the recorded requests that change data
+func (g *fakeGraph) sent() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var changes []string
+	for _, request := range g.requests {
+		if !strings.HasPrefix(request, http.MethodGet+" ") {
+			changes = append(changes, request)
+		}
+	}
+	return changes
+}
+
+// runCommand runs gua with args against the fake Graph, skipping the profile and sign-in, and
+// returns what was written to stdout and stderr
+func runCommand(t *testing.T, g *fakeGraph, args ...string) (stdout, stderr string, err error) {
+	t.Helper()
+
+	root := newRootCmd()
+	root.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg = nil
+		if err := setupPrinter(cmd); err != nil {
+			return err
+		}
+		client = graph.NewClient(graph.StaticToken("test-token"))
+		client.BaseURL = g.URL + "/v1.0"
+		client.HTTPClient = g.Client()
+		client.Retry = graph.RetryPolicy{}
+		if dryRun {
+			client.DryRun = printPlannedRequest
+		}
+		return nil
+	}
+	root.SetArgs(args)
+	planned.count = 0
+
+	// Capture the real stdout and stderr, so output written around the printer is caught too
+	outFile, errFile := captureFile(t), captureFile(t)
+	savedOut, savedErr, savedPrinterOut := os.Stdout, os.Stderr, printer.Out
+	os.Stdout, os.Stderr, printer.Out = outFile, errFile, outFile
+	defer func() { os.Stdout, os.Stderr, printer.Out = savedOut, savedErr, savedPrinterOut }()
+
+	err = root.Execute()
+	return readCapture(t, outFile), readCapture(t, errFile), err
+}
+
+func captureFile(t *testing.T) *os.File {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func readCapture(t *testing.T, f *os.File) string {
+	t.Helper()
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRetryPolicyFlags(t *testing.T) {
+	maxRetries := 2
+	cfg = &config.Config{MaxRetries: &maxRetries, MaxRetryWaitSeconds: 20}
+	defer func() { cfg = nil }()
+
+	tests := []struct {
+		args    []string
+		want    graph.RetryPolicy
+		wantErr string
+	}{
+		{nil, graph.RetryPolicy{MaxRetries: 2, MaxWait: 20 * time.Second}, ""},
+		{[]string{"--max-retries", "7", "--max-retry-wait", "2m"}, graph.RetryPolicy{MaxRetries: 7, MaxWait: 2 * time.Minute}, ""},
+		{[]string{"--max-retries", "0"}, graph.RetryPolicy{MaxRetries: 0, MaxWait: 20 * time.Second}, ""},
+		{[]string{"--max-retries", "-1"}, graph.RetryPolicy{}, "--max-retries"},
+		{[]string{"--max-retry-wait", "0"}, graph.RetryPolicy{}, "--max-retry-wait"},
+		{[]string{"--max-retry-wait", "-5s"}, graph.RetryPolicy{}, "--max-retry-wait"},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			root := newRootCmd()
+			if err := root.ParseFlags(test.args); err != nil {
+				t.Fatal(err)
+			}
+
+			policy, err := retryPolicy(root)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("error is %v, want one about %s", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil || policy != test.want {
+				t.Errorf("policy is %+v (%v), want %+v", policy, err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"GraphUserAdmin/internal/output"
+	"GraphUserAdmin/internal/users"
+
+	"github.com/spf13/cobra"
+)
+
+var reportColumns = []output.Column{
+	{Header: "Display Name", Field: "displayName"},
+	{Header: "User Principal Name", Field: "userPrincipalName"},
+	{Header: "Job Title", Field: "jobTitle"},
+	{Header: "Account Enabled", Field: "accountEnabled"},
+}
+
+// reportRow is one user of a reporting tree in CSV output
+type reportRow struct {
+	Level             int    `json:"level"`
+	DisplayName       string `json:"displayName"`
+	UserPrincipalName string `json:"userPrincipalName"`
+	JobTitle          string `json:"jobTitle"`
+	Manager           string `json:"manager"`
+}
+
+var reportRowColumns = []output.Column{
+	{Header: "Level", Field: "level"},
+	{Header: "Display Name", Field: "displayName"},
+	{Header: "User Principal Name", Field: "userPrincipalName"},
+	{Header: "Job Title", Field: "jobTitle"},
+	{Header: "Manager", Field: "manager"},
+}
+
+// setupUsersManagerCommands creates the users manager and users reports commands
+func setupUsersManagerCommands(usersCmd *cobra.Command) {
+	managerCmd := &cobra.Command{
+		Use:   "manager",
+		Short: "Show or change a user's manager",
+	}
+
+	managerGetCmd := &cobra.Command{
+		Use:   "get [UPN]",
+		Short: "Show a user's manager",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := users.GetManager(client, args[0])
+			if err != nil {
+				return err
+			}
+
+			if manager == nil && printer.Format == output.Table {
+				fmt.Printf("%s has no manager.\n", args[0])
+				return nil
+			}
+
+			return printer.Object(manager, []output.Column{
+				{Header: "ID", Field: "id"},
+				{Header: "Display Name", Field: "displayName"},
+				{Header: "User Principal Name", Field: "userPrincipalName"},
+				{Header: "Job Title", Field: "jobTitle"},
+				{Header: "Mail", Field: "mail"},
+			})
+		},
+	}
+
+	managerSetCmd := &cobra.Command{
+		Use:     "set [UPN] [MANAGER_UPN]",
+		Short:   "Set a user's manager",
+		Example: "  gua users manager set jdoe@example.com lead@example.com",
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			upn := args[0]
+
+			manager, err := users.GetUser(client, args[1])
+			if err != nil {
+				return fmt.Errorf("failed to get manager: %w", err)
+			}
+			if err := checkUser(upn); err != nil {
+				return err
+			}
+
+			if err := users.SetManager(client, upn, manager.ID); err != nil {
+				return err
+			}
+
+			successf("✓ Successfully set the manager of %s to %s\n", upn, manager.UserPrincipalName)
+			return nil
+		},
+	}
+
+	managerRemoveCmd := &cobra.Command{
+		Use:   "remove [UPN]",
+		Short: "Remove a user's manager",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			upn := args[0]
+			if err := checkUser(upn); err != nil {
+				return err
+			}
+
+			if err := users.RemoveManager(client, upn); err != nil {
+				return err
+			}
+
+			successf("✓ Successfully removed the manager of %s\n", upn)
+			return nil
+		},
+	}
+
+	var recursive bool
+	reportsCmd := &cobra.Command{
+		Use:   "reports [UPN]",
+		Short: "Show the people who report to a user",
+		Long: `Show a user's direct reports. With --recursive the whole reporting chain below the user is walked
+and shown as a tree; JSON and YAML output nest each user's reports under them, and CSV output has
+one row per user with their level and manager.`,
+		Example: `  gua users reports lead@example.com
+  gua users reports ceo@example.com --recursive
+  gua users reports ceo@example.com --recursive -o json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			upn := args[0]
+
+			if !recursive {
+				reports, err := users.GetDirectReports(client, upn)
+				if err != nil {
+					return err
+				}
+
+				if len(reports) == 0 && printer.Format == output.Table {
+					fmt.Printf("%s has no direct reports.\n", upn)
+					return nil
+				}
+
+				return printer.List(reports, reportColumns)
+			}
+
+			tree, err := users.GetReportingTree(client, upn)
+			if err != nil {
+				return err
+			}
+
+			switch printer.Format {
+			case output.Table:
+				printReportTree(printer.Out, tree, "", "")
+				statusf("\n%d people report to %s, %d of them directly\n", countReports(tree), upn, len(tree.Reports))
+				return nil
+			case output.CSV:
+				return printer.List(flattenReportTree(tree, 0, "", nil), reportRowColumns)
+			default:
+				return printer.Object(tree, nil)
+			}
+		},
+	}
+	reportsCmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Walk the full reporting chain and show it as a tree")
+
+	managerCmd.AddCommand(managerGetCmd, managerSetCmd, managerRemoveCmd)
+	usersCmd.AddCommand(managerCmd, reportsCmd)
+}
+
+// printReportTree draws the node and everyone below it, one user per line
+func printReportTree(w io.Writer, node *users.ReportNode, prefix, childPrefix string) {
+	line := fmt.Sprintf("%s (%s)", node.DisplayName, node.UserPrincipalName)
+	if node.JobTitle != "" {
+		line += " - " + node.JobTitle
+	}
+	if !node.AccountEnabled {
+		line += " [disabled]"
+	}
+	fmt.Fprintln(w, prefix+line)
+
+	for i, report := range node.Reports {
+		if i == len(node.Reports)-1 {
+			printReportTree(w, report, childPrefix+"└── ", childPrefix+"    ")
+		} else {
+			printReportTree(w, report, childPrefix+"├── ", childPrefix+"│   ")
+		}
+	}
+}
+
+// flattenReportTree lists the node and everyone below it in tree order
+func flattenReportTree(node *users.ReportNode, level int, manager string, rows []reportRow) []reportRow {
+	rows = append(rows, reportRow{
+		Level:             level,
+		DisplayName:       node.DisplayName,
+		UserPrincipalName: node.UserPrincipalName,
+		JobTitle:          node.JobTitle,
+		Manager:           manager,
+	})
+	for _, report := range node.Reports {
+		rows = flattenReportTree(report, level+1, node.UserPrincipalName, rows)
+	}
+	return rows
+}
+
+// countReports returns how many people are below the node in the tree
+func countReports(node *users.ReportNode) int {
+	count := len(node.Reports)
+	for _, report := range node.Reports {
+		count += countReports(report)
+	}
+	return count
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"GraphUserAdmin/internal/graph"
+	"GraphUserAdmin/internal/groups"
+	"GraphUserAdmin/internal/licenses"
+	"GraphUserAdmin/internal/offboard"
+	"GraphUserAdmin/internal/output"
+	"GraphUserAdmin/internal/users"
+
+	"github.com/spf13/cobra"
+)
+
+// offboardRow is one step of the offboarding report
+type offboardRow struct {
+	Step   string `json:"step"`
+	Status string `json:"status"`
+	Time   string `json:"time,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+var offboardColumns = []output.Column{
+	{Header: "Step", Field: "step"},
+	{Header: "Status", Field: "status"},
+	{Header: "Time", Field: "time"},
+	{Header: "Detail", Field: "detail"},
+	{Header: "Error", Field: "error"},
+}
+
+// setupUsersOffboardCommand creates the users offboard command
+func setupUsersOffboardCommand(usersCmd *cobra.Command) {
+	offboardCmd := &cobra.Command{
+		Use:   "offboard [UPN]",
+		Short: "Run the leaver procedure for a user",
+		Long: `Offboard a user in one go. The steps are, in order:
+
+  disable          block sign-in
+  revoke-sessions  sign the user out everywhere
+  licenses         remove directly assigned licenses
+  groups           remove the user from their groups (dynamic, on-premises and Exchange-managed
+                   groups are left alone)
+  hide-from-gal    always skipped: Graph can't hide a user, so the report says how to do it in
+                   Exchange Online
+  delete           delete the user, --delete-after days after they were disabled
+
+Progress is saved to a state file after every step. Running the command again skips the steps that
+are done and retries the ones that failed, so an interrupted run can simply be repeated. With
+--delete-after, run the command again once the waiting period is over to delete the user; the
+number of days is remembered. Licenses that come from groups go with the group memberships.`,
+		Example: `  gua users offboard jdoe@example.com --dry-run
+  gua users offboard jdoe@example.com --delete-after 30
+  gua users offboard jdoe@example.com --skip licenses`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			upn := args[0]
+			stateDir, _ := cmd.Flags().GetString("state-dir")
+			skipSteps, _ := cmd.Flags().GetStringSlice("skip")
+			restart, _ := cmd.Flags().GetBool("restart")
+
+			skip := map[string]bool{}
+			for _, step := range skipSteps {
+				if step == offboard.Delete || !containsString(offboard.Steps, step) {
+					return fmt.Errorf("unknown step %q for --skip: use %s", step, strings.Join(offboard.Steps[:len(offboard.Steps)-1], ", "))
+				}
+				skip[step] = true
+			}
+
+			if stateDir == "" {
+				var err error
+				if stateDir, err = offboard.DefaultDir(); err != nil {
+					return err
+				}
+			}
+			state, err := offboard.Load(stateDir, upn)
+			if err != nil {
+				return err
+			}
+			if restart {
+				state.Reset()
+			}
+
+			// The state file is named after the UPN, which may since have been given to someone else
+			user, err := users.GetUser(client, upn)
+			var graphErr *graph.GraphError
+			switch {
+			case err == nil && state.UserID != "" && !strings.EqualFold(state.UserID, user.ID):
+				statusf("⚠ The saved progress for %s belongs to an earlier user with this UPN (ID %s); starting over\n", upn, state.UserID)
+				state.Reset()
+			case err != nil && state.UserID != "" && errors.As(err, &graphErr) && graphErr.Kind() == graph.KindNotFound:
+				// Deleted or renamed since the last run; the saved ID still identifies the user
+			case err != nil:
+				return err
+			}
+			if state.UserID == "" {
+				state.UserID = user.ID
+				state.Started = time.Now().UTC()
+			}
+
+			if cmd.Flags().Changed("delete-after") {
+				days, _ := cmd.Flags().GetInt("delete-after")
+				if days < 0 {
+					return fmt.Errorf("--delete-after must not be negative")
+				}
+				state.DeleteAfterDays = &days
+			}
+
+			// Dry runs change nothing, so there is no progress to save
+			save := func() {
+				if dryRun {
+					return
+				}
+				if err := state.Save(); err != nil {
+					statusf("⚠ Warning: %v\n", err)
+				}
+			}
+			var pending []string
+			for _, step := range offboard.Steps {
+				if !state.Done(step) && !skip[step] && step != offboard.HideFromGAL && (step != offboard.Delete || state.DeleteAfterDays != nil) {
+					pending = append(pending, step)
+				}
+			}
+			if len(pending) > 0 {
+				warning := fmt.Sprintf("This will run these offboarding steps for %s: %s", upn, strings.Join(pending, ", "))
+				if ok, err := confirm(cmd, warning); !ok || err != nil {
+					return err
+				}
+			}
+			save()
+
+			rows, failed := runOffboarding(state, skip, save)
+
+			if err := printer.List(rows, offboardColumns); err != nil {
+				return err
+			}
+			if dryRun {
+				return nil
+			}
+
+			statusf("\nProgress is saved in %s\n", state.Path())
+			if failed > 0 {
+				return fmt.Errorf("offboarding %s is incomplete: %d step(s) failed; run the command again to retry them", upn, failed)
+			}
+			if due, ok := deletionDue(state); ok && !state.Done(offboard.Delete) {
+				statusf("✓ %s is offboarded. Run this command again on or after %s to delete the user.\n", upn, due.Local().Format("2006-01-02"))
+				return nil
+			}
+			statusf("✓ %s is offboarded\n", upn)
+			return nil
+		},
+	}
+	offboardCmd.Flags().Int("delete-after", 0, "Delete the user this many days after disabling them (0 deletes right away; default: never)")
+	offboardCmd.Flags().StringSlice("skip", nil, "Steps to leave out: disable, revoke-sessions, licenses, groups, hide-from-gal")
+	offboardCmd.Flags().String("state-dir", "", "Directory of offboarding state files (default: gua/offboard in your user config directory)")
+	offboardCmd.Flags().Bool("restart", false, "Forget the saved progress, including the --delete-after schedule, and run every step again")
+	addConfirmFlags(offboardCmd)
+
+	usersCmd.AddCommand(offboardCmd)
+}
+
+// runOffboarding runs the steps that are not done yet and returns the report and the number of
+// failed steps. save is called after every step that changed the state.
+func runOffboarding(state *offboard.State, skip map[string]bool, save func()) ([]offboardRow, int) {
+	steps := map[string]func(userID string) (string, error){
+		offboard.Disable:        offboardDisable,
+		offboard.RevokeSessions: offboardRevokeSessions,
+		offboard.Licenses:       offboardLicenses,
+		offboard.Groups:         offboardGroups,
+		offboard.Delete:         offboardDelete,
+	}
+
+	var rows []offboardRow
+	failed := 0
+	for _, step := range offboard.Steps {
+		row := offboardRow{Step: step}
+		switch {
+		case state.Done(step):
+			// Done in an earlier run
+		case skip[step]:
+			row.Status, row.Detail = offboard.Skipped, "left out with --skip"
+		case step == offboard.HideFromGAL:
+			// Graph doesn't support showInAddressList for users; the mailbox is hidden in Exchange
+			row.Status, row.Detail = offboard.Skipped, "hide the mailbox in Exchange Online (HiddenFromAddressListsEnabled)"
+		case step == offboard.Delete && !deletionReady(state, failed, &row):
+			// The row says why the user is not deleted yet
+		default:
+			detail, err := steps[step](state.UserID)
+			status := offboard.Done
+			if dryRun {
+				status = offboard.Planned
+			}
+			state.Record(step, status, detail, err)
+			save()
+		}
+
+		if recorded := state.Steps[step]; row.Status == "" && recorded != nil {
+			row.Status, row.Detail, row.Error = recorded.Status, recorded.Detail, recorded.Error
+			if recorded.Status != offboard.Planned {
+				row.Time = recorded.Time.Local().Format("2006-01-02 15:04")
+			}
+		}
+		if row.Status == offboard.Failed {
+			failed++
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, failed
+}
+
+// deletionReady reports whether the user can be deleted now: deletion was requested, every earlier
+// step is done or skipped, and the waiting period is over. Otherwise it fills in the report row.
+func deletionReady(state *offboard.State, failed int, row *offboardRow) bool {
+	if state.DeleteAfterDays == nil {
+		row.Status, row.Detail = offboard.Skipped, "not requested (use --delete-after)"
+		return false
+	}
+	if failed > 0 {
+		row.Status, row.Detail = offboard.Skipped, "waits for the failed steps"
+		return false
+	}
+	if due, _ := deletionDue(state); time.Now().Before(due) {
+		row.Status, row.Detail = offboard.Scheduled, "due "+due.Local().Format("2006-01-02")
+		return false
+	}
+	return true
+}
+
+// deletionDue returns when the user is to be deleted, counted from when they were disabled, or
+// from the first run when the disable step was skipped
+func deletionDue(state *offboard.State) (time.Time, bool) {
+	if state.DeleteAfterDays == nil {
+		return time.Time{}, false
+	}
+	disabled := state.Started
+	if recorded := state.Steps[offboard.Disable]; recorded != nil && recorded.Status == offboard.Done {
+		disabled = recorded.Time
+	}
+	return disabled.AddDate(0, 0, *state.DeleteAfterDays), true
+}
+
+func offboardDisable(userID string) (string, error) {
+	return "", users.UpdateUser(client, userID, map[string]interface{}{"accountEnabled": false})
+}
+
+func offboardRevokeSessions(userID string) (string, error) {
+	return "", users.RevokeSignInSessions(client, []string{userID})[0]
+}
+
+// offboardLicenses removes the direct license assignments. Licenses held through groups can only
+// be removed by leaving the group, which the groups step does.
+func offboardLicenses(userID string) (string, error) {
+	details, err := licenses.GetUserLicenses(client, userID)
+	if err != nil {
+		return "", err
+	}
+	states, err := licenses.GetLicenseAssignmentStates(client, userID)
+	if err != nil {
+		return "", err
+	}
+
+	names := map[string]string{}
+	for _, detail := range details {
+		names[strings.ToLower(detail.SkuID)] = detail.SkuPartNumber
+	}
+	name := func(skuID string) string {
+		if partNumber := names[strings.ToLower(skuID)]; partNumber != "" {
+			return partNumber
+		}
+		return skuID
+	}
+
+	var direct, fromGroups []string
+	directSeen := map[string]bool{}
+	for _, state := range states {
+		if state.AssignedByGroup == "" && !directSeen[state.SkuID] {
+			directSeen[state.SkuID] = true
+			direct = append(direct, state.SkuID)
+		}
+	}
+	for _, state := range states {
+		if state.AssignedByGroup != "" && !directSeen[state.SkuID] && !containsString(fromGroups, name(state.SkuID)) {
+			fromGroups = append(fromGroups, name(state.SkuID))
+		}
+	}
+
+	var parts []string
+	if len(direct) > 0 {
+		if err := licenses.AssignLicense(client, userID, []string{}, direct); err != nil {
+			return "", err
+		}
+		var removed []string
+		for _, skuID := range direct {
+			removed = append(removed, name(skuID))
+		}
+		parts = append(parts, "removed "+strings.Join(removed, ", "))
+	}
+	if len(fromGroups) > 0 {
+		parts = append(parts, "from groups: "+strings.Join(fromGroups, ", "))
+	}
+	if len(parts) == 0 {
+		return "no licenses", nil
+	}
+	return strings.Join(parts, "; "), nil
+}
+
+// offboardGroups removes the user from every group whose members are managed in the cloud by hand.
+// Distribution lists and mail-enabled security groups are managed in Exchange, so Graph can't
+// change their members; they are left alone like dynamic and on-premises groups.
+func offboardGroups(userID string) (string, error) {
+	groupList, err := groups.GetUserGroups(client, userID)
+	if err != nil {
+		return "", err
+	}
+
+	var removed, kept, exchange, failures []string
+	for _, group := range groupList {
+		if group.Dynamic() || group.OnPremisesSyncEnabled {
+			kept = append(kept, group.DisplayName)
+			continue
+		}
+		if group.MailEnabled && !group.Unified() {
+			exchange = append(exchange, group.DisplayName)
+			continue
+		}
+		if err := groups.RemoveMemberFromGroup(client, group.ID, userID); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", group.DisplayName, err))
+			continue
+		}
+		removed = append(removed, group.DisplayName)
+	}
+
+	var parts []string
+	if len(removed) > 0 {
+		parts = append(parts, "removed from "+strings.Join(removed, ", "))
+	}
+	if len(kept) > 0 {
+		parts = append(parts, "left in dynamic or on-premises groups: "+strings.Join(kept, ", "))
+	}
+	if len(exchange) > 0 {
+		parts = append(parts, "manage in Exchange: "+strings.Join(exchange, ", "))
+	}
+	detail := strings.Join(parts, "; ")
+	if len(groupList) == 0 {
+		detail = "no groups"
+	}
+
+	if len(failures) > 0 {
+		return detail, fmt.Errorf("failed to leave %d of %d groups: %s", len(failures), len(groupList), strings.Join(failures, "; "))
+	}
+	return detail, nil
+}
+
+func offboardDelete(userID string) (string, error) {
+	return fmt.Sprintf("restorable for %d days", users.RetentionDays), users.DeleteUser(client, userID)
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
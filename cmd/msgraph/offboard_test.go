@@ -0,0 +1,192 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"GraphUserAdmin/internal/offboard"
+)
+
+// allChanges are the requests a complete offboarding of jdoe@contoso.com (ID u1) sends
+var allChanges = []string{
+	"PATCH /users/u1",
+	"POST /users/u1/revokeSignInSessions",
+	"POST /users/u1/assignLicense",
+	"DELETE /groups/g1/members/u1/$ref",
+	"DELETE /users/u1",
+}
+
+func offboardArgs(stateDir string, extra ...string) []string {
+	return append([]string{"users", "offboard", "jdoe@contoso.com", "--yes", "--state-dir", stateDir, "--delete-after", "0"}, extra...)
+}
+
+func loadState(t *testing.T, stateDir string) *offboard.State {
+	t.Helper()
+	state, err := offboard.Load(stateDir, "jdoe@contoso.com")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return state
+}
+
+func TestOffboardResumesAfterFailure(t *testing.T) {
+	stateDir := t.TempDir()
+
+	var groupsDown int32 = 1
+	g := newFakeGraph(t, func(method, path string) (int, string) {
+		if method == http.MethodDelete && strings.HasPrefix(path, "/groups/") && atomic.LoadInt32(&groupsDown) == 1 {
+			return http.StatusForbidden, `{"error":{"code":"Authorization_RequestDenied","message":"Insufficient privileges."}}`
+		}
+		return leaver(method, path)
+	})
+
+	_, stderr, err := runCommand(t, g, offboardArgs(stateDir)...)
+	if err == nil || !strings.Contains(err.Error(), "1 step(s) failed") {
+		t.Fatalf("first run error is %v, want a failed step\n%s", err, stderr)
+	}
+	if sent := strings.Join(g.sent(), ","); sent != strings.Join(allChanges[:4], ",") {
+		t.Errorf("first run sent %s; the user must not be deleted after a failed step", sent)
+	}
+
+	state := loadState(t, stateDir)
+	if state.UserID != "u1" || !state.Done(offboard.Disable) || !state.Done(offboard.Licenses) || state.Steps[offboard.Groups].Status != offboard.Failed {
+		t.Fatalf("saved state is %+v", state)
+	}
+
+	// The second run retries the failed step and then deletes the user
+	atomic.StoreInt32(&groupsDown, 0)
+	g.requests = nil
+	if _, stderr, err := runCommand(t, g, offboardArgs(stateDir)...); err != nil {
+		t.Fatalf("second run: %v\n%s", err, stderr)
+	}
+	if sent := strings.Join(g.sent(), ","); sent != strings.Join(allChanges[3:], ",") {
+		t.Errorf("second run sent %s, want only the failed step and the deletion", sent)
+	}
+	if state := loadState(t, stateDir); !state.Done(offboard.Groups) || !state.Done(offboard.Delete) {
+		t.Errorf("saved state is %+v", state)
+	}
+}
+
+func TestOffboardRestart(t *testing.T) {
+	stateDir := t.TempDir()
+	g := newFakeGraph(t, leaver)
+
+	if _, stderr, err := runCommand(t, g, offboardArgs(stateDir)...); err != nil {
+		t.Fatalf("first run: %v\n%s", err, stderr)
+	}
+
+	// Without --restart, a finished offboarding changes nothing
+	g.requests = nil
+	if _, stderr, err := runCommand(t, g, offboardArgs(stateDir)...); err != nil {
+		t.Fatalf("second run: %v\n%s", err, stderr)
+	}
+	if sent := g.sent(); len(sent) != 0 {
+		t.Errorf("second run sent %q", sent)
+	}
+
+	// --restart forgets the progress and the deletion schedule
+	g.requests = nil
+	if _, stderr, err := runCommand(t, g, "users", "offboard", "jdoe@contoso.com", "--yes", "--state-dir", stateDir, "--restart"); err != nil {
+		t.Fatalf("restarted run: %v\n%s", err, stderr)
+	}
+	if sent := strings.Join(g.sent(), ","); sent != strings.Join(allChanges[:4], ",") {
+		t.Errorf("restarted run sent %s, want every step but the deletion", sent)
+	}
+	if state := loadState(t, stateDir); state.DeleteAfterDays != nil || state.Done(offboard.Delete) {
+		t.Errorf("restarted state is %+v, want no deletion", state)
+	}
+}
+
+func TestOffboardDryRun(t *testing.T) {
+	stateDir := t.TempDir()
+	g := newFakeGraph(t, leaver)
+
+	stdout, stderr, err := runCommand(t, g, append(offboardArgs(stateDir), "--dry-run")...)
+	if err != nil {
+		t.Fatalf("offboard: %v\n%s", err, stderr)
+	}
+
+	if sent := g.sent(); len(sent) != 0 {
+		t.Errorf("dry run sent %q", sent)
+	}
+	if entries, _ := os.ReadDir(stateDir); len(entries) != 0 {
+		t.Errorf("dry run saved state: %v", entries)
+	}
+	if strings.Count(stdout, offboard.Planned) != 5 {
+		t.Errorf("report does not plan five steps:\n%s", stdout)
+	}
+	for _, change := range allChanges {
+		method, path, _ := strings.Cut(change, " ")
+		if !strings.Contains(stderr, method+" "+g.URL+"/v1.0"+path) {
+			t.Errorf("plan does not show %s:\n%s", change, stderr)
+		}
+	}
+}
+
+func TestOffboardIgnoresStateOfEarlierUserWithSameUPN(t *testing.T) {
+	stateDir := t.TempDir()
+
+	// A leaver with ID old1 was offboarded under this UPN, but not deleted yet
+	earlier := loadState(t, stateDir)
+	earlier.UserID = "old1"
+	for _, step := range []string{offboard.Disable, offboard.RevokeSessions, offboard.Licenses, offboard.Groups} {
+		earlier.Record(step, offboard.Done, "", nil)
+	}
+	if err := earlier.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	g := newFakeGraph(t, leaver)
+	_, stderr, err := runCommand(t, g, offboardArgs(stateDir)...)
+	if err != nil {
+		t.Fatalf("offboard: %v\n%s", err, stderr)
+	}
+
+	if sent := strings.Join(g.sent(), ","); sent != strings.Join(allChanges, ",") {
+		t.Errorf("sent %s, want every step for the new user", sent)
+	}
+	if !strings.Contains(stderr, "earlier user") {
+		t.Errorf("no warning about the earlier user:\n%s", stderr)
+	}
+	if state := loadState(t, stateDir); state.UserID != "u1" {
+		t.Errorf("saved state is for %q, want u1", state.UserID)
+	}
+}
+
+func TestOffboardContinuesAfterUserIsGone(t *testing.T) {
+	stateDir := t.TempDir()
+
+	// Every step but the deletion is done, and the UPN no longer resolves (renamed or deleted)
+	saved := loadState(t, stateDir)
+	saved.UserID = "u1"
+	days := 0
+	saved.DeleteAfterDays = &days
+	for _, step := range []string{offboard.Disable, offboard.RevokeSessions, offboard.Licenses, offboard.Groups} {
+		saved.Record(step, offboard.Done, "", nil)
+	}
+	if err := saved.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	g := newFakeGraph(t, func(method, path string) (int, string) {
+		if method == http.MethodGet && path == "/users/jdoe@contoso.com" {
+			return http.StatusNotFound, `{"error":{"code":"Request_ResourceNotFound","message":"Resource does not exist."}}`
+		}
+		return leaver(method, path)
+	})
+	if _, stderr, err := runCommand(t, g, "users", "offboard", "jdoe@contoso.com", "--yes", "--state-dir", stateDir); err != nil {
+		t.Fatalf("offboard: %v\n%s", err, stderr)
+	}
+	if sent := strings.Join(g.sent(), ","); sent != "DELETE /users/u1" {
+		t.Errorf("sent %s, want the deletion by saved ID", sent)
+	}
+
+	// Without saved progress an unknown UPN is an error
+	if _, _, err := runCommand(t, g, "users", "offboard", "jdoe@contoso.com", "--yes", "--state-dir", filepath.Join(stateDir, "other")); err == nil {
+		t.Error("offboarding an unknown user succeeded")
+	}
+}
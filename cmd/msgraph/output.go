@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"GraphUserAdmin/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+// outputFormat is the value of the --output flag
+var outputFormat string
+
+// printer renders command results on stdout in the selected format
+var printer = &output.Printer{Format: output.Table, Out: os.Stdout}
+
+// setupPrinter selects the output format: --output, then the profile's default, then table
+func setupPrinter(cmd *cobra.Command) error {
+	name := outputFormat
+	if !cmd.Flags().Changed("output") && cfg != nil && cfg.Output != "" {
+		name = cfg.Output
+	}
+
+	format, err := output.ParseFormat(name)
+	if err != nil {
+		return err
+	}
+	printer.Format = format
+	return nil
+}
+
+// statusf writes progress and confirmation messages to stderr so stdout stays machine-parseable
+func statusf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format, args...)
+}
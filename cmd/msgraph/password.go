@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"GraphUserAdmin/internal/fileutil"
+	"GraphUserAdmin/internal/password"
+	"GraphUserAdmin/internal/users"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// setupUsersResetPasswordCommand creates the users reset-password command
+func setupUsersResetPasswordCommand(usersCmd *cobra.Command) {
+	resetPasswordCmd := &cobra.Command{
+		Use:   "reset-password [UPN]",
+		Short: "Set a new password for a user",
+		Long: `Set a new password for a user. By default the user must change it at the next sign-in.
+
+The password is prompted for without echo. Use --generate-password to create a random one that is
+shown once (or written to --password-file), or --password-stdin to read it from a pipe.
+
+--force-change-mfa makes the user complete multifactor authentication before choosing a new
+password. Resetting the password of an administrator needs a higher administrator role than theirs.`,
+		Example: `  gua users reset-password jdoe@example.com --generate-password
+  gua users reset-password jdoe@example.com --generate-password --force-change-mfa
+  gua users reset-password jdoe@example.com --generate-password --password-file jdoe.txt`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			upn := args[0]
+			forceChange, _ := cmd.Flags().GetBool("force-change")
+			forceChangeMfa, _ := cmd.Flags().GetBool("force-change-mfa")
+			if forceChangeMfa && !forceChange {
+				return fmt.Errorf("--force-change-mfa cannot be combined with --force-change=false")
+			}
+
+			if err := checkUser(upn); err != nil {
+				return err
+			}
+
+			value, generated, err := newPassword(cmd, "")
+			if err != nil {
+				return err
+			}
+
+			err = users.ResetPassword(client, upn, users.PasswordProfile{
+				Password:                             value,
+				ForceChangePasswordNextSignIn:        forceChange,
+				ForceChangePasswordNextSignInWithMfa: forceChangeMfa,
+			})
+			if err != nil {
+				return err
+			}
+
+			successf("✓ Successfully reset the password for %s\n", upn)
+			if generated {
+				deliverPassword(cmd, upn, value)
+			}
+			return nil
+		},
+	}
+	addPasswordInputFlags(resetPasswordCmd)
+	resetPasswordCmd.Flags().Bool("force-change", true, "Require the user to change the password at the next sign-in")
+	resetPasswordCmd.Flags().Bool("force-change-mfa", false, "Require multifactor authentication before the user changes the password")
+
+	usersCmd.AddCommand(resetPasswordCmd)
+}
+
+// addPasswordPolicyFlags adds the flags that shape generated passwords
+func addPasswordPolicyFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("password-length", password.DefaultPolicy.Length, "Length of generated passwords")
+	cmd.Flags().StringSlice("password-classes", password.DefaultPolicy.Classes, "Character classes of generated passwords: lower, upper, digits, symbols (at least 3)")
+	cmd.Flags().Bool("allow-ambiguous", false, "Allow look-alike characters such as 0/O and 1/l/I in generated passwords")
+}
+
+// passwordPolicy returns the policy selected with the password policy flags
+func passwordPolicy(cmd *cobra.Command) (password.Policy, error) {
+	policy := password.DefaultPolicy
+	policy.Length, _ = cmd.Flags().GetInt("password-length")
+	policy.Classes, _ = cmd.Flags().GetStringSlice("password-classes")
+	allowAmbiguous, _ := cmd.Flags().GetBool("allow-ambiguous")
+	policy.ExcludeAmbiguous = !allowAmbiguous
+
+	if err := policy.Validate(); err != nil {
+		return policy, err
+	}
+	return policy, nil
+}
+
+// addPasswordInputFlags adds the flags that choose where a new password comes from and where a
+// generated one goes. Without them the password is prompted for.
+func addPasswordInputFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("generate-password", false, "Generate a random password and show it once")
+	cmd.Flags().Bool("password-stdin", false, "Read the password from the first line of stdin")
+	cmd.Flags().String("password-file", "", "Write the generated password to this new file, readable only by you, instead of showing it")
+	addPasswordPolicyFlags(cmd)
+}
+
+// newPassword returns the password for a new credential and whether it was generated.
+// positional is the deprecated password argument, if one was given.
+func newPassword(cmd *cobra.Command, positional string) (string, bool, error) {
+	generate, _ := cmd.Flags().GetBool("generate-password")
+	fromStdin, _ := cmd.Flags().GetBool("password-stdin")
+	passwordFile, _ := cmd.Flags().GetString("password-file")
+
+	sources := 0
+	for _, set := range []bool{generate, fromStdin, positional != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return "", false, fmt.Errorf("use only one of --generate-password, --password-stdin and the password argument")
+	}
+	if passwordFile != "" && !generate {
+		return "", false, fmt.Errorf("--password-file requires --generate-password")
+	}
+	if _, err := os.Stat(passwordFile); passwordFile != "" && err == nil {
+		return "", false, fmt.Errorf("password file %s already exists", passwordFile)
+	}
+
+	switch {
+	case generate:
+		policy, err := passwordPolicy(cmd)
+		if err != nil {
+			return "", false, err
+		}
+		generated, err := policy.Generate()
+		return generated, true, err
+	case fromStdin:
+		value, err := readPasswordLine(os.Stdin)
+		return value, false, err
+	case positional != "":
+		statusf("⚠ Warning: passing the password as an argument is deprecated; it is visible in shell history and process lists. Use --password-stdin, --generate-password or the prompt instead.\n")
+		return positional, false, nil
+	default:
+		value, err := promptPassword()
+		return value, false, err
+	}
+}
+
+// readPasswordLine reads the first line of r, without its line ending
+func readPasswordLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("no password on stdin")
+	}
+	return line, nil
+}
+
+// promptPassword asks for a password twice on the terminal without echoing it
+func promptPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("no password given: stdin is not a terminal, so use --password-stdin or --generate-password")
+	}
+
+	statusf("Password: ")
+	first, err := term.ReadPassword(fd)
+	statusf("\n")
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	if len(first) == 0 {
+		return "", fmt.Errorf("the password is empty")
+	}
+
+	statusf("Confirm password: ")
+	second, err := term.ReadPassword(fd)
+	statusf("\n")
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	if string(first) != string(second) {
+		return "", fmt.Errorf("the passwords do not match")
+	}
+
+	return string(first), nil
+}
+
+// deliverPassword shows a generated password once on stderr, or writes it to --password-file.
+// Dry runs set no password, so there is nothing to deliver.
+func deliverPassword(cmd *cobra.Command, upn, value string) {
+	if dryRun {
+		return
+	}
+
+	passwordFile, _ := cmd.Flags().GetString("password-file")
+	if passwordFile != "" {
+		err := writePasswordFile(passwordFile, value)
+		if err == nil {
+			statusf("Password for %s written to %s\n", upn, passwordFile)
+			return
+		}
+		// The password is already set, so it must not be lost
+		statusf("⚠ Warning: %v\n", err)
+	}
+
+	statusf("\nPassword for %s (shown only once):\n\n    %s\n\n", upn, value)
+}
+
+// writePasswordFile writes the password to a new file that only the current user can read
+func writePasswordFile(path, value string) error {
+	file, err := fileutil.CreateExclusive(path, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write password file: %w", err)
+	}
+	if _, err := fmt.Fprintln(file, value); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write password file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write password file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"GraphUserAdmin/internal/output"
+	"GraphUserAdmin/internal/users"
+
+	"github.com/spf13/cobra"
+)
+
+// Org chart formats
+const (
+	orgChartDOT     = "dot"
+	orgChartMermaid = "mermaid"
+	orgChartJSON    = "json"
+)
+
+// setupReportCommands creates the report command and its subcommands
+func setupReportCommands(rootCmd *cobra.Command) {
+	reportCmd := &cobra.Command{
+		Use:   "report",
+		Short: "Generate reports about the tenant",
+	}
+
+	var format, filter string
+	orgChartCmd := &cobra.Command{
+		Use:   "orgchart",
+		Short: "Export the org chart from manager relationships",
+		Long: `Export the org chart built from every user's manager. Users and their managers are listed in bulk,
+so the whole tenant takes one request per 100 users.
+
+Formats:
+  dot      Graphviz DOT (render with: dot -Tsvg orgchart.dot -o orgchart.svg)
+  mermaid  Mermaid flowchart, for Markdown pages and wikis
+  json     nested JSON: each user's reports under them, followed by the issues found
+
+Users without a manager, managers outside the chart, disabled accounts that still manage people
+and management cycles are reported as warnings on stderr (and under "issues" in JSON). In DOT and
+Mermaid output disabled users are drawn dashed and the relationships of a cycle in red.`,
+		Example: `  gua report orgchart > orgchart.dot && dot -Tsvg orgchart.dot -o orgchart.svg
+  gua report orgchart --format mermaid > orgchart.md
+  gua report orgchart --format json --filter "department eq 'Sales'"`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !cmd.Flags().Changed("format") && printer.Format == output.JSON {
+				format = orgChartJSON
+			}
+			switch format {
+			case orgChartDOT, orgChartMermaid, orgChartJSON:
+			default:
+				return fmt.Errorf("unknown org chart format %q: use dot, mermaid or json", format)
+			}
+
+			userList, err := users.ListUsers(client, users.ListOptions{
+				Filter: filter,
+				Select: []string{"jobTitle"},
+				Expand: "manager($select=id,displayName,userPrincipalName,accountEnabled)",
+			})
+			if err != nil {
+				return err
+			}
+			chart := users.BuildOrgChart(userList)
+
+			switch format {
+			case orgChartDOT:
+				writeOrgChartDOT(printer.Out, chart)
+			case orgChartMermaid:
+				writeOrgChartMermaid(printer.Out, chart)
+			default:
+				// The issues are part of the JSON document, which is JSON whatever --output says
+				jsonPrinter := &output.Printer{Format: output.JSON, Out: printer.Out}
+				if err := jsonPrinter.Object(chart, nil); err != nil {
+					return err
+				}
+				statusf("%d users, %d issue(s)\n", len(chart.Users), len(chart.Issues))
+				return nil
+			}
+
+			for _, issue := range chart.Issues {
+				statusf("⚠ %s: %s\n", issue.User, issue.Detail)
+			}
+			statusf("%d users, %d issue(s)\n", len(chart.Users), len(chart.Issues))
+			return nil
+		},
+	}
+	orgChartCmd.Flags().StringVar(&format, "format", orgChartDOT, "Output format: dot, mermaid or json")
+	orgChartCmd.Flags().StringVar(&filter, "filter", "", "OData filter limiting the users in the chart (e.g. \"department eq 'Sales'\")")
+
+	reportCmd.AddCommand(orgChartCmd)
+	rootCmd.AddCommand(reportCmd)
+}
+
+// orgChartLabel is the text shown in a user's box
+func orgChartLabel(node *users.ReportNode) []string {
+	lines := []string{node.DisplayName}
+	if node.JobTitle != "" {
+		lines = append(lines, node.JobTitle)
+	}
+	if !node.AccountEnabled {
+		lines = append(lines, "(disabled)")
+	}
+	return lines
+}
+
+// writeOrgChartDOT writes the chart as a Graphviz digraph with managers above their reports
+func writeOrgChartDOT(w io.Writer, chart *users.OrgChart) {
+	fmt.Fprintln(w, "digraph orgchart {")
+	fmt.Fprintln(w, "  rankdir=TB;")
+	fmt.Fprintln(w, `  node [shape=box, style=rounded, fontname="Helvetica"];`)
+	fmt.Fprintln(w)
+
+	for _, node := range chart.Users {
+		var label []string
+		for _, line := range orgChartLabel(node) {
+			label = append(label, dotEscape(line))
+		}
+		attributes := fmt.Sprintf(`label="%s"`, strings.Join(label, `\n`))
+		if !node.AccountEnabled {
+			attributes += `, style="rounded,dashed", fontcolor=gray40`
+		}
+		fmt.Fprintf(w, "  \"%s\" [%s];\n", node.ID, attributes)
+	}
+	fmt.Fprintln(w)
+
+	for _, edge := range chart.Edges {
+		if edge.Cycle {
+			fmt.Fprintf(w, "  \"%s\" -> \"%s\" [color=red];\n", edge.ManagerID, edge.UserID)
+		} else {
+			fmt.Fprintf(w, "  \"%s\" -> \"%s\";\n", edge.ManagerID, edge.UserID)
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// dotEscape escapes text for a quoted DOT string
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// writeOrgChartMermaid writes the chart as a top-down Mermaid flowchart
+func writeOrgChartMermaid(w io.Writer, chart *users.OrgChart) {
+	// Object IDs contain dashes, which Mermaid reads as arrows, so nodes get short names
+	names := map[string]string{}
+	for i, node := range chart.Users {
+		names[node.ID] = "u" + strconv.Itoa(i)
+	}
+
+	fmt.Fprintln(w, "flowchart TD")
+	for _, node := range chart.Users {
+		var label []string
+		for _, line := range orgChartLabel(node) {
+			label = append(label, mermaidEscape(line))
+		}
+		fmt.Fprintf(w, "  %s[\"%s\"]\n", names[node.ID], strings.Join(label, "<br/>"))
+	}
+
+	var cycleLinks []string
+	for i, edge := range chart.Edges {
+		fmt.Fprintf(w, "  %s --> %s\n", names[edge.ManagerID], names[edge.UserID])
+		if edge.Cycle {
+			cycleLinks = append(cycleLinks, strconv.Itoa(i))
+		}
+	}
+
+	var disabled []string
+	for _, node := range chart.Users {
+		if !node.AccountEnabled {
+			disabled = append(disabled, names[node.ID])
+		}
+	}
+	if len(disabled) > 0 {
+		fmt.Fprintln(w, "  classDef disabled stroke-dasharray: 5 5, color:#888")
+		fmt.Fprintf(w, "  class %s disabled\n", strings.Join(disabled, ","))
+	}
+	if len(cycleLinks) > 0 {
+		fmt.Fprintf(w, "  linkStyle %s stroke:red\n", strings.Join(cycleLinks, ","))
+	}
+}
+
+// mermaidEscape escapes text for a quoted Mermaid label
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
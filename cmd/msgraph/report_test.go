@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"GraphUserAdmin/internal/users"
+)
+
+// cycleChart is a chart where Alice and Bob manage each other and disabled Carol reports to Alice
+func cycleChart() *users.OrgChart {
+	user := func(id, displayName, managerID string) users.User {
+		return users.User{
+			ID:                id,
+			DisplayName:       displayName,
+			UserPrincipalName: id + "@contoso.com",
+			AccountEnabled:    true,
+			Manager:           &users.User{ID: managerID},
+		}
+	}
+
+	alice := user("alice", "Alice", "bob")
+	alice.Properties = map[string]interface{}{"jobTitle": `Chief "Everything" Officer`}
+	carol := user("carol", "Carol", "alice")
+	carol.AccountEnabled = false
+
+	return users.BuildOrgChart([]users.User{
+		user("dave", "Dave", "carol"),
+		user("bob", "Bob", "alice"),
+		carol,
+		alice,
+	})
+}
+
+func TestWriteOrgChartDOT(t *testing.T) {
+	var out strings.Builder
+	writeOrgChartDOT(&out, cycleChart())
+
+	want := `digraph orgchart {
+  rankdir=TB;
+  node [shape=box, style=rounded, fontname="Helvetica"];
+
+  "alice" [label="Alice\nChief \"Everything\" Officer"];
+  "bob" [label="Bob"];
+  "carol" [label="Carol\n(disabled)", style="rounded,dashed", fontcolor=gray40];
+  "dave" [label="Dave"];
+
+  "bob" -> "alice" [color=red];
+  "alice" -> "bob" [color=red];
+  "alice" -> "carol";
+  "carol" -> "dave";
+}
+`
+	if out.String() != want {
+		t.Errorf("DOT output is\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestWriteOrgChartMermaid(t *testing.T) {
+	var out strings.Builder
+	writeOrgChartMermaid(&out, cycleChart())
+
+	want := `flowchart TD
+  u0["Alice<br/>Chief #quot;Everything#quot; Officer"]
+  u1["Bob"]
+  u2["Carol<br/>(disabled)"]
+  u3["Dave"]
+  u1 --> u0
+  u0 --> u1
+  u0 --> u2
+  u2 --> u3
+  classDef disabled stroke-dasharray: 5 5, color:#888
+  class u2 disabled
+  linkStyle 0,1 stroke:red
+`
+	if out.String() != want {
+		t.Errorf("Mermaid output is\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestReportOrgChartFlagsDisabledManagerOutsideFilter(t *testing.T) {
+	var g *fakeGraph
+	g = newFakeGraph(t, func(method, path string) (int, string) {
+		// Graph leaves accountEnabled out of the expanded manager unless it is selected
+		enabled := func(value string) string {
+			if strings.Contains(g.query("GET /users").Get("$expand"), "accountEnabled") {
+				return `,"accountEnabled":` + value
+			}
+			return ""
+		}
+		return http.StatusOK, `{"value":[
+			{"id":"rep1","displayName":"Rep A","userPrincipalName":"rep1@contoso.com","accountEnabled":true,
+			 "manager":{"id":"vp","displayName":"VP","userPrincipalName":"vp@contoso.com"` + enabled("false") + `}},
+			{"id":"rep2","displayName":"Rep B","userPrincipalName":"rep2@contoso.com","accountEnabled":true,
+			 "manager":{"id":"lead","displayName":"Lead","userPrincipalName":"lead@contoso.com"` + enabled("true") + `}}]}`
+	})
+
+	stdout, stderr, err := runCommand(t, g, "report", "orgchart", "--format", "json", "--filter", "department eq 'Sales'")
+	if err != nil {
+		t.Fatalf("orgchart: %v\n%s", err, stderr)
+	}
+
+	var chart struct {
+		Issues []users.OrgIssue `json:"issues"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &chart); err != nil {
+		t.Fatalf("stdout is not JSON: %v\n%s", err, stdout)
+	}
+	var issues []string
+	for _, issue := range chart.Issues {
+		issues = append(issues, issue.Kind+" "+issue.User)
+	}
+	want := "manager-not-found rep1@contoso.com,manager-not-found rep2@contoso.com,disabled-manager vp@contoso.com"
+	if strings.Join(issues, ",") != want {
+		t.Errorf("issues are %q, want %s", issues, want)
+	}
+}
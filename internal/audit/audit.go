@@ -0,0 +1,251 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is one change made through gua
+type Entry struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user"`
+	Profile  string    `json:"profile,omitempty"`
+	TenantID string    `json:"tenantId,omitempty"`
+	Command  string    `json:"command"`
+	Method   string    `json:"method"`
+	URL      string    `json:"url"`
+	// Target is the object the request changed, such as users/jdoe@example.com
+	Target string `json:"target,omitempty"`
+	// Body is the request body with passwords and secrets redacted
+	Body            json.RawMessage `json:"body,omitempty"`
+	Status          int             `json:"status"`
+	RequestID       string          `json:"requestId,omitempty"`
+	ClientRequestID string          `json:"clientRequestId,omitempty"`
+	Error           string          `json:"error,omitempty"`
+}
+
+// Filter selects entries for Log.Read; zero values match everything
+type Filter struct {
+	Since time.Time
+	Until time.Time
+	// Target and Command match case-insensitive substrings
+	Target  string
+	Command string
+}
+
+// Match reports whether the entry passes the filter
+func (f Filter) Match(e *Entry) bool {
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	if f.Target != "" && !containsFold(e.Target, f.Target) && !containsFold(e.URL, f.Target) {
+		return false
+	}
+	if f.Command != "" && !containsFold(e.Command, f.Command) {
+		return false
+	}
+	return true
+}
+
+// Log is an append-only JSON Lines file that only the current user can read
+type Log struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// DefaultPath returns the audit log location in the user's configuration directory
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config directory: %w", err)
+	}
+	return filepath.Join(dir, "gua", "audit.jsonl"), nil
+}
+
+// Append writes one entry as a single line at the end of the log
+func (l *Log) Append(e *Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(l.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return file.Close()
+}
+
+// Read returns the entries that match the filter, oldest first. A missing log has no entries.
+func (l *Log) Read(filter Filter) ([]Entry, error) {
+	file, err := os.Open(l.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("failed to parse audit log %s line %d: %w", l.Path, line, err)
+		}
+		if filter.Match(&e) {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	return entries, nil
+}
+
+// CurrentUser returns the operating system account running gua
+func CurrentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
+
+// Target derives the changed object from a request URL relative to the Graph base URL, e.g.
+// users/jdoe@example.com for .../users/jdoe@example.com/assignLicense. Creating an object has no
+// ID in the URL, so the body's userPrincipalName or displayName is used instead. Deleted items
+// keep their ID (directory/deletedItems/u1) and removed members the member's (groups/g1/members/u1).
+func Target(baseURL, requestURL string, body []byte) string {
+	path := strings.TrimPrefix(requestURL, strings.TrimSuffix(baseURL, "/"))
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segment = unescaped
+		}
+		segments = append(segments, segment)
+	}
+
+	if len(segments) == 1 {
+		var named struct {
+			UserPrincipalName string `json:"userPrincipalName"`
+			DisplayName       string `json:"displayName"`
+		}
+		json.Unmarshal(body, &named)
+		if named.UserPrincipalName != "" {
+			return segments[0] + "/" + named.UserPrincipalName
+		}
+		if named.DisplayName != "" {
+			return segments[0] + "/" + named.DisplayName
+		}
+	}
+	keep := 2
+	switch {
+	case len(segments) >= 3 && segments[0] == "directory" && segments[1] == "deletedItems":
+		keep = 3
+	case len(segments) == 5 && segments[4] == "$ref":
+		keep = 4
+	}
+	if len(segments) > keep {
+		segments = segments[:keep]
+	}
+	return strings.Join(segments, "/")
+}
+
+// Redact returns a copy of a JSON body with the text and number values of password, secret and
+// token properties replaced, at any depth, including the items of lists held by such properties.
+// Flags such as forceChangePasswordNextSignIn are kept.
+func Redact(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil || decoder.Decode(new(interface{})) != io.EOF {
+		return json.RawMessage(`"[unparseable body omitted]"`)
+	}
+
+	redacted, err := json.Marshal(redactValue(value, false))
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
+
+// redactedValue replaces sensitive values in the log
+const redactedValue = "[REDACTED]"
+
+// sensitiveNames are the property name fragments whose values are never logged
+var sensitiveNames = []string{"password", "secret", "token", "credential"}
+
+// redactValue replaces the scalar values held by sensitive properties. Objects are always
+// searched, with their own property names deciding what is sensitive.
+func redactValue(value interface{}, sensitive bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, field := range v {
+			v[name] = redactValue(field, isSensitive(name))
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item, sensitive)
+		}
+	case string, json.Number:
+		if sensitive {
+			return redactedValue
+		}
+	}
+	return value
+}
+
+func isSensitive(name string) bool {
+	for _, fragment := range sensitiveNames {
+		if containsFold(name, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
@@ -0,0 +1,148 @@
+package audit
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"empty", ``, ``},
+		{"no secrets", `{"displayName":"John","accountEnabled":false}`, `{"accountEnabled":false,"displayName":"John"}`},
+		{
+			"nested passwordProfile",
+			`{"displayName":"John","passwordProfile":{"password":"P@ssw0rd!","forceChangePasswordNextSignIn":true}}`,
+			`{"displayName":"John","passwordProfile":{"forceChangePasswordNextSignIn":true,"password":"[REDACTED]"}}`,
+		},
+		{
+			"names in any case",
+			`{"newPassword":"a","currentPassword":"b","clientSecret":"c","ClientSecret":"d","refresh_token":"e","PASSWORD":"f"}`,
+			`{"ClientSecret":"[REDACTED]","PASSWORD":"[REDACTED]","clientSecret":"[REDACTED]","currentPassword":"[REDACTED]","newPassword":"[REDACTED]","refresh_token":"[REDACTED]"}`,
+		},
+		{
+			"arrays of objects",
+			`{"passwordCredentials":[{"displayName":"ci","secretText":"s1"},{"displayName":"cd","secretText":"s2"}]}`,
+			`{"passwordCredentials":[{"displayName":"ci","secretText":"[REDACTED]"},{"displayName":"cd","secretText":"[REDACTED]"}]}`,
+		},
+		{
+			"top-level array",
+			`[{"userPrincipalName":"a@contoso.com","passwordProfile":{"password":"x"}}]`,
+			`[{"passwordProfile":{"password":"[REDACTED]"},"userPrincipalName":"a@contoso.com"}]`,
+		},
+		{
+			"list of secrets",
+			`{"secrets":["a","b",["c"]],"tokens":[{"value":"kept"}]}`,
+			`{"secrets":["[REDACTED]","[REDACTED]",["[REDACTED]"]],"tokens":[{"value":"kept"}]}`,
+		},
+		{"numeric secret", `{"pin":1,"passwordPin":123456}`, `{"passwordPin":"[REDACTED]","pin":1}`},
+		{"large number kept exactly", `{"count":12345678901234567890}`, `{"count":12345678901234567890}`},
+		{"null secret", `{"password":null}`, `{"password":null}`},
+		{"not JSON", `password=hunter2`, `"[unparseable body omitted]"`},
+		{"truncated JSON", `{"password":"hunter2"`, `"[unparseable body omitted]"`},
+		{"trailing data", `{"a":1} {"password":"hunter2"}`, `"[unparseable body omitted]"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(Redact([]byte(test.body))); got != test.want {
+				t.Errorf("Redact(%s) = %s, want %s", test.body, got, test.want)
+			}
+		})
+	}
+}
+
+func TestTarget(t *testing.T) {
+	const base = "https://graph.microsoft.com/v1.0"
+
+	tests := []struct {
+		name string
+		url  string
+		body string
+		want string
+	}{
+		{"user", base + "/users/jdoe@contoso.com", ``, "users/jdoe@contoso.com"},
+		{"user action", base + "/users/jdoe%40contoso.com/assignLicense", `{}`, "users/jdoe@contoso.com"},
+		{"with query", base + "/users/u1?$select=id", ``, "users/u1"},
+		{"created user", base + "/users", `{"displayName":"John","userPrincipalName":"john@contoso.com"}`, "users/john@contoso.com"},
+		{"created group", base + "/groups", `{"displayName":"Sales"}`, "groups/Sales"},
+		{"created without name", base + "/groups", `{}`, "groups"},
+		{"add member $ref", base + "/groups/g1/members/$ref", `{"@odata.id":"https://graph.microsoft.com/v1.0/directoryObjects/u1"}`, "groups/g1"},
+		{"remove member $ref", base + "/groups/g1/members/u1/$ref", ``, "groups/g1/members/u1"},
+		{"remove owner $ref", base + "/groups/g1/owners/u2/$ref", ``, "groups/g1/owners/u2"},
+		{"manager $ref", base + "/users/jdoe@contoso.com/manager/$ref", `{}`, "users/jdoe@contoso.com"},
+		{"$batch", base + "/$batch", `{"requests":[{"id":"0","method":"POST","url":"/users","body":{"userPrincipalName":"a@contoso.com"}}]}`, "$batch"},
+		{"restore", base + "/directory/deletedItems/u1/restore", ``, "directory/deletedItems/u1"},
+		{"purge", base + "/directory/deletedItems/u1", ``, "directory/deletedItems/u1"},
+		{"base URL with slash", base + "/users/u1", ``, "users/u1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Target(base+"/", test.url, []byte(test.body)); got != test.want {
+				t.Errorf("Target(%s) = %q, want %q", test.url, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	since := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)
+	entry := func(at time.Time) *Entry {
+		return &Entry{Time: at, Command: "gua users delete", Target: "users/jdoe@contoso.com", URL: "https://graph.microsoft.com/v1.0/users/u1"}
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		entry  *Entry
+		want   bool
+	}{
+		{"empty filter", Filter{}, entry(since), true},
+		{"at since", Filter{Since: since}, entry(since), true},
+		{"just before since", Filter{Since: since}, entry(since.Add(-time.Nanosecond)), false},
+		{"just before until", Filter{Until: until}, entry(until.Add(-time.Nanosecond)), true},
+		{"at until", Filter{Until: until}, entry(until), false},
+		{"inside range", Filter{Since: since, Until: until}, entry(since.Add(time.Hour)), true},
+		{"since in another zone", Filter{Since: since.In(time.FixedZone("UTC+2", 2*60*60))}, entry(since), true},
+		{"target", Filter{Target: "JDOE"}, entry(since), true},
+		{"target in URL", Filter{Target: "u1"}, entry(since), true},
+		{"other target", Filter{Target: "asmith"}, entry(since), false},
+		{"command", Filter{Command: "Users Delete"}, entry(since), true},
+		{"other command", Filter{Command: "users create"}, entry(since), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.filter.Match(test.entry); got != test.want {
+				t.Errorf("Match = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLogAppendAndRead(t *testing.T) {
+	log := &Log{Path: filepath.Join(t.TempDir(), "gua", "audit.jsonl")}
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		entry := &Entry{Time: start.Add(time.Duration(i) * time.Hour), Command: "gua users disable", Status: 204,
+			Body: json.RawMessage(`{"accountEnabled":false}`)}
+		if err := log.Append(entry); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	entries, err := log.Read(Filter{Since: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(entries) != 2 || !entries[0].Time.Equal(start.Add(time.Hour)) || string(entries[1].Body) != `{"accountEnabled":false}` {
+		t.Errorf("entries are %+v", entries)
+	}
+}
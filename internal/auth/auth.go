@@ -1,27 +1,118 @@
 package auth
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
-// GetAccessToken obtains an access token using client credentials flow
-func GetAccessToken(tenantID, clientID, clientSecret string) (string, error) {
-	tokenEndpoint := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", tenantID)
+// AuthorityHost is the Microsoft identity platform host that issues tokens.
+// It is changed for national clouds, and can be pointed at a local token endpoint for testing.
+var AuthorityHost = "https://login.microsoftonline.com"
+
+// GraphResource is the Graph endpoint tokens are requested for; it differs per national cloud
+var GraphResource = "https://graph.microsoft.com"
+
+// GraphScope returns the scope requested for application (client credentials) tokens
+func GraphScope() string {
+	return GraphResource + "/.default"
+}
+
+// tokenEndpoint returns the OAuth 2.0 token endpoint for a tenant
+func tokenEndpoint(tenantID string) string {
+	return fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimSuffix(AuthorityHost, "/"), tenantID)
+}
 
+// GetAccessToken obtains an access token using client credentials flow
+func GetAccessToken(tenantID, clientID, clientSecret string) (*Token, error) {
 	data := url.Values{}
 	data.Set("client_id", clientID)
-	data.Set("scope", "https://graph.microsoft.com/.default")
+	data.Set("scope", GraphScope())
 	data.Set("client_secret", clientSecret)
 	data.Set("grant_type", "client_credentials")
 
-	req, err := http.NewRequest("POST", tokenEndpoint, strings.NewReader(data.Encode()))
+	return requestToken(tokenEndpoint(tenantID), data)
+}
+
+// GetAccessTokenWithCertificate obtains an access token using client credentials flow,
+// proving the application's identity with a client assertion signed by its certificate
+func GetAccessTokenWithCertificate(tenantID, clientID string, cert *Certificate) (*Token, error) {
+	endpoint := tokenEndpoint(tenantID)
+
+	assertion, err := cert.clientAssertion(clientID, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client assertion: %w", err)
+	}
+
+	data := url.Values{}
+	data.Set("client_id", clientID)
+	data.Set("scope", GraphScope())
+	data.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+	data.Set("client_assertion", assertion)
+	data.Set("grant_type", "client_credentials")
+
+	return requestToken(endpoint, data)
+}
+
+// Token is an access token together with what is needed to know when, and how, to renew it
+type Token struct {
+	AccessToken  string    `json:"accessToken"`
+	RefreshToken string    `json:"refreshToken,omitempty"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	// Account is the signed-in user for delegated tokens
+	Account string `json:"account,omitempty"`
+}
+
+// TokenError is returned when the token endpoint rejects a request
+type TokenError struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *TokenError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("status %d: %s", e.StatusCode, e.Description)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// requestToken posts a token request and returns the token from the response
+func requestToken(endpoint string, data url.Values) (*Token, error) {
+	body, err := postForm(endpoint, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokenResponse struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		IDToken      string `json:"id_token"`
+	}
+
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+
+	return &Token{
+		AccessToken:  tokenResponse.AccessToken,
+		RefreshToken: tokenResponse.RefreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(tokenResponse.ExpiresIn) * time.Second),
+		Account:      accountName(tokenResponse.IDToken),
+	}, nil
+}
+
+// postForm posts a form to the identity platform and returns the body of a successful response
+func postForm(endpoint string, data url.Values) ([]byte, error) {
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(data.Encode()))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
@@ -29,26 +120,49 @@ func GetAccessToken(tenantID, clientID, clientSecret string) (string, error) {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to obtain token: %w", err)
+		return nil, fmt.Errorf("failed to obtain token: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("authentication failed (status %d): %s", resp.StatusCode, string(body))
+		tokenErr := &TokenError{StatusCode: resp.StatusCode, Description: string(body)}
+		var errorResponse struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &errorResponse) == nil && errorResponse.Error != "" {
+			tokenErr.Code = errorResponse.Error
+			tokenErr.Description = errorResponse.ErrorDescription
+		}
+		return nil, tokenErr
 	}
 
-	var tokenResponse struct {
-		AccessToken string `json:"access_token"`
+	return body, nil
+}
+
+// accountName reads the signed-in user's name from an ID token.
+// The token came straight from the token endpoint over TLS, so its signature is not verified.
+func accountName(idToken string) string {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return ""
 	}
 
-	if err := json.Unmarshal(body, &tokenResponse); err != nil {
-		return "", fmt.Errorf("failed to parse token response: %w", err)
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
 	}
 
-	return tokenResponse.AccessToken, nil
+	var claims struct {
+		PreferredUsername string `json:"preferred_username"`
+	}
+	if json.Unmarshal(payload, &claims) != nil {
+		return ""
+	}
+	return claims.PreferredUsername
 }
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"GraphUserAdmin/internal/fileutil"
+)
+
+// refreshMargin renews tokens this long before they expire so a request never carries a stale token
+const refreshMargin = 5 * time.Minute
+
+// ErrNotSignedIn is returned when delegated mode is configured but 'gua login' has not been run
+var ErrNotSignedIn = errors.New("not signed in; run 'gua login' first")
+
+// CacheEntry is a cached token and the tenant, client and scope it was issued for
+type CacheEntry struct {
+	TenantID string `json:"tenantId"`
+	ClientID string `json:"clientId"`
+	Scope    string `json:"scope"`
+	Token
+}
+
+// Delegated reports whether the token was issued to a signed-in user rather than the application
+func (e *CacheEntry) Delegated() bool {
+	return e.RefreshToken != "" || e.Account != ""
+}
+
+// Valid reports whether the access token can still be used without renewing it
+func (e *CacheEntry) Valid() bool {
+	return e.AccessToken != "" && time.Until(e.ExpiresAt) > refreshMargin
+}
+
+func cacheKey(tenantID, clientID, scope string) string {
+	return strings.ToLower(tenantID) + "|" + strings.ToLower(clientID) + "|" + scope
+}
+
+// Cache stores tokens in a JSON file that only the current user can read
+type Cache struct {
+	Path string
+}
+
+// DefaultCachePath returns the token cache location in the user's cache directory
+func DefaultCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user cache directory: %w", err)
+	}
+	return filepath.Join(dir, "gua", "tokens.json"), nil
+}
+
+// load reads all entries; a missing file is an empty cache
+func (c *Cache) load() (map[string]*CacheEntry, error) {
+	entries := map[string]*CacheEntry{}
+
+	data, err := os.ReadFile(c.Path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token cache: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse token cache %s: %w", c.Path, err)
+	}
+	return entries, nil
+}
+
+// save replaces the cache file with the given entries
+func (c *Cache) save(entries map[string]*CacheEntry) error {
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create token cache directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode token cache: %w", err)
+	}
+
+	// A concurrent gua never reads a half-written file
+	if err := fileutil.WriteFileAtomic(c.Path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save token cache: %w", err)
+	}
+	return nil
+}
+
+// Get returns the cached entry for a tenant, client and scope, or nil when there is none
+func (c *Cache) Get(tenantID, clientID, scope string) (*CacheEntry, error) {
+	entries, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	return entries[cacheKey(tenantID, clientID, scope)], nil
+}
+
+// Put adds or replaces an entry
+func (c *Cache) Put(entry *CacheEntry) error {
+	entries, err := c.load()
+	if err != nil {
+		return err
+	}
+	entries[cacheKey(entry.TenantID, entry.ClientID, entry.Scope)] = entry
+	return c.save(entries)
+}
+
+// Entries returns all cached entries ordered by tenant, client and scope
+func (c *Cache) Entries() ([]*CacheEntry, error) {
+	entries, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := make([]*CacheEntry, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, entries[key])
+	}
+	return list, nil
+}
+
+// Remove deletes every entry for a tenant and client and returns how many were removed
+func (c *Cache) Remove(tenantID, clientID string) (int, error) {
+	entries, err := c.load()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for key, entry := range entries {
+		if strings.EqualFold(entry.TenantID, tenantID) && strings.EqualFold(entry.ClientID, clientID) {
+			delete(entries, key)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, c.save(entries)
+}
+
+// Clear deletes the cache file
+func (c *Cache) Clear() error {
+	if err := os.Remove(c.Path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete token cache: %w", err)
+	}
+	return nil
+}
+
+// CachedTokenSource supplies access tokens from the cache, renewing them shortly before they expire.
+// Delegated tokens are renewed with their refresh token; application tokens are fetched again with Fetch.
+type CachedTokenSource struct {
+	Cache    *Cache
+	TenantID string
+	ClientID string
+	Scope    string
+	// Fetch obtains a new token when there is no usable cached one; nil for delegated sign-ins
+	Fetch func() (*Token, error)
+
+	mu sync.Mutex
+}
+
+// Token returns a valid access token
+func (s *CachedTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, err := s.Cache.Get(s.TenantID, s.ClientID, s.Scope)
+	if err != nil {
+		return "", err
+	}
+	if entry != nil && entry.Valid() {
+		return entry.AccessToken, nil
+	}
+
+	var token *Token
+	switch {
+	case entry != nil && entry.RefreshToken != "":
+		token, err = RefreshAccessToken(s.TenantID, s.ClientID, entry.RefreshToken, strings.Fields(s.Scope))
+		if err != nil {
+			return "", fmt.Errorf("failed to refresh sign-in (run 'gua login' again): %w", err)
+		}
+		// Refresh responses carry no ID token
+		if token.Account == "" {
+			token.Account = entry.Account
+		}
+	case s.Fetch != nil:
+		token, err = s.Fetch()
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", ErrNotSignedIn
+	}
+
+	entry = &CacheEntry{TenantID: s.TenantID, ClientID: s.ClientID, Scope: s.Scope, Token: *token}
+	if err := s.Cache.Put(entry); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
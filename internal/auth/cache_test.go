@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCache(t *testing.T) *Cache {
+	return &Cache{Path: filepath.Join(t.TempDir(), "gua", "tokens.json")}
+}
+
+func TestCachedTokenSource(t *testing.T) {
+	const refreshed = `{"access_token":"refreshed","expires_in":3600}`
+	fetchErr := errors.New("fetch failed")
+
+	tests := []struct {
+		name string
+		// cached is the entry in the cache before Token is called, if any
+		cached *Token
+		// refresh is the token endpoint's answer to a refresh request; empty when none may be sent
+		refresh string
+		fetch   func() (*Token, error)
+		want    string
+		wantErr error
+		// wantCached is the access token cached afterwards
+		wantCached string
+	}{
+		{"valid", &Token{AccessToken: "cached", ExpiresAt: time.Now().Add(time.Hour)}, "", nil, "cached", nil, "cached"},
+		{"expires outside the refresh margin", &Token{AccessToken: "cached", RefreshToken: "refresh", ExpiresAt: time.Now().Add(refreshMargin + time.Minute)},
+			"", nil, "cached", nil, "cached"},
+		{"expires inside the refresh margin", &Token{AccessToken: "cached", RefreshToken: "refresh", ExpiresAt: time.Now().Add(refreshMargin - time.Minute)},
+			refreshed, nil, "refreshed", nil, "refreshed"},
+		{"expired delegated token", &Token{AccessToken: "cached", RefreshToken: "refresh", ExpiresAt: time.Now().Add(-time.Hour)},
+			refreshed, fetchNever(t), "refreshed", nil, "refreshed"},
+		{"expired application token", &Token{AccessToken: "cached", ExpiresAt: time.Now().Add(-time.Hour)},
+			"", fetchToken("fetched"), "fetched", nil, "fetched"},
+		{"empty cache", nil, "", fetchToken("fetched"), "fetched", nil, "fetched"},
+		{"fetch fails", nil, "", func() (*Token, error) { return nil, fetchErr }, "", fetchErr, ""},
+		{"not signed in", nil, "", nil, "", ErrNotSignedIn, ""},
+		{"expired without refresh token or fetch", &Token{AccessToken: "cached", ExpiresAt: time.Now().Add(-time.Hour)},
+			"", nil, "", ErrNotSignedIn, "cached"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var forms *[]map[string]string
+			if test.refresh != "" {
+				forms = tokenServer(t, test.refresh)
+			} else {
+				forms = tokenServer(t)
+			}
+
+			cache := newTestCache(t)
+			if test.cached != nil {
+				entry := &CacheEntry{TenantID: "tenant-id", ClientID: "client-id", Scope: DelegatedScope(), Token: *test.cached}
+				if err := cache.Put(entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			source := &CachedTokenSource{Cache: cache, TenantID: "tenant-id", ClientID: "client-id", Scope: DelegatedScope(), Fetch: test.fetch}
+			token, err := source.Token()
+			if !errors.Is(err, test.wantErr) || token != test.want {
+				t.Errorf("token is %q (%v), want %q (%v)", token, err, test.want, test.wantErr)
+			}
+
+			if test.refresh != "" && len(*forms) != 1 {
+				t.Errorf("sent %d refresh requests, want 1", len(*forms))
+			}
+
+			entry, err := cache.Get("tenant-id", "client-id", DelegatedScope())
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case test.wantCached == "" && entry != nil:
+				t.Errorf("cached %+v, want nothing", entry)
+			case test.wantCached != "" && (entry == nil || entry.AccessToken != test.wantCached):
+				t.Errorf("cached %+v, want access token %q", entry, test.wantCached)
+			}
+			// A refresh response without a refresh token keeps the one used
+			if test.refresh != "" && entry != nil && entry.RefreshToken != "refresh" {
+				t.Errorf("cached refresh token is %q, want it kept", entry.RefreshToken)
+			}
+		})
+	}
+}
+
+func TestCachedTokenSourceRefreshFails(t *testing.T) {
+	tokenServer(t, tokenError("invalid_grant"))
+
+	cache := newTestCache(t)
+	expired := &CacheEntry{TenantID: "tenant-id", ClientID: "client-id", Scope: DelegatedScope(),
+		Token: Token{AccessToken: "cached", RefreshToken: "refresh", ExpiresAt: time.Now().Add(-time.Hour)}}
+	if err := cache.Put(expired); err != nil {
+		t.Fatal(err)
+	}
+
+	// A rejected refresh token asks for a new sign-in rather than falling back to Fetch
+	source := &CachedTokenSource{Cache: cache, TenantID: "tenant-id", ClientID: "client-id", Scope: DelegatedScope(), Fetch: fetchNever(t)}
+	_, err := source.Token()
+	var tokenErr *TokenError
+	if !errors.As(err, &tokenErr) || tokenErr.Code != "invalid_grant" || !strings.Contains(err.Error(), "gua login") {
+		t.Errorf("error is %v, want the rejected refresh and a hint to sign in again", err)
+	}
+}
+
+func fetchToken(accessToken string) func() (*Token, error) {
+	return func() (*Token, error) {
+		return &Token{AccessToken: accessToken, ExpiresAt: time.Now().Add(time.Hour)}, nil
+	}
+}
+
+func fetchNever(t *testing.T) func() (*Token, error) {
+	return func() (*Token, error) {
+		t.Error("Fetch was called for a delegated sign-in")
+		return nil, errors.New("unexpected fetch")
+	}
+}
+
+func TestCacheEntries(t *testing.T) {
+	cache := newTestCache(t)
+
+	if entries, err := cache.Entries(); err != nil || len(entries) != 0 {
+		t.Fatalf("missing cache has entries %v (%v)", entries, err)
+	}
+
+	for _, entry := range []*CacheEntry{
+		{TenantID: "tenant-b", ClientID: "client", Scope: "scope", Token: Token{AccessToken: "b"}},
+		{TenantID: "tenant-a", ClientID: "client", Scope: "scope-1", Token: Token{AccessToken: "a1"}},
+		{TenantID: "tenant-a", ClientID: "client", Scope: "scope-2", Token: Token{AccessToken: "a2"}},
+		// Tenant and client IDs are not case sensitive, so this replaces the first entry
+		{TenantID: "TENANT-B", ClientID: "CLIENT", Scope: "scope", Token: Token{AccessToken: "b2"}},
+	} {
+		if err := cache.Put(entry); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(cache.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != 0600 {
+			t.Errorf("cache file mode is %v, want 0600", mode)
+		}
+	}
+
+	tokens := func() []string {
+		entries, err := cache.Entries()
+		if err != nil {
+			t.Fatalf("Entries: %v", err)
+		}
+		var tokens []string
+		for _, entry := range entries {
+			tokens = append(tokens, entry.AccessToken)
+		}
+		return tokens
+	}
+	if got := tokens(); len(got) != 3 || got[0] != "a1" || got[1] != "a2" || got[2] != "b2" {
+		t.Errorf("entries are %v, want a1, a2, b2", got)
+	}
+
+	if removed, err := cache.Remove("Tenant-A", "client"); err != nil || removed != 2 {
+		t.Errorf("Remove removed %d (%v), want 2", removed, err)
+	}
+	if removed, err := cache.Remove("tenant-c", "client"); err != nil || removed != 0 {
+		t.Errorf("Remove of an unknown tenant removed %d (%v)", removed, err)
+	}
+	if got := tokens(); len(got) != 1 || got[0] != "b2" {
+		t.Errorf("entries after Remove are %v, want b2", got)
+	}
+
+	if err := cache.Clear(); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	if _, err := os.Stat(cache.Path); !os.IsNotExist(err) {
+		t.Errorf("cache file still exists after Clear: %v", err)
+	}
+	if err := cache.Clear(); err != nil {
+		t.Errorf("Clear of a missing cache: %v", err)
+	}
+}
+
+func TestCacheRejectsCorruptFile(t *testing.T) {
+	cache := newTestCache(t)
+	if err := os.MkdirAll(filepath.Dir(cache.Path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cache.Path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cache.Get("tenant-id", "client-id", "scope"); err == nil {
+		t.Error("Get read a corrupt cache")
+	}
+	if err := cache.Put(&CacheEntry{TenantID: "tenant-id", ClientID: "client-id", Scope: "scope"}); err == nil {
+		t.Error("Put overwrote a corrupt cache")
+	}
+}
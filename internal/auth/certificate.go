@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// assertionLifetime is how long a signed client assertion stays valid
+const assertionLifetime = 10 * time.Minute
+
+// Certificate is an application certificate used to sign client assertions
+type Certificate struct {
+	PrivateKey *rsa.PrivateKey
+	// Thumbprint is the SHA-1 hash of the DER-encoded certificate, as shown in the Azure portal
+	Thumbprint []byte
+}
+
+// LoadCertificate reads a private key and certificate from a PEM or PFX (PKCS#12) file.
+// Files ending in .pfx or .p12 are decoded with password; anything else is read as PEM.
+// thumbprint (hex) is only needed when a PEM file holds the private key without its certificate.
+func LoadCertificate(path, password, thumbprint string) (*Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate file: %w", err)
+	}
+
+	var cert *Certificate
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pfx", ".p12":
+		cert, err = parsePFX(data, password)
+	default:
+		cert, err = parsePEM(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if thumbprint != "" {
+		cert.Thumbprint, err = hex.DecodeString(strings.ReplaceAll(thumbprint, ":", ""))
+		if err != nil || len(cert.Thumbprint) != sha1.Size {
+			return nil, fmt.Errorf("certificate thumbprint must be a 40-character hex SHA-1 hash")
+		}
+	}
+	if cert.Thumbprint == nil {
+		return nil, fmt.Errorf("certificate file %s contains no certificate; set certificateThumbprint in config", path)
+	}
+
+	return cert, nil
+}
+
+// parsePFX decodes a PKCS#12 bundle holding an RSA key, its certificate and, as most exported
+// files do, the certificates of its chain
+func parsePFX(data []byte, password string) (*Certificate, error) {
+	key, leaf, _, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode PFX file (check certificatePassword): %w", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("PFX private key must be RSA")
+	}
+
+	thumbprint := sha1.Sum(leaf.Raw)
+	return &Certificate{PrivateKey: rsaKey, Thumbprint: thumbprint[:]}, nil
+}
+
+// parsePEM reads an unencrypted RSA private key and, optionally, its certificate
+func parsePEM(data []byte) (*Certificate, error) {
+	cert := &Certificate{}
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "CERTIFICATE":
+			// The first certificate is the application's own; the rest are the chain
+			if cert.Thumbprint == nil {
+				thumbprint := sha1.Sum(block.Bytes)
+				cert.Thumbprint = thumbprint[:]
+			}
+		case "RSA PRIVATE KEY":
+			key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse private key: %w", err)
+			}
+			cert.PrivateKey = key
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse private key: %w", err)
+			}
+			rsaKey, ok := key.(*rsa.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("private key must be RSA")
+			}
+			cert.PrivateKey = rsaKey
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, errors.New("encrypted PEM private keys are not supported; use a PFX file with certificatePassword")
+		}
+	}
+
+	if cert.PrivateKey == nil {
+		return nil, errors.New("certificate file contains no private key")
+	}
+
+	return cert, nil
+}
+
+// clientAssertion builds the signed JWT that proves the application's identity to the token endpoint
+func (c *Certificate) clientAssertion(clientID, audience string) (string, error) {
+	now := time.Now()
+
+	header := map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"x5t": base64.RawURLEncoding.EncodeToString(c.Thumbprint),
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	claims := map[string]interface{}{
+		"aud": audience,
+		"iss": clientID,
+		"sub": clientID,
+		"jti": hex.EncodeToString(jti),
+		"nbf": now.Unix(),
+		"iat": now.Unix(),
+		"exp": now.Add(assertionLifetime).Unix(),
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, c.PrivateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
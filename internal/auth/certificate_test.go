@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// testChain is an application certificate issued by a test CA
+type testChain struct {
+	key  *rsa.PrivateKey
+	leaf *x509.Certificate
+	ca   *x509.Certificate
+}
+
+func newTestChain(t *testing.T) testChain {
+	t.Helper()
+
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "gua"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testChain{key: key, leaf: leaf, ca: ca}
+}
+
+func (c testChain) thumbprint() []byte {
+	sum := sha1.Sum(c.leaf.Raw)
+	return sum[:]
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadCertificatePFXWithChain(t *testing.T) {
+	chain := newTestChain(t)
+	pfx, err := pkcs12.Modern.Encode(chain.key, chain.leaf, []*x509.Certificate{chain.ca}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeFile(t, "app.pfx", pfx)
+
+	cert, err := LoadCertificate(path, "secret", "")
+	if err != nil {
+		t.Fatalf("LoadCertificate: %v", err)
+	}
+	if !cert.PrivateKey.Equal(chain.key) {
+		t.Error("private key differs from the one in the PFX file")
+	}
+	if string(cert.Thumbprint) != string(chain.thumbprint()) {
+		t.Errorf("thumbprint is %x, want %x (the application certificate, not the CA)", cert.Thumbprint, chain.thumbprint())
+	}
+
+	if _, err := LoadCertificate(path, "wrong", ""); err == nil {
+		t.Error("LoadCertificate with a wrong password succeeded")
+	}
+}
+
+func TestLoadCertificatePEMWithChain(t *testing.T) {
+	chain := newTestChain(t)
+	var data []byte
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(chain.key)})...)
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: chain.leaf.Raw})...)
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: chain.ca.Raw})...)
+	path := writeFile(t, "app.pem", data)
+
+	cert, err := LoadCertificate(path, "", "")
+	if err != nil {
+		t.Fatalf("LoadCertificate: %v", err)
+	}
+	if string(cert.Thumbprint) != string(chain.thumbprint()) {
+		t.Errorf("thumbprint is %x, want %x", cert.Thumbprint, chain.thumbprint())
+	}
+}
+
+func TestGetAccessTokenWithCertificate(t *testing.T) {
+	chain := newTestChain(t)
+	cert := &Certificate{PrivateKey: chain.key, Thumbprint: chain.thumbprint()}
+
+	var endpoint string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tenant-id/oauth2/v2.0/token" {
+			t.Errorf("token request sent to %s", r.URL.Path)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range map[string]string{
+			"client_id":             "client-id",
+			"grant_type":            "client_credentials",
+			"scope":                 GraphScope(),
+			"client_assertion_type": "urn:ietf:params:oauth:client-assertion-type:jwt-bearer",
+		} {
+			if got := r.PostForm.Get(name); got != want {
+				t.Errorf("%s is %q, want %q", name, got, want)
+			}
+		}
+		if r.PostForm.Get("client_secret") != "" {
+			t.Error("a client secret was sent with the certificate assertion")
+		}
+
+		checkAssertion(t, r.PostForm.Get("client_assertion"), chain, endpoint)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"token-value","expires_in":3600}`))
+	}))
+	defer srv.Close()
+
+	defer func(host string) { AuthorityHost = host }(AuthorityHost)
+	AuthorityHost = srv.URL
+	endpoint = srv.URL + "/tenant-id/oauth2/v2.0/token"
+
+	token, err := GetAccessTokenWithCertificate("tenant-id", "client-id", cert)
+	if err != nil {
+		t.Fatalf("GetAccessTokenWithCertificate: %v", err)
+	}
+	if token.AccessToken != "token-value" {
+		t.Errorf("access token is %q", token.AccessToken)
+	}
+	if until := time.Until(token.ExpiresAt); until < 59*time.Minute || until > time.Hour {
+		t.Errorf("token expires in %v, want about an hour", until)
+	}
+}
+
+// checkAssertion verifies the client assertion's signature, header and claims
+func checkAssertion(t *testing.T, assertion string, chain testChain, audience string) {
+	t.Helper()
+
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		t.Fatalf("client assertion has %d parts, want 3", len(parts))
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("failed to decode signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&chain.key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+
+	var header map[string]string
+	decodeSegment(t, parts[0], &header)
+	if header["alg"] != "RS256" || header["typ"] != "JWT" {
+		t.Errorf("header is %v, want alg RS256 and typ JWT", header)
+	}
+	if want := base64.RawURLEncoding.EncodeToString(chain.thumbprint()); header["x5t"] != want {
+		t.Errorf("x5t is %q, want %q", header["x5t"], want)
+	}
+
+	var claims struct {
+		Audience  string `json:"aud"`
+		Issuer    string `json:"iss"`
+		Subject   string `json:"sub"`
+		ID        string `json:"jti"`
+		NotBefore int64  `json:"nbf"`
+		IssuedAt  int64  `json:"iat"`
+		Expires   int64  `json:"exp"`
+	}
+	decodeSegment(t, parts[1], &claims)
+	if claims.Audience != audience {
+		t.Errorf("aud is %q, want the token endpoint %q", claims.Audience, audience)
+	}
+	if claims.Issuer != "client-id" || claims.Subject != "client-id" {
+		t.Errorf("iss and sub are %q and %q, want the client ID", claims.Issuer, claims.Subject)
+	}
+	if len(claims.ID) != 32 {
+		t.Errorf("jti is %q, want 16 random bytes in hex", claims.ID)
+	}
+	now := time.Now().Unix()
+	if claims.NotBefore > now || claims.IssuedAt > now || now-claims.IssuedAt > 60 {
+		t.Errorf("nbf %d and iat %d are not the current time %d", claims.NotBefore, claims.IssuedAt, now)
+	}
+	if lifetime := claims.Expires - claims.IssuedAt; lifetime != int64(assertionLifetime/time.Second) {
+		t.Errorf("assertion is valid for %ds, want %v", lifetime, assertionLifetime)
+	}
+}
+
+func decodeSegment(t *testing.T, segment string, out interface{}) {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		t.Fatalf("failed to decode JWT segment: %v", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatalf("failed to parse JWT segment %s: %v", data, err)
+	}
+}
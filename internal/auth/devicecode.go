@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// delegatedPermissions are the Graph permissions requested when an administrator signs in
+var delegatedPermissions = []string{
+	"User.ReadWrite.All",
+	"Group.ReadWrite.All",
+	"Directory.ReadWrite.All",
+}
+
+// DelegatedScopes returns the scopes requested when an administrator signs in with the device code flow.
+// offline_access returns a refresh token so the sign-in outlives the one-hour access token.
+func DelegatedScopes() []string {
+	scopes := make([]string, 0, len(delegatedPermissions)+3)
+	for _, permission := range delegatedPermissions {
+		scopes = append(scopes, GraphResource+"/"+permission)
+	}
+	return append(scopes, "openid", "profile", "offline_access")
+}
+
+// DelegatedScope returns DelegatedScopes as the space-separated scope string used in token requests
+func DelegatedScope() string {
+	return strings.Join(DelegatedScopes(), " ")
+}
+
+// sleep waits between polls; tests replace it to run without waiting
+var sleep = time.Sleep
+
+// DeviceCode is the pending sign-in returned by the device authorization endpoint
+type DeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+	// Message tells the user where to go and which code to enter
+	Message string `json:"message"`
+}
+
+// RequestDeviceCode starts a device code sign-in for the given delegated scopes
+func RequestDeviceCode(tenantID, clientID string, scopes []string) (*DeviceCode, error) {
+	endpoint := fmt.Sprintf("%s/%s/oauth2/v2.0/devicecode", strings.TrimSuffix(AuthorityHost, "/"), tenantID)
+
+	data := url.Values{}
+	data.Set("client_id", clientID)
+	data.Set("scope", strings.Join(scopes, " "))
+
+	body, err := postForm(endpoint, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var deviceCode DeviceCode
+	if err := json.Unmarshal(body, &deviceCode); err != nil {
+		return nil, fmt.Errorf("failed to parse device code response: %w", err)
+	}
+
+	return &deviceCode, nil
+}
+
+// PollDeviceCode waits until the user completes (or abandons) the sign-in started by RequestDeviceCode
+func PollDeviceCode(tenantID, clientID string, deviceCode *DeviceCode) (*Token, error) {
+	interval := time.Duration(deviceCode.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(deviceCode.ExpiresIn) * time.Second)
+
+	data := url.Values{}
+	data.Set("client_id", clientID)
+	data.Set("grant_type", "urn:ietf:params:oauth:grant-type:device_code")
+	data.Set("device_code", deviceCode.DeviceCode)
+
+	for time.Now().Before(deadline) {
+		sleep(interval)
+
+		token, err := requestToken(tokenEndpoint(tenantID), data)
+		if err == nil {
+			return token, nil
+		}
+
+		var tokenErr *TokenError
+		if !errors.As(err, &tokenErr) {
+			return nil, err
+		}
+		switch tokenErr.Code {
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5 * time.Second
+			continue
+		case "authorization_declined":
+			return nil, errors.New("sign-in was declined")
+		case "expired_token":
+			return nil, errors.New("the device code expired before sign-in completed; run 'gua login' again")
+		}
+		return nil, err
+	}
+
+	return nil, errors.New("the device code expired before sign-in completed; run 'gua login' again")
+}
+
+// RefreshAccessToken redeems a refresh token for a new access token (and usually a new refresh token)
+func RefreshAccessToken(tenantID, clientID, refreshToken string, scopes []string) (*Token, error) {
+	data := url.Values{}
+	data.Set("client_id", clientID)
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", refreshToken)
+	data.Set("scope", strings.Join(scopes, " "))
+
+	token, err := requestToken(tokenEndpoint(tenantID), data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refresh responses carry no ID token, and the refresh token is not always rotated
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	return token, nil
+}
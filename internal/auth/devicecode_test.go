@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokenServer answers each token request with the next of responses and records the posted forms
+func tokenServer(t *testing.T, responses ...string) *[]map[string]string {
+	t.Helper()
+
+	var forms []map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tenant-id/oauth2/v2.0/token" {
+			t.Errorf("token request sent to %s", r.URL.Path)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		form := map[string]string{}
+		for name := range r.PostForm {
+			form[name] = r.PostForm.Get(name)
+		}
+		forms = append(forms, form)
+
+		if len(forms) > len(responses) {
+			t.Errorf("unexpected token request %d", len(forms))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		response := responses[len(forms)-1]
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(response, `"error"`) {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(srv.Close)
+
+	host := AuthorityHost
+	AuthorityHost = srv.URL
+	t.Cleanup(func() { AuthorityHost = host })
+	return &forms
+}
+
+func tokenError(code string) string {
+	return fmt.Sprintf(`{"error":%q,"error_description":"AADSTS: %s"}`, code, code)
+}
+
+func TestPollDeviceCode(t *testing.T) {
+	const signedIn = `{"access_token":"access","refresh_token":"refresh","expires_in":3600}`
+
+	tests := []struct {
+		name      string
+		responses []string
+		// waits are the intervals slept before each poll
+		waits   []time.Duration
+		wantErr string
+	}{
+		{"signed in", []string{signedIn}, []time.Duration{2 * time.Second}, ""},
+		{"pending", []string{tokenError("authorization_pending"), tokenError("authorization_pending"), signedIn},
+			[]time.Duration{2 * time.Second, 2 * time.Second, 2 * time.Second}, ""},
+		{"slow down", []string{tokenError("slow_down"), tokenError("authorization_pending"), tokenError("slow_down"), signedIn},
+			[]time.Duration{2 * time.Second, 7 * time.Second, 7 * time.Second, 12 * time.Second}, ""},
+		{"declined", []string{tokenError("authorization_pending"), tokenError("authorization_declined")},
+			[]time.Duration{2 * time.Second, 2 * time.Second}, "declined"},
+		{"expired", []string{tokenError("expired_token")}, []time.Duration{2 * time.Second}, "expired"},
+		{"other error", []string{tokenError("invalid_grant")}, []time.Duration{2 * time.Second}, "invalid_grant"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			forms := tokenServer(t, test.responses...)
+
+			var waits []time.Duration
+			defer func(saved func(time.Duration)) { sleep = saved }(sleep)
+			sleep = func(d time.Duration) { waits = append(waits, d) }
+
+			deviceCode := &DeviceCode{DeviceCode: "device-code", ExpiresIn: 900, Interval: 2}
+			token, err := PollDeviceCode("tenant-id", "client-id", deviceCode)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("error is %v, want one about %s", err, test.wantErr)
+				}
+			} else if err != nil || token.AccessToken != "access" || token.RefreshToken != "refresh" {
+				t.Errorf("token is %+v (%v)", token, err)
+			}
+
+			if fmt.Sprint(waits) != fmt.Sprint(test.waits) {
+				t.Errorf("waited %v, want %v", waits, test.waits)
+			}
+			for _, form := range *forms {
+				if form["grant_type"] != "urn:ietf:params:oauth:grant-type:device_code" || form["device_code"] != "device-code" || form["client_id"] != "client-id" {
+					t.Errorf("poll form is %v", form)
+				}
+			}
+		})
+	}
+}
+
+func TestPollDeviceCodeDefaultInterval(t *testing.T) {
+	tokenServer(t, `{"access_token":"access","expires_in":3600}`)
+
+	var waits []time.Duration
+	defer func(saved func(time.Duration)) { sleep = saved }(sleep)
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+
+	if _, err := PollDeviceCode("tenant-id", "client-id", &DeviceCode{DeviceCode: "device-code", ExpiresIn: 900}); err != nil {
+		t.Fatalf("PollDeviceCode: %v", err)
+	}
+	if len(waits) != 1 || waits[0] != 5*time.Second {
+		t.Errorf("waited %v, want 5s without an interval from the server", waits)
+	}
+}
+
+func TestRefreshAccessToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		response    string
+		wantRefresh string
+		wantErr     string
+	}{
+		{"rotated", `{"access_token":"new-access","refresh_token":"new-refresh","expires_in":3600}`, "new-refresh", ""},
+		{"not rotated", `{"access_token":"new-access","expires_in":3600}`, "old-refresh", ""},
+		{"rejected", tokenError("invalid_grant"), "", "invalid_grant"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			forms := tokenServer(t, test.response)
+
+			token, err := RefreshAccessToken("tenant-id", "client-id", "old-refresh", DelegatedScopes())
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("error is %v, want one about %s", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RefreshAccessToken: %v", err)
+			}
+			if token.AccessToken != "new-access" || token.RefreshToken != test.wantRefresh {
+				t.Errorf("token is %+v, want refresh token %q", token, test.wantRefresh)
+			}
+
+			form := (*forms)[0]
+			if form["grant_type"] != "refresh_token" || form["refresh_token"] != "old-refresh" || form["scope"] != DelegatedScope() {
+				t.Errorf("refresh form is %v", form)
+			}
+		})
+	}
+}
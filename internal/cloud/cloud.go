@@ -0,0 +1,75 @@
+package cloud
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Environment is a Microsoft cloud: the identity platform that issues tokens and the Graph endpoint that accepts them
+type Environment struct {
+	Name          string
+	AuthorityHost string
+	GraphEndpoint string
+}
+
+// GraphBaseURL returns the Graph v1.0 API root for the cloud
+func (e Environment) GraphBaseURL() string {
+	return e.GraphEndpoint + "/v1.0"
+}
+
+var (
+	// Global is the worldwide Microsoft cloud (including GCC)
+	Global = Environment{
+		Name:          "global",
+		AuthorityHost: "https://login.microsoftonline.com",
+		GraphEndpoint: "https://graph.microsoft.com",
+	}
+	// USGov is Microsoft 365 GCC High
+	USGov = Environment{
+		Name:          "usgov",
+		AuthorityHost: "https://login.microsoftonline.us",
+		GraphEndpoint: "https://graph.microsoft.us",
+	}
+	// USGovDoD is Microsoft 365 DoD
+	USGovDoD = Environment{
+		Name:          "usgovdod",
+		AuthorityHost: "https://login.microsoftonline.us",
+		GraphEndpoint: "https://dod-graph.microsoft.us",
+	}
+	// China is Microsoft 365 operated by 21Vianet
+	China = Environment{
+		Name:          "china",
+		AuthorityHost: "https://login.chinacloudapi.cn",
+		GraphEndpoint: "https://microsoftgraph.chinacloudapi.cn",
+	}
+)
+
+// environments lists the supported clouds in the order they are shown to users
+var environments = []Environment{Global, USGov, USGovDoD, China}
+
+// Names returns the names accepted by Lookup
+func Names() []string {
+	names := make([]string, len(environments))
+	for i, env := range environments {
+		names[i] = env.Name
+	}
+	return names
+}
+
+// Lookup returns the cloud with the given name; an empty name is the global cloud
+func Lookup(name string) (Environment, error) {
+	if name == "" {
+		return Global, nil
+	}
+
+	for _, env := range environments {
+		if strings.EqualFold(env.Name, name) {
+			return env, nil
+		}
+	}
+
+	if strings.EqualFold(name, "germany") {
+		return Environment{}, fmt.Errorf("Microsoft Cloud Deutschland has been retired and its tenants migrated to the global cloud; use cloud \"global\"")
+	}
+	return Environment{}, fmt.Errorf("unknown cloud %q: use one of %s", name, strings.Join(Names(), ", "))
+}
@@ -1,50 +1,155 @@
 package config
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
+
+	"GraphUserAdmin/internal/cloud"
+)
+
+// Credential types select how gua authenticates
+const (
+	// CredentialSecret authenticates as the application with clientSecret
+	CredentialSecret = "secret"
+	// CredentialCertificate authenticates as the application with the certificate at certificatePath
+	CredentialCertificate = "certificate"
+	// CredentialDelegated acts as the administrator who signed in with 'gua login'
+	CredentialDelegated = "delegated"
 )
 
-// Config holds the application configuration
+// Config holds the settings of one profile.
+// Every field can be overridden with the environment variable named in its env tag.
 type Config struct {
-	TenantID     string `json:"tenantId"`
-	ClientID     string `json:"clientId"`
-	ClientSecret string `json:"clientSecret"`
+	// Name is the profile these settings were loaded from
+	Name string `json:"-"`
+
+	TenantID     string `json:"tenantId" env:"GUA_TENANT_ID"`
+	ClientID     string `json:"clientId" env:"GUA_CLIENT_ID"`
+	ClientSecret string `json:"clientSecret,omitempty" env:"GUA_CLIENT_SECRET"`
+
+	// SecretCommand is run when clientSecret is not set; its standard output is used as the secret
+	// (or as certificatePassword for certificate authentication). Use it with pass, a vault CLI or a keyring helper.
+	SecretCommand string `json:"secretCommand,omitempty" env:"GUA_SECRET_COMMAND"`
+
+	// CredentialType is "secret", "certificate" or "delegated". When empty it is
+	// inferred: certificate if certificatePath is set, otherwise secret.
+	CredentialType string `json:"credentialType,omitempty" env:"GUA_CREDENTIAL_TYPE"`
+
+	// CertificatePath selects certificate authentication instead of a client secret.
+	// It points at a PEM file (private key plus certificate) or a password-protected PFX file.
+	CertificatePath       string `json:"certificatePath,omitempty" env:"GUA_CERTIFICATE_PATH"`
+	CertificatePassword   string `json:"certificatePassword,omitempty" env:"GUA_CERTIFICATE_PASSWORD"`
+	CertificateThumbprint string `json:"certificateThumbprint,omitempty" env:"GUA_CERTIFICATE_THUMBPRINT"`
+
+	// MaxRetries is how many times a throttled (429) or unavailable (503/504) request is retried
+	MaxRetries *int `json:"maxRetries,omitempty" env:"GUA_MAX_RETRIES"`
+	// MaxRetryWaitSeconds caps a single wait between retries
+	MaxRetryWaitSeconds int `json:"maxRetryWaitSeconds,omitempty" env:"GUA_MAX_RETRY_WAIT_SECONDS"`
+
+	// Output is the default output format for this profile
+	Output string `json:"output,omitempty" env:"GUA_OUTPUT"`
+	// Cloud is the Microsoft cloud the tenant lives in: global (default), usgov, usgovdod or china
+	Cloud string `json:"cloud,omitempty" env:"GUA_CLOUD"`
+
+	// AuditLog is the path of the audit log of changes made with this profile. Empty uses the
+	// default location in the user's config directory; "off" disables auditing.
+	AuditLog string `json:"auditLog,omitempty" env:"GUA_AUDIT_LOG"`
 }
 
-// LoadConfig reads and parses the configuration file
-func LoadConfig(path string) (*Config, error) {
+// AuditLogOff disables the audit log when used as auditLog
+const AuditLogOff = "off"
+
+// LoadConfig reads the configuration file, selects a profile and applies environment variable
+// overrides. profile may be empty to use GUA_PROFILE or the file's default profile.
+// The file may be absent when the environment supplies every required setting.
+func LoadConfig(path, profile string) (*Config, error) {
 	// Check if file exists
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return nil, fmt.Errorf("config file not found: %s\n\nPlease create a config.json file with your Azure AD credentials.\nSee config.json.example for the required format", path)
+	_, statErr := os.Stat(path)
+	fileMissing := os.IsNotExist(statErr)
+
+	if profile == "" {
+		profile = os.Getenv("GUA_PROFILE")
+	}
+
+	var cfg *Config
+	if fileMissing {
+		cfg = &Config{}
+	} else {
+		file, err := ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		cfg, err = file.Select(profile)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	data, err := os.ReadFile(path)
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	missingFields, err := cfg.validate()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
 	}
 
-	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w\n\nEnsure the file contains valid JSON", err)
+	if len(missingFields) > 0 {
+		if fileMissing {
+			return nil, fmt.Errorf("config file not found: %s\n\nPlease create a config.json file with your Azure AD credentials,\nor set them with environment variables (GUA_TENANT_ID, GUA_CLIENT_ID, GUA_CLIENT_SECRET).\nSee config.json.example for the required format", path)
+		}
+		return nil, fmt.Errorf("profile %q is missing required fields: %v\n\nSet them in the file or with GUA_* environment variables.\nSee config.json.example for the required format", cfg.Name, missingFields)
 	}
 
+	return cfg, nil
+}
+
+// validate checks the settings and returns the names of required fields that are missing
+func (c *Config) validate() ([]string, error) {
 	// Validate required fields with specific error messages
 	var missingFields []string
-	if cfg.TenantID == "" {
+	if c.TenantID == "" {
 		missingFields = append(missingFields, "tenantId")
 	}
-	if cfg.ClientID == "" {
+	if c.ClientID == "" {
 		missingFields = append(missingFields, "clientId")
 	}
-	if cfg.ClientSecret == "" {
-		missingFields = append(missingFields, "clientSecret")
+	switch c.Credential() {
+	case CredentialSecret:
+		if c.ClientSecret == "" && c.SecretCommand == "" {
+			missingFields = append(missingFields, "clientSecret (or secretCommand or certificatePath)")
+		}
+	case CredentialCertificate:
+		if c.CertificatePath == "" {
+			missingFields = append(missingFields, "certificatePath")
+		}
+	case CredentialDelegated:
+		// 'gua login' supplies the credential
+	default:
+		return nil, fmt.Errorf("unknown credentialType %q: use %q, %q or %q", c.CredentialType, CredentialSecret, CredentialCertificate, CredentialDelegated)
 	}
 
-	if len(missingFields) > 0 {
-		return nil, fmt.Errorf("config file is missing required fields: %v\n\nSee config.json.example for the required format", missingFields)
+	if _, err := cloud.Lookup(c.Cloud); err != nil {
+		return nil, err
 	}
 
-	return &cfg, nil
+	if c.MaxRetries != nil && *c.MaxRetries < 0 {
+		return nil, fmt.Errorf("maxRetries must not be negative")
+	}
+	if c.MaxRetryWaitSeconds < 0 {
+		return nil, fmt.Errorf("maxRetryWaitSeconds must not be negative")
+	}
+
+	return missingFields, nil
+}
+
+// Credential returns the effective credential type
+func (c *Config) Credential() string {
+	if c.CredentialType != "" {
+		return c.CredentialType
+	}
+	if c.CertificatePath != "" {
+		return CredentialCertificate
+	}
+	return CredentialSecret
 }
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv overrides the fields of the struct target points to from the environment variables
+// named in their env tags. Variables that are unset are ignored; a variable set to an empty string
+// clears the field. Strings, whole numbers (plain or pointer), durations and booleans are supported.
+func applyEnv(target interface{}) error {
+	v := reflect.ValueOf(target).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		field := v.Field(i)
+		if value == "" {
+			field.Set(reflect.Zero(field.Type()))
+			continue
+		}
+
+		switch {
+		case field.Kind() == reflect.String:
+			field.SetString(value)
+		case field.Type() == durationType:
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%s must be a duration such as 30s or 2m: %w", name, err)
+			}
+			field.SetInt(int64(d))
+		case field.Kind() == reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s must be a whole number: %w", name, err)
+			}
+			field.SetInt(int64(n))
+		case field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s must be a whole number: %w", name, err)
+			}
+			field.Set(reflect.ValueOf(&n))
+		case field.Kind() == reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%s must be true or false: %w", name, err)
+			}
+			field.SetBool(b)
+		default:
+			return fmt.Errorf("%s: unsupported setting type %s", name, field.Type())
+		}
+	}
+
+	return nil
+}
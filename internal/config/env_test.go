@@ -0,0 +1,96 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// envSettings has one field of each type applyEnv supports
+type envSettings struct {
+	Name    string        `env:"GUA_TEST_NAME"`
+	Count   int           `env:"GUA_TEST_COUNT"`
+	Limit   *int          `env:"GUA_TEST_LIMIT"`
+	Wait    time.Duration `env:"GUA_TEST_WAIT"`
+	Enabled bool          `env:"GUA_TEST_ENABLED"`
+	Ignored string
+}
+
+func TestApplyEnv(t *testing.T) {
+	limit := 7
+	start := envSettings{Name: "file", Count: 3, Limit: &limit, Wait: time.Minute, Enabled: true, Ignored: "kept"}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want func(s envSettings) bool
+	}{
+		{"unset keeps file values", nil, func(s envSettings) bool {
+			return s.Name == "file" && s.Count == 3 && *s.Limit == 7 && s.Wait == time.Minute && s.Enabled
+		}},
+		{"string", map[string]string{"GUA_TEST_NAME": "env"}, func(s envSettings) bool { return s.Name == "env" }},
+		{"int", map[string]string{"GUA_TEST_COUNT": "12"}, func(s envSettings) bool { return s.Count == 12 }},
+		{"pointer to int", map[string]string{"GUA_TEST_LIMIT": "0"}, func(s envSettings) bool { return s.Limit != nil && *s.Limit == 0 }},
+		{"duration", map[string]string{"GUA_TEST_WAIT": "90s"}, func(s envSettings) bool { return s.Wait == 90*time.Second }},
+		{"bool", map[string]string{"GUA_TEST_ENABLED": "false"}, func(s envSettings) bool { return !s.Enabled }},
+		{"empty clears every type", map[string]string{
+			"GUA_TEST_NAME": "", "GUA_TEST_COUNT": "", "GUA_TEST_LIMIT": "", "GUA_TEST_WAIT": "", "GUA_TEST_ENABLED": "",
+		}, func(s envSettings) bool {
+			return s.Name == "" && s.Count == 0 && s.Limit == nil && s.Wait == 0 && !s.Enabled
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+
+			settings := start
+			if err := applyEnv(&settings); err != nil {
+				t.Fatalf("applyEnv: %v", err)
+			}
+			if !test.want(settings) || settings.Ignored != "kept" {
+				t.Errorf("settings are %+v", settings)
+			}
+		})
+	}
+}
+
+func TestApplyEnvRejectsInvalidValues(t *testing.T) {
+	for name, value := range map[string]string{
+		"GUA_TEST_COUNT":   "three",
+		"GUA_TEST_LIMIT":   "1.5",
+		"GUA_TEST_WAIT":    "90",
+		"GUA_TEST_ENABLED": "maybe",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+
+			var settings envSettings
+			err := applyEnv(&settings)
+			if err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("error is %v, want one naming %s", err, name)
+			}
+		})
+	}
+}
+
+func TestApplyEnvToConfig(t *testing.T) {
+	t.Setenv("GUA_TENANT_ID", "env-tenant")
+	t.Setenv("GUA_CLIENT_SECRET", "")
+	t.Setenv("GUA_MAX_RETRIES", "2")
+	t.Setenv("GUA_MAX_RETRY_WAIT_SECONDS", "")
+
+	cfg := &Config{TenantID: "file-tenant", ClientID: "file-client", ClientSecret: "file-secret", MaxRetryWaitSeconds: 30}
+	if err := applyEnv(cfg); err != nil {
+		t.Fatalf("applyEnv: %v", err)
+	}
+
+	if cfg.TenantID != "env-tenant" || cfg.ClientID != "file-client" || cfg.ClientSecret != "" {
+		t.Errorf("string settings are %q, %q, %q", cfg.TenantID, cfg.ClientID, cfg.ClientSecret)
+	}
+	if cfg.MaxRetries == nil || *cfg.MaxRetries != 2 || cfg.MaxRetryWaitSeconds != 0 {
+		t.Errorf("retry settings are %v, %d", cfg.MaxRetries, cfg.MaxRetryWaitSeconds)
+	}
+}
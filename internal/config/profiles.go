@@ -0,0 +1,119 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"GraphUserAdmin/internal/fileutil"
+)
+
+// LegacyProfileName is the profile name given to a config file written before profiles existed
+const LegacyProfileName = "default"
+
+// File is the on-disk configuration: named profiles and the one used when --profile is not given
+type File struct {
+	DefaultProfile string             `json:"defaultProfile,omitempty"`
+	Profiles       map[string]*Config `json:"profiles"`
+}
+
+// ReadFile reads a configuration file. A file with a single flat set of settings (the original
+// format) is read as one profile named "default". A missing file is an empty configuration.
+func ReadFile(path string) (*File, error) {
+	file := &File{Profiles: map[string]*Config{}}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return file, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var probe struct {
+		Profiles json.RawMessage `json:"profiles"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w\n\nEnsure the file contains valid JSON", err)
+	}
+
+	if probe.Profiles == nil {
+		var legacy Config
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w\n\nEnsure the file contains valid JSON", err)
+		}
+		file.Profiles[LegacyProfileName] = &legacy
+		file.DefaultProfile = LegacyProfileName
+		return file, nil
+	}
+
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w\n\nEnsure the file contains valid JSON", err)
+	}
+	if file.Profiles == nil {
+		file.Profiles = map[string]*Config{}
+	}
+	return file, nil
+}
+
+// Save writes the configuration in profiles format. The file may hold secrets, so only the
+// current user can read it.
+func (f *File) Save(path string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode config file: %w", err)
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create config directory: %w", err)
+		}
+	}
+
+	// Replace a symlinked config file's target rather than the link
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+
+	// The permissions of an existing file are tightened too
+	if err := fileutil.WriteFileAtomic(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// Names returns the profile names in sorted order
+func (f *File) Names() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select returns the profile to use: the requested one, else the default profile,
+// else the only profile in the file
+func (f *File) Select(name string) (*Config, error) {
+	if name == "" {
+		name = f.DefaultProfile
+	}
+	if name == "" && len(f.Profiles) == 1 {
+		name = f.Names()[0]
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no profile selected: use --profile or 'gua config profiles use <name>' (profiles: %v)", f.Names())
+	}
+
+	profile, ok := f.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found (profiles: %v)", name, f.Names())
+	}
+
+	// Callers receive a copy so environment overrides never leak back into the file
+	selected := *profile
+	selected.Name = name
+	return &selected, nil
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadFileLegacyFormat(t *testing.T) {
+	path := writeConfigFile(t, `{"tenantId":"t","clientId":"c","clientSecret":"s","maxRetries":2}`)
+
+	file, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if file.DefaultProfile != LegacyProfileName || len(file.Profiles) != 1 {
+		t.Fatalf("file is %+v, want one profile named %q", file, LegacyProfileName)
+	}
+	profile := file.Profiles[LegacyProfileName]
+	if profile.TenantID != "t" || profile.ClientID != "c" || profile.ClientSecret != "s" || profile.MaxRetries == nil || *profile.MaxRetries != 2 {
+		t.Errorf("legacy profile is %+v", profile)
+	}
+
+	// Saving converts the file to the profiles format
+	if err := file.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	saved, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile after Save: %v", err)
+	}
+	if saved.DefaultProfile != LegacyProfileName || saved.Profiles[LegacyProfileName].ClientSecret != "s" {
+		t.Errorf("saved file is %+v", saved)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"profiles"`) {
+		t.Errorf("saved file is not in profiles format:\n%s", data)
+	}
+}
+
+func TestReadFileProfilesFormat(t *testing.T) {
+	path := writeConfigFile(t, `{"defaultProfile":"prod","profiles":{"prod":{"tenantId":"p"},"test":{"tenantId":"t"}}}`)
+
+	file, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if file.DefaultProfile != "prod" || strings.Join(file.Names(), ",") != "prod,test" {
+		t.Errorf("file is %+v", file)
+	}
+}
+
+func TestReadFileMissingAndInvalid(t *testing.T) {
+	file, err := ReadFile(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || len(file.Profiles) != 0 {
+		t.Errorf("missing file read as %+v (%v), want an empty configuration", file, err)
+	}
+
+	if _, err := ReadFile(writeConfigFile(t, `{"tenantId":`)); err == nil {
+		t.Error("ReadFile accepted invalid JSON")
+	}
+}
+
+func TestSelect(t *testing.T) {
+	two := &File{DefaultProfile: "prod", Profiles: map[string]*Config{
+		"prod": {TenantID: "p"},
+		"test": {TenantID: "t"},
+	}}
+	noDefault := &File{Profiles: map[string]*Config{
+		"prod": {TenantID: "p"},
+		"test": {TenantID: "t"},
+	}}
+	one := &File{Profiles: map[string]*Config{"only": {TenantID: "o"}}}
+
+	tests := []struct {
+		name    string
+		file    *File
+		profile string
+		want    string
+		err     string
+	}{
+		{"requested profile", two, "test", "test", ""},
+		{"requested profile not found", two, "dev", "", `profile "dev" not found`},
+		{"default profile", two, "", "prod", ""},
+		{"only profile", one, "", "only", ""},
+		{"no profile selected", noDefault, "", "", "no profile selected"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := test.file.Select(test.profile)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("error is %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Select: %v", err)
+			}
+			if cfg.Name != test.want {
+				t.Errorf("selected %q, want %q", cfg.Name, test.want)
+			}
+		})
+	}
+}
+
+func TestSelectReturnsCopy(t *testing.T) {
+	file := &File{Profiles: map[string]*Config{"prod": {TenantID: "p"}}}
+
+	cfg, err := file.Select("prod")
+	if err != nil {
+		t.Fatalf("Select: %v", err)
+	}
+	cfg.TenantID = "changed"
+
+	if file.Profiles["prod"].TenantID != "p" || file.Profiles["prod"].Name != "" {
+		t.Errorf("Select changed the file's profile: %+v", file.Profiles["prod"])
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// secretCommandTimeout bounds how long a secret helper may run (it may prompt to unlock a keyring)
+const secretCommandTimeout = 2 * time.Minute
+
+// secretStderrTail is how much of a failed secret helper's stderr is included in the error
+const secretStderrTail = 2048
+
+// ResolveSecret runs SecretCommand, if needed, to fill in the client secret or certificate password.
+// It is called only when a new token must be requested, so cached tokens avoid running the helper.
+func (c *Config) ResolveSecret() error {
+	if c.SecretCommand == "" {
+		return nil
+	}
+
+	var target *string
+	switch c.Credential() {
+	case CredentialSecret:
+		target = &c.ClientSecret
+	case CredentialCertificate:
+		target = &c.CertificatePassword
+	default:
+		return nil
+	}
+	if *target != "" {
+		return nil
+	}
+
+	secret, err := runSecretCommand(c.SecretCommand)
+	if err != nil {
+		return err
+	}
+	*target = secret
+	return nil
+}
+
+// runSecretCommand runs a command through the platform shell and returns its trimmed standard output
+func runSecretCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	// Helpers such as pass or gpg may need to prompt, so their stderr is shown as it is written;
+	// the end of it is also kept for the error message
+	var stdout bytes.Buffer
+	stderr := &tailBuffer{max: secretStderrTail}
+	cmd.Stdout = &stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
+	cmd.Stdin = os.Stdin
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("secretCommand failed: %w\n%s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	secret := strings.TrimRight(stdout.String(), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("secretCommand produced no output")
+	}
+	return secret, nil
+}
+
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.max:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.buf)
+}
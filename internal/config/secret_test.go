@@ -0,0 +1,36 @@
+package config
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRunSecretCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh syntax")
+	}
+
+	secret, err := runSecretCommand(`echo "Passphrase:" >&2; echo s3cret`)
+	if err != nil || secret != "s3cret" {
+		t.Errorf("secret is %q (%v)", secret, err)
+	}
+
+	_, err = runSecretCommand(`head -c 5000 /dev/zero | tr '\0' x >&2; echo decryption failed >&2; exit 2`)
+	if err == nil || !strings.HasSuffix(err.Error(), "decryption failed") {
+		t.Fatalf("error is %v, want it to end with the helper's stderr", err)
+	}
+	if len(err.Error()) > secretStderrTail+100 {
+		t.Errorf("error has %d characters, want only the tail of stderr", len(err.Error()))
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{max: 4}
+	for _, s := range []string{"ab", "cde", "f"} {
+		b.Write([]byte(s))
+	}
+	if got := b.String(); got != "cdef" {
+		t.Errorf("tail is %q, want %q", got, "cdef")
+	}
+}
@@ -0,0 +1,37 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic replaces the file at path with data. The data is written to a new temporary file
+// in the same directory, which is then renamed over path, so a reader never sees a half-written file
+// and an interrupted write leaves the previous contents intact. Every call uses its own temporary
+// file, so concurrent writers can't mix their data. The file gets perm even when it already existed
+// with wider permissions.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// CreateExclusive creates a new file at path with perm. It fails when the file already exists,
+// rather than reuse a file whose permissions might be wider.
+func CreateExclusive(path string, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+}
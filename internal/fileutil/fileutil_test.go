@@ -0,0 +1,51 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFileAtomic(path, []byte("new"), 0600); err != nil {
+		t.Fatalf("WriteFileAtomic: %v", err)
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("file holds %q, want %q", data, "new")
+	}
+	if info, err := os.Stat(path); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0600) {
+		t.Errorf("file mode is %v (%v), want 0600", info.Mode(), err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only the written file", len(entries))
+	}
+}
+
+func TestWriteFileAtomicMissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "state.json")
+	if err := WriteFileAtomic(path, []byte("x"), 0600); err == nil {
+		t.Error("WriteFileAtomic succeeded in a missing directory")
+	}
+}
+
+func TestCreateExclusive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password.txt")
+
+	file, err := CreateExclusive(path, 0600)
+	if err != nil {
+		t.Fatalf("CreateExclusive: %v", err)
+	}
+	file.Close()
+
+	if _, err := CreateExclusive(path, 0600); !os.IsExist(err) {
+		t.Errorf("second CreateExclusive returned %v, want an already-exists error", err)
+	}
+}
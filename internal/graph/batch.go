@@ -0,0 +1,294 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxBatchSize is the largest number of requests Graph accepts in one $batch call
+const MaxBatchSize = 20
+
+// BatchItem is one request sent through Client.Batch
+type BatchItem struct {
+	Request *Request
+	// DependsOn lists the indexes of earlier items that must succeed before this one is run
+	DependsOn []int
+	// Out, when set, receives the decoded response body
+	Out interface{}
+	// Err is the item's outcome once Batch returns; nil means it succeeded
+	Err error
+}
+
+// batchRequest is one entry of a $batch request body
+type batchRequest struct {
+	ID        string            `json:"id"`
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      json.RawMessage   `json:"body,omitempty"`
+	DependsOn []string          `json:"dependsOn,omitempty"`
+}
+
+// batchResponse is one entry of a $batch response body
+type batchResponse struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// Batch runs the items through Graph's JSON batching endpoint, MaxBatchSize at a time, and records
+// each item's outcome in its Err field. Throttled or unavailable items are retried in a later batch
+// according to the client's retry policy, together with the items that depend on them.
+// An item whose dependency failed is not sent. Dependencies on items in an earlier batch of MaxBatchSize
+// are honored by waiting for that batch; dependencies within a batch use Graph's dependsOn.
+// The returned error is only set when a whole batch call failed.
+func (c *Client) Batch(items []*BatchItem) error {
+	for i, item := range items {
+		for _, dep := range item.DependsOn {
+			if dep < 0 || dep >= i {
+				return fmt.Errorf("batch item %d depends on item %d, which does not precede it", i, dep)
+			}
+		}
+	}
+
+	// Nothing is sent in dry-run mode except the lookups the changes rely on
+	if c.DryRun != nil {
+		for i, item := range items {
+			if _, err := c.newBatchRequest(items, i, nil); err != nil {
+				item.Err = err
+				continue
+			}
+			item.Err = c.Do(item.Request, item.Out)
+		}
+		return nil
+	}
+
+	for start := 0; start < len(items); start += MaxBatchSize {
+		var indexes []int
+		for i := start; i < len(items) && i < start+MaxBatchSize; i++ {
+			indexes = append(indexes, i)
+		}
+		if err := c.runBatch(items, indexes); err != nil {
+			// runBatch has recorded the outcome of every item in this batch; the later ones were never sent
+			for _, item := range items[indexes[len(indexes)-1]+1:] {
+				item.Err = err
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runBatch sends the given items in one $batch call and resends the retryable ones
+func (c *Client) runBatch(items []*BatchItem, pending []int) error {
+	for attempt := 0; len(pending) > 0; attempt++ {
+		inBatch := map[int]bool{}
+		for _, i := range pending {
+			inBatch[i] = true
+		}
+
+		var requests []batchRequest
+		var sent []int
+		sentRequests := map[int]batchRequest{}
+		for _, i := range pending {
+			request, err := c.newBatchRequest(items, i, inBatch)
+			if err != nil {
+				items[i].Err = err
+				delete(inBatch, i)
+				continue
+			}
+			requests = append(requests, request)
+			sent = append(sent, i)
+			sentRequests[i] = request
+		}
+		if len(requests) == 0 {
+			return nil
+		}
+
+		responses, requestID, err := c.sendBatch(requests)
+		if err != nil {
+			for _, i := range sent {
+				items[i].Err = err
+			}
+			return err
+		}
+
+		retry := map[int]bool{}
+		var wait time.Duration
+		for _, i := range sent {
+			response, ok := responses[strconv.Itoa(i)]
+			if !ok {
+				items[i].Err = fmt.Errorf("no response for batch item %d", i)
+				continue
+			}
+			if isRetryable(sentRequests[i].Method, response.Status) && attempt < c.Retry.MaxRetries {
+				retry[i] = true
+				if delay := c.Retry.delay(attempt, response.header()); delay > wait {
+					wait = delay
+				}
+				continue
+			}
+			items[i].Err = c.finishBatchItem(items[i], sentRequests[i], response, requestID)
+		}
+
+		// A dependent item fails with 424 when its dependency was throttled; run it again with the dependency.
+		// Items are in index order, so a dependency's decision is made before its dependents'.
+		for _, i := range sent {
+			response, ok := responses[strconv.Itoa(i)]
+			if !ok || response.Status != http.StatusFailedDependency {
+				continue
+			}
+			for _, dep := range items[i].DependsOn {
+				if retry[dep] {
+					retry[i] = true
+					items[i].Err = nil
+				}
+			}
+			if !retry[i] {
+				c.observeBatchItem(sentRequests[i], response, requestID)
+			}
+		}
+
+		pending = pending[:0]
+		for i := range retry {
+			pending = append(pending, i)
+		}
+		sort.Ints(pending)
+
+		if len(pending) > 0 {
+			c.logf("%d of %d batch requests were throttled, retrying in %s (attempt %d of %d)",
+				len(pending), len(sent), wait.Round(time.Millisecond), attempt+1, c.Retry.MaxRetries)
+			time.Sleep(wait)
+		}
+	}
+
+	return nil
+}
+
+// newBatchRequest builds the $batch entry for item i, or returns why it cannot be sent
+func (c *Client) newBatchRequest(items []*BatchItem, i int, inBatch map[int]bool) (batchRequest, error) {
+	item := items[i]
+	method := item.Request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	request := batchRequest{ID: strconv.Itoa(i), Method: method, URL: item.Request.Path}
+	if len(item.Request.Query) > 0 {
+		request.URL += "?" + item.Request.Query.Encode()
+	}
+	for key := range item.Request.Header {
+		if request.Headers == nil {
+			request.Headers = map[string]string{}
+		}
+		request.Headers[key] = item.Request.Header.Get(key)
+	}
+
+	if item.Request.Body != nil {
+		body, err := json.Marshal(item.Request.Body)
+		if err != nil {
+			return request, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		request.Body = body
+		if request.Headers == nil {
+			request.Headers = map[string]string{}
+		}
+		request.Headers["Content-Type"] = "application/json"
+	}
+
+	for _, dep := range item.DependsOn {
+		switch {
+		case inBatch[dep]:
+			request.DependsOn = append(request.DependsOn, strconv.Itoa(dep))
+		case items[dep].Err != nil:
+			return request, fmt.Errorf("not sent because the request it depends on failed: %w", items[dep].Err)
+		}
+	}
+
+	return request, nil
+}
+
+// sendBatch posts the requests to /$batch and returns the responses by ID and the batch's request-id
+func (c *Client) sendBatch(requests []batchRequest) (map[string]batchResponse, string, error) {
+	// Each item is observed on its own by runBatch, so the $batch call itself is only used for its request-id
+	var requestID string
+	outer := *c
+	outer.Observe = func(exchange Exchange) { requestID = exchange.RequestID }
+
+	var result struct {
+		Responses []batchResponse `json:"responses"`
+	}
+	body := map[string]interface{}{"requests": requests}
+	if err := outer.Do(&Request{Method: http.MethodPost, Path: "/$batch", Body: body}, &result); err != nil {
+		return nil, "", fmt.Errorf("batch request failed: %w", err)
+	}
+
+	responses := make(map[string]batchResponse, len(result.Responses))
+	for _, response := range result.Responses {
+		responses[response.ID] = response
+	}
+
+	return responses, requestID, nil
+}
+
+// finishBatchItem decodes a successful response into the item or returns its error. This is the
+// item's final outcome, so it is passed to the client's observer.
+func (c *Client) finishBatchItem(item *BatchItem, request batchRequest, response batchResponse, batchRequestID string) error {
+	// A 424 may still be retried with its dependency; runBatch observes it once that is decided
+	if response.Status != http.StatusFailedDependency {
+		c.observeBatchItem(request, response, batchRequestID)
+	}
+
+	if response.Status < 200 || response.Status > 299 {
+		err := newGraphError(response.Status, response.header(), response.Body)
+		if err.RequestID == "" {
+			err.RequestID = batchRequestID
+		}
+		return err
+	}
+
+	if item.Out != nil && len(response.Body) > 0 && !strings.EqualFold(string(response.Body), "null") {
+		if err := json.Unmarshal(response.Body, item.Out); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+	}
+	return nil
+}
+
+// observeBatchItem passes the outcome of a change made in a batch to the client's observer
+func (c *Client) observeBatchItem(request batchRequest, response batchResponse, batchRequestID string) {
+	if c.Observe == nil || request.Method == http.MethodGet {
+		return
+	}
+
+	exchange := Exchange{
+		Method:     request.Method,
+		URL:        c.URL(request.URL, nil),
+		Body:       request.Body,
+		StatusCode: response.Status,
+		RequestID:  response.header().Get("request-id"),
+	}
+	if exchange.RequestID == "" {
+		exchange.RequestID = batchRequestID
+	}
+	if response.Status < 200 || response.Status > 299 {
+		exchange.Err = newGraphError(response.Status, response.header(), response.Body)
+	}
+	c.Observe(exchange)
+}
+
+// header converts the response's headers for the shared error and retry helpers
+func (r batchResponse) header() http.Header {
+	header := http.Header{}
+	for key, value := range r.Headers {
+		header.Set(key, value)
+	}
+	return header
+}
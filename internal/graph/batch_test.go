@@ -0,0 +1,460 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// batchServer is a fake /$batch endpoint; respond answers each request of each call
+type batchServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	calls   [][]batchRequest
+	respond func(call int, request batchRequest) batchResponse
+}
+
+func newBatchServer(t *testing.T, respond func(call int, request batchRequest) batchResponse) *batchServer {
+	s := &batchServer{respond: respond}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1.0/$batch" {
+			t.Errorf("request sent to %s %s", r.Method, r.URL.Path)
+		}
+
+		var body struct {
+			Requests []batchRequest `json:"requests"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode batch: %v", err)
+		}
+		if len(body.Requests) > MaxBatchSize {
+			t.Errorf("batch has %d requests, more than %d", len(body.Requests), MaxBatchSize)
+		}
+
+		s.mu.Lock()
+		call := len(s.calls)
+		s.calls = append(s.calls, body.Requests)
+		s.mu.Unlock()
+
+		var result struct {
+			Responses []batchResponse `json:"responses"`
+		}
+		for _, request := range body.Requests {
+			response := s.respond(call, request)
+			response.ID = request.ID
+			result.Responses = append(result.Responses, response)
+		}
+		w.Header().Set("request-id", "batch-"+strconv.Itoa(call))
+		json.NewEncoder(w).Encode(result)
+	}))
+	return s
+}
+
+// ids returns the IDs of the requests sent in a call
+func (s *batchServer) ids(call int) []string {
+	var ids []string
+	for _, request := range s.calls[call] {
+		ids = append(ids, request.ID)
+	}
+	return ids
+}
+
+func ok(body string) batchResponse {
+	return batchResponse{Status: http.StatusOK, Body: json.RawMessage(body)}
+}
+
+func throttled(retryAfter string) batchResponse {
+	return batchResponse{
+		Status:  http.StatusTooManyRequests,
+		Headers: map[string]string{"Retry-After": retryAfter},
+		Body:    json.RawMessage(`{"error":{"code":"TooManyRequests","message":"Too many requests"}}`),
+	}
+}
+
+func getItems(n int) ([]*BatchItem, []map[string]string) {
+	items := make([]*BatchItem, n)
+	outs := make([]map[string]string, n)
+	for i := range items {
+		items[i] = &BatchItem{Request: &Request{Method: http.MethodGet, Path: fmt.Sprintf("/users/u%d", i)}, Out: &outs[i]}
+	}
+	return items, outs
+}
+
+func TestBatchSplitsIntoChunks(t *testing.T) {
+	srv := newBatchServer(t, func(call int, request batchRequest) batchResponse {
+		return ok(fmt.Sprintf(`{"url":%q}`, request.URL))
+	})
+	defer srv.Close()
+
+	items, outs := getItems(45)
+	items[7].Request.Query = map[string][]string{"$select": {"id"}}
+	if err := newTestClient(srv.Server).Batch(items); err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+
+	if len(srv.calls) != 3 || len(srv.calls[0]) != 20 || len(srv.calls[1]) != 20 || len(srv.calls[2]) != 5 {
+		t.Fatalf("sent %d calls, want batches of 20, 20 and 5", len(srv.calls))
+	}
+	if first := srv.calls[1][0]; first.ID != "20" || first.Method != http.MethodGet || first.URL != "/users/u20" {
+		t.Errorf("first request of the second batch is %+v", first)
+	}
+	for i, item := range items {
+		if item.Err != nil {
+			t.Errorf("item %d failed: %v", i, item.Err)
+		}
+	}
+	if outs[7]["url"] != "/users/u7?%24select=id" || outs[44]["url"] != "/users/u44" {
+		t.Errorf("responses decoded as %v and %v", outs[7], outs[44])
+	}
+}
+
+func TestBatchSendsBodies(t *testing.T) {
+	srv := newBatchServer(t, func(call int, request batchRequest) batchResponse {
+		return batchResponse{Status: http.StatusNoContent}
+	})
+	defer srv.Close()
+
+	items := []*BatchItem{{Request: &Request{Method: http.MethodPatch, Path: "/users/u0", Body: map[string]bool{"accountEnabled": false}}}}
+	if err := newTestClient(srv.Server).Batch(items); err != nil || items[0].Err != nil {
+		t.Fatalf("Batch: %v, %v", err, items[0].Err)
+	}
+
+	request := srv.calls[0][0]
+	if string(request.Body) != `{"accountEnabled":false}` || request.Headers["Content-Type"] != "application/json" {
+		t.Errorf("request is %+v", request)
+	}
+}
+
+func TestBatchDependencies(t *testing.T) {
+	srv := newBatchServer(t, func(call int, request batchRequest) batchResponse {
+		if request.URL == "/users/u3" {
+			return batchResponse{Status: http.StatusNotFound, Body: json.RawMessage(`{"error":{"code":"Request_ResourceNotFound","message":"not found"}}`)}
+		}
+		return ok(`{}`)
+	})
+	defer srv.Close()
+
+	items, _ := getItems(25)
+	items[1].DependsOn = []int{0}  // same batch: sent with dependsOn
+	items[21].DependsOn = []int{2} // earlier batch, succeeded: sent without dependsOn
+	items[22].DependsOn = []int{3} // earlier batch, failed: not sent
+	if err := newTestClient(srv.Server).Batch(items); err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+
+	if deps := srv.calls[0][1].DependsOn; len(deps) != 1 || deps[0] != "0" {
+		t.Errorf("item 1 depends on %v, want [0]", deps)
+	}
+	if got := strings.Join(srv.ids(1), ","); got != "20,21,23,24" {
+		t.Errorf("second batch sent items %s, want 20,21,23,24", got)
+	}
+	if deps := srv.calls[1][1].DependsOn; len(deps) != 0 {
+		t.Errorf("item 21 depends on %v in its batch, want nothing", deps)
+	}
+
+	var graphErr *GraphError
+	if !errors.As(items[22].Err, &graphErr) || graphErr.Kind() != KindNotFound || !strings.Contains(items[22].Err.Error(), "depends on failed") {
+		t.Errorf("item 22 error is %v, want the failure of item 3", items[22].Err)
+	}
+	if items[21].Err != nil {
+		t.Errorf("item 21 failed: %v", items[21].Err)
+	}
+}
+
+func TestBatchRejectsForwardDependencies(t *testing.T) {
+	items, _ := getItems(2)
+	items[0].DependsOn = []int{1}
+	if err := NewClient(StaticToken("")).Batch(items); err == nil {
+		t.Error("Batch accepted an item depending on a later one")
+	}
+}
+
+func TestBatchRetriesThrottledItems(t *testing.T) {
+	srv := newBatchServer(t, func(call int, request batchRequest) batchResponse {
+		if call == 0 && (request.ID == "1" || request.ID == "3") {
+			return throttled("0")
+		}
+		return ok(fmt.Sprintf(`{"call":"%d"}`, call))
+	})
+	defer srv.Close()
+
+	client := newTestClient(srv.Server)
+	var notices []string
+	client.Logf = func(format string, args ...interface{}) {
+		notices = append(notices, fmt.Sprintf(format, args...))
+	}
+
+	items, outs := getItems(4)
+	if err := client.Batch(items); err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+
+	if len(srv.calls) != 2 || strings.Join(srv.ids(1), ",") != "1,3" {
+		t.Fatalf("calls sent %v, want the throttled items 1 and 3 resent", srv.calls)
+	}
+	for i, item := range items {
+		if item.Err != nil {
+			t.Errorf("item %d failed: %v", i, item.Err)
+		}
+	}
+	if outs[0]["call"] != "0" || outs[1]["call"] != "1" {
+		t.Errorf("responses are %v", outs)
+	}
+	if len(notices) != 1 || !strings.Contains(notices[0], "2 of 4 batch requests were throttled") {
+		t.Errorf("retry notices are %q", notices)
+	}
+}
+
+func TestBatchDoesNotRetryUnavailablePost(t *testing.T) {
+	srv := newBatchServer(t, func(call int, request batchRequest) batchResponse {
+		if call == 0 {
+			return batchResponse{Status: http.StatusServiceUnavailable}
+		}
+		return ok(`{}`)
+	})
+	defer srv.Close()
+
+	items := []*BatchItem{
+		{Request: &Request{Method: http.MethodPost, Path: "/groups/g/members/$ref", Body: map[string]string{}}},
+		{Request: &Request{Method: http.MethodGet, Path: "/users/u1"}},
+	}
+	if err := newTestClient(srv.Server).Batch(items); err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+
+	if len(srv.calls) != 2 || strings.Join(srv.ids(1), ",") != "1" {
+		t.Fatalf("calls sent %v, want only the GET resent", srv.calls)
+	}
+	if items[0].Err == nil {
+		t.Error("POST item succeeded after status 503")
+	}
+	if items[1].Err != nil {
+		t.Errorf("GET item failed: %v", items[1].Err)
+	}
+}
+
+func TestBatchRequeuesFailedDependencyWithThrottledItem(t *testing.T) {
+	srv := newBatchServer(t, func(call int, request batchRequest) batchResponse {
+		if call == 0 {
+			switch request.ID {
+			case "0":
+				return throttled("0")
+			case "1":
+				return batchResponse{Status: http.StatusFailedDependency}
+			}
+		}
+		return batchResponse{Status: http.StatusNoContent}
+	})
+	defer srv.Close()
+
+	client := newTestClient(srv.Server)
+	var observed []Exchange
+	client.Observe = func(exchange Exchange) { observed = append(observed, exchange) }
+
+	items := []*BatchItem{
+		{Request: &Request{Method: http.MethodPost, Path: "/users", Body: map[string]string{"displayName": "New"}}},
+		{Request: &Request{Method: http.MethodPut, Path: "/users/u1/manager/$ref"}, DependsOn: []int{0}},
+		{Request: &Request{Method: http.MethodPatch, Path: "/users/u2"}},
+	}
+	if err := client.Batch(items); err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+
+	if len(srv.calls) != 2 || strings.Join(srv.ids(1), ",") != "0,1" {
+		t.Fatalf("second call sent %v, want items 0 and 1", srv.ids(1))
+	}
+	if deps := srv.calls[1][1].DependsOn; len(deps) != 1 || deps[0] != "0" {
+		t.Errorf("resent item 1 depends on %v, want [0]", deps)
+	}
+	for i, item := range items {
+		if item.Err != nil {
+			t.Errorf("item %d failed: %v", i, item.Err)
+		}
+	}
+
+	// Every change is observed once, with its final outcome
+	if len(observed) != 3 {
+		t.Fatalf("observed %d exchanges, want 3: %+v", len(observed), observed)
+	}
+	for _, exchange := range observed {
+		if exchange.StatusCode != http.StatusNoContent {
+			t.Errorf("observed %s %s with status %d", exchange.Method, exchange.URL, exchange.StatusCode)
+		}
+	}
+}
+
+func TestBatchFailedDependencyWithoutThrottling(t *testing.T) {
+	srv := newBatchServer(t, func(call int, request batchRequest) batchResponse {
+		if request.ID == "0" {
+			return batchResponse{Status: http.StatusBadRequest, Body: json.RawMessage(`{"error":{"code":"Request_BadRequest","message":"bad"}}`)}
+		}
+		return batchResponse{Status: http.StatusFailedDependency}
+	})
+	defer srv.Close()
+
+	items, _ := getItems(2)
+	items[1].DependsOn = []int{0}
+	if err := newTestClient(srv.Server).Batch(items); err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+
+	if len(srv.calls) != 1 {
+		t.Errorf("sent %d calls, want 1", len(srv.calls))
+	}
+	var graphErr *GraphError
+	if !errors.As(items[1].Err, &graphErr) || graphErr.StatusCode != http.StatusFailedDependency {
+		t.Errorf("item 1 error is %v, want status 424", items[1].Err)
+	}
+}
+
+func TestBatchHonorsRetryAfter(t *testing.T) {
+	srv := newBatchServer(t, func(call int, request batchRequest) batchResponse {
+		if call == 0 {
+			if request.ID == "0" {
+				return throttled("1")
+			}
+			return throttled("0")
+		}
+		return ok(`{}`)
+	})
+	defer srv.Close()
+
+	client := newTestClient(srv.Server)
+	client.Retry.MaxWait = 5 * time.Second
+
+	items, _ := getItems(2)
+	started := time.Now()
+	if err := client.Batch(items); err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+
+	// The batch waits for the longest Retry-After of its throttled items
+	if elapsed := time.Since(started); elapsed < time.Second || elapsed > 4*time.Second {
+		t.Errorf("retry took %v, want about the 1s Retry-After", elapsed)
+	}
+}
+
+func TestBatchGivesUpAfterMaxRetries(t *testing.T) {
+	srv := newBatchServer(t, func(call int, request batchRequest) batchResponse {
+		return throttled("0")
+	})
+	defer srv.Close()
+
+	client := newTestClient(srv.Server)
+	client.Retry.MaxRetries = 2
+
+	items, _ := getItems(1)
+	if err := client.Batch(items); err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+
+	if len(srv.calls) != 3 {
+		t.Errorf("sent %d calls, want the first and 2 retries", len(srv.calls))
+	}
+	var graphErr *GraphError
+	if !errors.As(items[0].Err, &graphErr) || graphErr.Kind() != KindThrottled || graphErr.RequestID != "batch-2" {
+		t.Errorf("item error is %+v, want a throttled GraphError with the batch's request-id", items[0].Err)
+	}
+}
+
+func TestBatchCallFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"code":"BadRequest","message":"Invalid batch payload"}}`)
+	}))
+	defer srv.Close()
+
+	items, _ := getItems(25)
+	err := newTestClient(srv).Batch(items)
+	if err == nil {
+		t.Fatal("Batch succeeded")
+	}
+	for i, item := range items {
+		if item.Err == nil {
+			t.Errorf("item %d has no error", i)
+		}
+	}
+}
+
+func TestBatchCallFailureOnRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":{"code":"InternalServerError","message":"Internal error"}}`)
+			return
+		}
+
+		var body struct {
+			Requests []batchRequest `json:"requests"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		var result struct {
+			Responses []batchResponse `json:"responses"`
+		}
+		for _, request := range body.Requests {
+			response := ok(`{}`)
+			if request.ID == "3" || request.ID == "4" {
+				response = throttled("0")
+			}
+			response.ID = request.ID
+			result.Responses = append(result.Responses, response)
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	defer srv.Close()
+
+	items, _ := getItems(25)
+	if err := newTestClient(srv).Batch(items); err == nil {
+		t.Fatal("Batch succeeded")
+	}
+
+	if calls != 2 {
+		t.Errorf("sent %d calls, want the first batch and its retry", calls)
+	}
+	// The items that succeeded in the first call keep their outcome
+	for i, item := range items {
+		failed := i == 3 || i == 4 || i >= MaxBatchSize
+		if failed && item.Err == nil {
+			t.Errorf("item %d has no error", i)
+		}
+		if !failed && item.Err != nil {
+			t.Errorf("item %d failed: %v", i, item.Err)
+		}
+	}
+}
+
+func TestBatchDryRun(t *testing.T) {
+	var sent []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Method+" "+r.URL.Path)
+		fmt.Fprint(w, `{"id":"u0"}`)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(srv)
+	var planned []string
+	client.DryRun = func(method, url string, body []byte) { planned = append(planned, method) }
+
+	items := []*BatchItem{
+		{Request: &Request{Method: http.MethodGet, Path: "/users/u0"}},
+		{Request: &Request{Method: http.MethodPatch, Path: "/users/u0", Body: map[string]bool{"accountEnabled": false}}, DependsOn: []int{0}},
+	}
+	if err := client.Batch(items); err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+
+	// Lookups are sent one by one, changes only planned, and nothing goes through /$batch
+	if strings.Join(sent, ",") != "GET /v1.0/users/u0" || strings.Join(planned, ",") != "PATCH" {
+		t.Errorf("sent %v and planned %v", sent, planned)
+	}
+}
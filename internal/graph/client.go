@@ -0,0 +1,288 @@
+package graph
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the Microsoft Graph v1.0 endpoint
+const DefaultBaseURL = "https://graph.microsoft.com/v1.0"
+
+// DefaultTimeout is the time allowed for a single HTTP round trip
+const DefaultTimeout = 60 * time.Second
+
+// TokenSource supplies bearer tokens for Graph requests
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// StaticToken is a TokenSource that always returns the same access token
+type StaticToken string
+
+// Token returns the access token
+func (t StaticToken) Token() (string, error) {
+	return string(t), nil
+}
+
+// Client sends requests to Microsoft Graph
+type Client struct {
+	BaseURL    string
+	Tokens     TokenSource
+	UserAgent  string
+	HTTPClient *http.Client
+	Retry      RetryPolicy
+	// Logf, when set, receives diagnostic messages such as retry notices
+	Logf func(format string, args ...interface{})
+	// DryRun, when set, receives every request that would change data instead of it being sent.
+	// GET requests are still sent so that inputs can be resolved and checked.
+	DryRun func(method, url string, body []byte)
+	// Observe, when set, is called with the outcome of every request that changes data
+	Observe func(Exchange)
+}
+
+// Exchange is the outcome of one request, as passed to Client.Observe
+type Exchange struct {
+	Method string
+	URL    string
+	// Body is the JSON request body, if any
+	Body []byte
+	// StatusCode is 0 when no response was received
+	StatusCode      int
+	RequestID       string
+	ClientRequestID string
+	Err             error
+}
+
+// NewClient creates a client for the Graph v1.0 endpoint using the given token source
+func NewClient(tokens TokenSource) *Client {
+	return &Client{
+		BaseURL:    DefaultBaseURL,
+		Tokens:     tokens,
+		UserAgent:  "GraphUserAdmin",
+		HTTPClient: &http.Client{Timeout: DefaultTimeout},
+		Retry:      DefaultRetryPolicy,
+	}
+}
+
+// Request describes a single Graph API call
+type Request struct {
+	Method string
+	// Path is relative to the client's BaseURL, or an absolute URL such as an @odata.nextLink
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   interface{}
+}
+
+// Do sends the request and decodes a JSON response body into out (when out is not nil).
+// Throttled and unavailable responses are retried according to the client's RetryPolicy.
+func (c *Client) Do(r *Request, out interface{}) error {
+	var jsonData []byte
+	if r.Body != nil {
+		var err error
+		jsonData, err = json.Marshal(r.Body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	if c.DryRun != nil && r.Method != http.MethodGet {
+		c.DryRun(r.Method, c.URL(r.Path, r.Query), jsonData)
+		return nil
+	}
+
+	exchange := Exchange{Method: r.Method, URL: c.URL(r.Path, r.Query), Body: jsonData}
+	if c.Observe != nil && r.Method != http.MethodGet {
+		defer func() { c.Observe(exchange) }()
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, respBody, err := c.send(r, jsonData)
+		if err != nil {
+			exchange.Err = err
+			return err
+		}
+		exchange.StatusCode = resp.StatusCode
+		exchange.RequestID = resp.Header.Get("request-id")
+		exchange.ClientRequestID = resp.Request.Header.Get("client-request-id")
+
+		if isRetryable(r.Method, resp.StatusCode) && attempt < c.Retry.MaxRetries {
+			wait := c.Retry.delay(attempt, resp.Header)
+			c.logf("%s %s returned status %d, retrying in %s (attempt %d of %d)",
+				r.Method, r.Path, resp.StatusCode, wait.Round(time.Millisecond), attempt+1, c.Retry.MaxRetries)
+			time.Sleep(wait)
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			graphErr := newGraphError(resp.StatusCode, resp.Header, respBody)
+			if exchange.RequestID == "" {
+				exchange.RequestID = graphErr.RequestID
+			}
+			exchange.Err = graphErr
+			return graphErr
+		}
+
+		if out != nil && len(respBody) > 0 {
+			if err := json.Unmarshal(respBody, out); err != nil {
+				exchange.Err = fmt.Errorf("failed to parse response: %w", err)
+				return exchange.Err
+			}
+		}
+
+		return nil
+	}
+}
+
+// send performs a single HTTP round trip and returns the response with its body read
+func (c *Client) send(r *Request, jsonData []byte) (*http.Response, []byte, error) {
+	var body io.Reader
+	if jsonData != nil {
+		body = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequest(r.Method, c.URL(r.Path, r.Query), body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	accessToken, err := c.Tokens.Token()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to obtain access token: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("client-request-id", newRequestID())
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	for key, values := range r.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return resp, respBody, nil
+}
+
+// logf writes a diagnostic message when the client has a logger
+func (c *Client) logf(format string, args ...interface{}) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
+
+// URL resolves a request path against the client's BaseURL
+func (c *Client) URL(path string, query url.Values) string {
+	u := path
+	if !strings.HasPrefix(path, "https://") && !strings.HasPrefix(path, "http://") {
+		u = strings.TrimSuffix(c.BaseURL, "/") + path
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// Get sends a GET request and decodes the response into out
+func (c *Client) Get(path string, out interface{}) error {
+	return c.Do(&Request{Method: http.MethodGet, Path: path}, out)
+}
+
+// Post sends a POST request with a JSON body and decodes the response into out
+func (c *Client) Post(path string, body, out interface{}) error {
+	return c.Do(&Request{Method: http.MethodPost, Path: path, Body: body}, out)
+}
+
+// Patch sends a PATCH request with a JSON body
+func (c *Client) Patch(path string, body interface{}) error {
+	return c.Do(&Request{Method: http.MethodPatch, Path: path, Body: body}, nil)
+}
+
+// Put sends a PUT request with a JSON body
+func (c *Client) Put(path string, body interface{}) error {
+	return c.Do(&Request{Method: http.MethodPut, Path: path, Body: body}, nil)
+}
+
+// Delete sends a DELETE request
+func (c *Client) Delete(path string) error {
+	return c.Do(&Request{Method: http.MethodDelete, Path: path}, nil)
+}
+
+// page is a single page of a Graph collection response
+type page[T any] struct {
+	Value    []T    `json:"value"`
+	NextLink string `json:"@odata.nextLink,omitempty"`
+}
+
+// List retrieves every item of a collection, following @odata.nextLink across pages
+func List[T any](c *Client, r *Request) ([]T, error) {
+	return ListLimit[T](c, r, 0)
+}
+
+// ListLimit retrieves at most limit items of a collection (all of them when limit is 0),
+// requesting no further pages once the limit is reached
+func ListLimit[T any](c *Client, r *Request, limit int) ([]T, error) {
+	var all []T
+
+	next := *r
+	if next.Method == "" {
+		next.Method = http.MethodGet
+	}
+
+	for {
+		var p page[T]
+		if err := c.Do(&next, &p); err != nil {
+			return nil, err
+		}
+
+		all = append(all, p.Value...)
+		if limit > 0 && len(all) >= limit {
+			return all[:limit], nil
+		}
+		if p.NextLink == "" {
+			break
+		}
+
+		// The next link already carries the original query parameters
+		next.Path = p.NextLink
+		next.Query = nil
+	}
+
+	return all, nil
+}
+
+// newRequestID returns a random UUID used as client-request-id so failures can be correlated with Graph logs
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,375 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client for srv that retries quickly
+func newTestClient(srv *httptest.Server) *Client {
+	client := NewClient(StaticToken("test-token"))
+	client.BaseURL = srv.URL + "/v1.0"
+	client.HTTPClient = srv.Client()
+	client.Retry = RetryPolicy{MaxRetries: 3, MaxWait: 10 * time.Millisecond}
+	return client
+}
+
+func TestDoSendsRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1.0/users" || r.URL.Query().Get("$select") != "id" {
+			t.Errorf("request is %s %s", r.Method, r.URL)
+		}
+		for name, want := range map[string]string{
+			"Authorization":    "Bearer test-token",
+			"Content-Type":     "application/json",
+			"User-Agent":       "GraphUserAdmin",
+			"ConsistencyLevel": "eventual",
+		} {
+			if got := r.Header.Get(name); got != want {
+				t.Errorf("%s header is %q, want %q", name, got, want)
+			}
+		}
+		if id := r.Header.Get("client-request-id"); !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id) {
+			t.Errorf("client-request-id %q is not a UUID", id)
+		}
+
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["displayName"] != "John" {
+			t.Errorf("body is %v (%v)", body, err)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":"new-id"}`)
+	}))
+	defer srv.Close()
+
+	var out struct {
+		ID string `json:"id"`
+	}
+	err := newTestClient(srv).Do(&Request{
+		Method: http.MethodPost,
+		Path:   "/users",
+		Query:  map[string][]string{"$select": {"id"}},
+		Header: http.Header{"ConsistencyLevel": {"eventual"}},
+		Body:   map[string]string{"displayName": "John"},
+	}, &out)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if out.ID != "new-id" {
+		t.Errorf("decoded ID is %q", out.ID)
+	}
+}
+
+func TestDoReturnsGraphError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("request-id", "req-1")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":{"code":"Request_ResourceNotFound","message":"Resource 'x' does not exist."}}`)
+	}))
+	defer srv.Close()
+
+	err := newTestClient(srv).Get("/users/x", nil)
+
+	var graphErr *GraphError
+	if !errors.As(err, &graphErr) {
+		t.Fatalf("error %v is not a GraphError", err)
+	}
+	if graphErr.Kind() != KindNotFound || graphErr.Code != "Request_ResourceNotFound" || graphErr.RequestID != "req-1" {
+		t.Errorf("error is %+v", graphErr)
+	}
+	if err.Error() != "Request_ResourceNotFound: Resource 'x' does not exist." {
+		t.Errorf("message is %q", err.Error())
+	}
+}
+
+func TestDoRetriesThrottledAndUnavailable(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusGatewayTimeout} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			var attempts int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// The body must be sent again on every attempt
+				if body, _ := io.ReadAll(r.Body); string(body) != `{"accountEnabled":false}` {
+					t.Errorf("attempt %d sent body %q", atomic.LoadInt32(&attempts)+1, body)
+				}
+				if atomic.AddInt32(&attempts, 1) < 3 {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(status)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer srv.Close()
+
+			client := newTestClient(srv)
+			var notices []string
+			client.Logf = func(format string, args ...interface{}) {
+				notices = append(notices, fmt.Sprintf(format, args...))
+			}
+
+			if err := client.Patch("/users/x", map[string]bool{"accountEnabled": false}); err != nil {
+				t.Fatalf("Patch: %v", err)
+			}
+			if attempts != 3 {
+				t.Errorf("sent %d attempts, want 3", attempts)
+			}
+			if len(notices) != 2 {
+				t.Errorf("logged %d retry notices, want 2: %q", len(notices), notices)
+			}
+		})
+	}
+}
+
+func TestDoRetriesPostOnlyWhenThrottled(t *testing.T) {
+	for status, want := range map[int]int32{
+		http.StatusTooManyRequests:    2,
+		http.StatusServiceUnavailable: 1,
+		http.StatusGatewayTimeout:     1,
+	} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			var attempts int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&attempts, 1) == 1 {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(status)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer srv.Close()
+
+			err := newTestClient(srv).Do(&Request{Method: http.MethodPost, Path: "/users", Body: map[string]string{}}, nil)
+			if want == 1 && err == nil {
+				t.Errorf("POST succeeded after status %d", status)
+			}
+			if want > 1 && err != nil {
+				t.Errorf("POST: %v", err)
+			}
+			if attempts != want {
+				t.Errorf("sent %d attempts, want %d", attempts, want)
+			}
+		})
+	}
+}
+
+func TestDoGivesUpAfterMaxRetries(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"error":{"code":"TooManyRequests","message":"Too many requests"}}`)
+	}))
+	defer srv.Close()
+
+	err := newTestClient(srv).Get("/users", nil)
+
+	var graphErr *GraphError
+	if !errors.As(err, &graphErr) || graphErr.Kind() != KindThrottled {
+		t.Errorf("error is %v, want a throttled GraphError", err)
+	}
+	if attempts != 4 {
+		t.Errorf("sent %d attempts, want the first and 3 retries", attempts)
+	}
+}
+
+func TestDoDoesNotRetryOtherErrors(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	if err := newTestClient(srv).Get("/users", nil); err == nil {
+		t.Error("Get succeeded on status 500")
+	}
+	if attempts != 1 {
+		t.Errorf("sent %d attempts, want 1", attempts)
+	}
+}
+
+func TestDoDryRun(t *testing.T) {
+	var sent []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Method)
+		fmt.Fprint(w, `{"id":"x"}`)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(srv)
+	var planned []string
+	client.DryRun = func(method, url string, body []byte) {
+		planned = append(planned, fmt.Sprintf("%s %s %s", method, url, body))
+	}
+
+	if err := client.Get("/users/x", nil); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if err := client.Patch("/users/x", map[string]string{"jobTitle": "CTO"}); err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+
+	if len(sent) != 1 || sent[0] != http.MethodGet {
+		t.Errorf("sent %v, want only the GET", sent)
+	}
+	want := "PATCH " + srv.URL + `/v1.0/users/x {"jobTitle":"CTO"}`
+	if len(planned) != 1 || planned[0] != want {
+		t.Errorf("planned %q, want %q", planned, want)
+	}
+}
+
+func TestDoObservesChanges(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("request-id", "req-"+r.Method)
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(srv)
+	var observed []Exchange
+	client.Observe = func(exchange Exchange) {
+		observed = append(observed, exchange)
+	}
+
+	client.Get("/users/x", nil)
+	client.Patch("/users/x", map[string]string{"jobTitle": "CTO"})
+	client.Delete("/users/x")
+
+	if len(observed) != 2 {
+		t.Fatalf("observed %d exchanges, want the PATCH and the DELETE", len(observed))
+	}
+	if patch := observed[0]; patch.Method != http.MethodPatch || patch.StatusCode != http.StatusNoContent || patch.RequestID != "req-PATCH" ||
+		patch.ClientRequestID == "" || string(patch.Body) != `{"jobTitle":"CTO"}` || patch.Err != nil {
+		t.Errorf("PATCH exchange is %+v", patch)
+	}
+	if del := observed[1]; del.StatusCode != http.StatusForbidden || del.Err == nil {
+		t.Errorf("DELETE exchange is %+v", del)
+	}
+}
+
+// pagedServer serves /v1.0/items in pages of two, linking each page to the next
+func pagedServer(t *testing.T, total int, requests *int32) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if r.Method != http.MethodGet {
+			t.Errorf("page requested with %s", r.Method)
+		}
+
+		start, _ := strconv.Atoi(r.URL.Query().Get("skip"))
+		if start == 0 && r.URL.Query().Get("$filter") != "accountEnabled eq true" {
+			t.Errorf("first page request %s lacks the query", r.URL)
+		}
+
+		var p page[int]
+		for i := start; i < total && i < start+2; i++ {
+			p.Value = append(p.Value, i)
+		}
+		if start+2 < total {
+			// Like Graph, the next link carries the original query
+			p.NextLink = fmt.Sprintf("%s/v1.0/items?$filter=accountEnabled+eq+true&skip=%d", srv.URL, start+2)
+		}
+		json.NewEncoder(w).Encode(p)
+	}))
+	return srv
+}
+
+func TestListFollowsNextLinks(t *testing.T) {
+	var requests int32
+	srv := pagedServer(t, 5, &requests)
+	defer srv.Close()
+
+	query := map[string][]string{"$filter": {"accountEnabled eq true"}}
+	items, err := List[int](newTestClient(srv), &Request{Path: "/items", Query: query})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	if fmt.Sprint(items) != "[0 1 2 3 4]" {
+		t.Errorf("items are %v", items)
+	}
+	if requests != 3 {
+		t.Errorf("requested %d pages, want 3", requests)
+	}
+}
+
+func TestListLimitStopsEarly(t *testing.T) {
+	var requests int32
+	srv := pagedServer(t, 10, &requests)
+	defer srv.Close()
+
+	query := map[string][]string{"$filter": {"accountEnabled eq true"}}
+	items, err := ListLimit[int](newTestClient(srv), &Request{Path: "/items", Query: query}, 3)
+	if err != nil {
+		t.Fatalf("ListLimit: %v", err)
+	}
+
+	if fmt.Sprint(items) != "[0 1 2]" {
+		t.Errorf("items are %v", items)
+	}
+	if requests != 2 {
+		t.Errorf("requested %d pages, want 2", requests)
+	}
+}
+
+func TestRetryDelayWithoutMaxWait(t *testing.T) {
+	for _, maxWait := range []time.Duration{0, -time.Second} {
+		policy := RetryPolicy{MaxRetries: 5, MaxWait: maxWait}
+
+		if wait := policy.delay(0, http.Header{"Retry-After": {"3600"}}); wait != DefaultRetryPolicy.MaxWait {
+			t.Errorf("MaxWait %v: Retry-After 3600 waits %v, want the default cap %v", maxWait, wait, DefaultRetryPolicy.MaxWait)
+		}
+		// Attempt 70 overflows the shift; the wait must still be bounded and not always zero
+		var longest time.Duration
+		for i := 0; i < 20; i++ {
+			wait := policy.delay(70, http.Header{})
+			if wait < 0 || wait > DefaultRetryPolicy.MaxWait {
+				t.Fatalf("MaxWait %v: backoff after overflow is %v, want at most %v", maxWait, wait, DefaultRetryPolicy.MaxWait)
+			}
+			if wait > longest {
+				longest = wait
+			}
+		}
+		if longest == 0 {
+			t.Errorf("MaxWait %v: backoff after overflow never waits", maxWait)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 5, MaxWait: 30 * time.Second}
+
+	if wait := policy.delay(0, http.Header{"Retry-After": {"7"}}); wait != 7*time.Second {
+		t.Errorf("Retry-After 7 waits %v", wait)
+	}
+	if wait := policy.delay(0, http.Header{"Retry-After": {"120"}}); wait != 30*time.Second {
+		t.Errorf("Retry-After 120 waits %v, want the 30s cap", wait)
+	}
+	date := time.Now().Add(5 * time.Second).UTC().Format(http.TimeFormat)
+	if wait := policy.delay(0, http.Header{"Retry-After": {date}}); wait <= 3*time.Second || wait > 5*time.Second {
+		t.Errorf("Retry-After %s waits %v", date, wait)
+	}
+	for attempt := 0; attempt < 70; attempt++ {
+		wait := policy.delay(attempt, http.Header{})
+		limit := policy.MaxWait
+		if attempt < 5 {
+			limit = baseBackoff << uint(attempt)
+		}
+		if wait < 0 || wait > limit {
+			t.Errorf("backoff for attempt %d is %v, want at most %v", attempt, wait, limit)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Kind classifies Graph errors so callers (and scripts, through exit codes) can react to them
+type Kind int
+
+const (
+	KindOther Kind = iota
+	KindValidation
+	KindNotFound
+	KindForbidden
+	KindConflict
+	KindThrottled
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindValidation:
+		return "validation"
+	case KindNotFound:
+		return "not found"
+	case KindForbidden:
+		return "forbidden"
+	case KindConflict:
+		return "conflict"
+	case KindThrottled:
+		return "throttled"
+	}
+	return "other"
+}
+
+// InnerError holds the diagnostic details Graph nests under error.innerError
+type InnerError struct {
+	Code            string `json:"code,omitempty"`
+	Date            string `json:"date,omitempty"`
+	RequestID       string `json:"request-id,omitempty"`
+	ClientRequestID string `json:"client-request-id,omitempty"`
+}
+
+// GraphError is returned when Graph responds with a non-success status code.
+// Use errors.As to retrieve it from a wrapped error.
+type GraphError struct {
+	StatusCode      int
+	Code            string
+	Message         string
+	InnerError      *InnerError
+	RequestID       string
+	ClientRequestID string
+	// Body is the raw response body, kept for responses that are not Graph error JSON
+	Body string
+}
+
+// errorResponse is the JSON envelope Graph uses for errors
+type errorResponse struct {
+	Error struct {
+		Code       string      `json:"code"`
+		Message    string      `json:"message"`
+		InnerError *InnerError `json:"innerError"`
+	} `json:"error"`
+}
+
+// newGraphError builds a GraphError from a failed response
+func newGraphError(statusCode int, header http.Header, body []byte) *GraphError {
+	e := &GraphError{
+		StatusCode:      statusCode,
+		RequestID:       header.Get("request-id"),
+		ClientRequestID: header.Get("client-request-id"),
+		Body:            string(body),
+	}
+
+	var parsed errorResponse
+	if json.Unmarshal(body, &parsed) == nil {
+		e.Code = parsed.Error.Code
+		e.Message = parsed.Error.Message
+		e.InnerError = parsed.Error.InnerError
+	}
+
+	if e.InnerError != nil {
+		if e.RequestID == "" {
+			e.RequestID = e.InnerError.RequestID
+		}
+		if e.ClientRequestID == "" {
+			e.ClientRequestID = e.InnerError.ClientRequestID
+		}
+	}
+
+	return e
+}
+
+func (e *GraphError) Error() string {
+	switch {
+	case e.Message != "" && e.Code != "":
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	case e.Message != "":
+		return e.Message
+	case e.Body != "":
+		return fmt.Sprintf("status %d: %s", e.StatusCode, e.Body)
+	}
+	return fmt.Sprintf("status %d: %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Kind classifies the error by its HTTP status
+func (e *GraphError) Kind() Kind {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return KindValidation
+	case http.StatusNotFound:
+		return KindNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return KindForbidden
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return KindConflict
+	case http.StatusTooManyRequests:
+		return KindThrottled
+	}
+	return KindOther
+}
@@ -0,0 +1,93 @@
+package graph
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how throttled (429) and unavailable (503, 504) responses are retried.
+// Unavailable responses are not retried for POST requests; see isRetryable.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt; 0 disables retrying
+	MaxRetries int
+	// MaxWait caps a single wait, whether taken from Retry-After or from backoff. Zero or less
+	// uses DefaultRetryPolicy's cap, so a wait is never unbounded.
+	MaxWait time.Duration
+}
+
+// DefaultRetryPolicy is used by clients created with NewClient
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 5,
+	MaxWait:    60 * time.Second,
+}
+
+// baseBackoff is the first backoff delay when Graph does not send Retry-After
+const baseBackoff = time.Second
+
+// isRetryable reports whether a response status should be retried for the given method.
+// A throttled request was never processed, so 429 is always retried. A 503 or 504 may arrive
+// after Graph has committed the change, so those are only retried for idempotent methods;
+// retrying a POST could create a duplicate or turn the success into a 400 or 409.
+func isRetryable(method string, statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		switch strings.ToUpper(method) {
+		case http.MethodGet, http.MethodPut, http.MethodDelete, http.MethodPatch:
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait before retry number attempt (starting at 0).
+// Retry-After is honored when present; otherwise exponential backoff with full jitter is used.
+func (p RetryPolicy) delay(attempt int, header http.Header) time.Duration {
+	if wait, ok := parseRetryAfter(header.Get("Retry-After")); ok {
+		return p.cap(wait)
+	}
+
+	backoff := baseBackoff << uint(attempt)
+	if backoff <= 0 {
+		// The shift overflowed; fall back to the cap
+		backoff = p.maxWait()
+	}
+	return time.Duration(rand.Int63n(int64(p.cap(backoff)) + 1))
+}
+
+func (p RetryPolicy) cap(wait time.Duration) time.Duration {
+	if limit := p.maxWait(); wait > limit {
+		return limit
+	}
+	return wait
+}
+
+// maxWait returns the effective cap on a single wait
+func (p RetryPolicy) maxWait() time.Duration {
+	if p.MaxWait <= 0 {
+		return DefaultRetryPolicy.MaxWait
+	}
+	return p.MaxWait
+}
+
+// parseRetryAfter accepts both forms of Retry-After: delay in seconds or an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		wait := time.Until(when)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
@@ -0,0 +1,81 @@
+package groups
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"GraphUserAdmin/internal/graph"
+)
+
+// RetentionDays is how long Microsoft Entra ID keeps a deleted Microsoft 365 group before removing it for good
+const RetentionDays = 30
+
+// DeletedGroup is a group in the directory's recycle bin
+type DeletedGroup struct {
+	ID              string    `json:"id"`
+	DisplayName     string    `json:"displayName"`
+	Mail            string    `json:"mail,omitempty"`
+	MailNickname    string    `json:"mailNickname,omitempty"`
+	DeletedDateTime time.Time `json:"deletedDateTime"`
+}
+
+// PurgeDate returns when the group is removed for good and can no longer be restored
+func (g DeletedGroup) PurgeDate() time.Time {
+	return g.DeletedDateTime.AddDate(0, 0, RetentionDays)
+}
+
+// deletedGroupsPath lists the deleted groups in the recycle bin
+const deletedGroupsPath = "/directory/deletedItems/microsoft.graph.group"
+
+// ListDeletedGroups retrieves the groups that were deleted in the last RetentionDays days
+func ListDeletedGroups(client *graph.Client) ([]DeletedGroup, error) {
+	query := url.Values{"$select": {"id,displayName,mail,mailNickname,deletedDateTime"}}
+
+	deleted, err := graph.List[DeletedGroup](client, &graph.Request{Path: deletedGroupsPath, Query: query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deleted groups: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// FindDeletedGroup looks up a deleted group by object ID, display name, mail address or mail nickname
+func FindDeletedGroup(client *graph.Client, idOrName string) (*DeletedGroup, error) {
+	deleted, err := ListDeletedGroups(client)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []DeletedGroup
+	for _, group := range deleted {
+		if strings.EqualFold(group.ID, idOrName) || strings.EqualFold(group.DisplayName, idOrName) ||
+			(group.Mail != "" && strings.EqualFold(group.Mail, idOrName)) ||
+			(group.MailNickname != "" && strings.EqualFold(group.MailNickname, idOrName)) {
+			matches = append(matches, group)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no deleted group %s; it may have been restored, or deleted more than %d days ago", idOrName, RetentionDays)
+	case 1:
+		return &matches[0], nil
+	default:
+		return nil, fmt.Errorf("%d deleted groups match %s; use the object ID from 'gua groups deleted list'", len(matches), idOrName)
+	}
+}
+
+// RestoreDeletedGroup restores a deleted group with its members, owners and mail address
+func RestoreDeletedGroup(client *graph.Client, id string) (*Group, error) {
+	path := fmt.Sprintf("/directory/deletedItems/%s/restore", url.PathEscape(id))
+
+	var group Group
+	if err := client.Do(&graph.Request{Method: http.MethodPost, Path: path}, &group); err != nil {
+		return nil, fmt.Errorf("failed to restore group: %w", err)
+	}
+
+	return &group, nil
+}
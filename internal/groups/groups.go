@@ -1,172 +1,213 @@
 package groups
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-)
+	"net/url"
+	"strings"
 
-const baseURL = "https://graph.microsoft.com/v1.0"
+	"GraphUserAdmin/internal/graph"
+)
 
 // Group represents a Microsoft 365 group
 type Group struct {
 	ID          string `json:"id,omitempty"`
 	DisplayName string `json:"displayName,omitempty"`
 	Description string `json:"description,omitempty"`
+	// GroupTypes contains Unified for Microsoft 365 groups and DynamicMembership for dynamic groups
+	GroupTypes            []string `json:"groupTypes,omitempty"`
+	OnPremisesSyncEnabled bool     `json:"onPremisesSyncEnabled,omitempty"`
+	Mail                  string   `json:"mail,omitempty"`
+	MailNickname          string   `json:"mailNickname,omitempty"`
+	MailEnabled           bool     `json:"mailEnabled,omitempty"`
+	SecurityEnabled       bool     `json:"securityEnabled,omitempty"`
+	// Visibility is Private, Public or HiddenMembership; only Microsoft 365 groups have one
+	Visibility string `json:"visibility,omitempty"`
+}
+
+// Unified reports whether the group is a Microsoft 365 group
+func (g Group) Unified() bool {
+	for _, groupType := range g.GroupTypes {
+		if strings.EqualFold(groupType, "Unified") {
+			return true
+		}
+	}
+	return false
 }
 
-// GroupResponse represents the response when listing groups
-type GroupResponse struct {
-	Value    []Group `json:"value"`
-	NextLink string  `json:"@odata.nextLink,omitempty"`
+// Kind describes the type of the group as the admin centers do
+func (g Group) Kind() string {
+	switch {
+	case g.Unified():
+		return "Microsoft 365"
+	case g.MailEnabled && g.SecurityEnabled:
+		return "Mail-enabled security"
+	case g.MailEnabled:
+		return "Distribution"
+	default:
+		return "Security"
+	}
 }
 
-// ListGroups retrieves all groups from Microsoft 365
-func ListGroups(accessToken string) ([]Group, error) {
-	url := fmt.Sprintf("%s/groups", baseURL)
-	var allGroups []Group
-
-	for url != "" {
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create request: %w", err)
+// Dynamic reports whether the group's members are set by a membership rule rather than by hand
+func (g Group) Dynamic() bool {
+	for _, groupType := range g.GroupTypes {
+		if strings.EqualFold(groupType, "DynamicMembership") {
+			return true
 		}
+	}
+	return false
+}
 
-		req.Header.Set("Authorization", "Bearer "+accessToken)
-		req.Header.Set("Content-Type", "application/json")
+// ListGroups retrieves all groups from Microsoft 365
+func ListGroups(client *graph.Client) ([]Group, error) {
+	allGroups, err := graph.List[Group](client, &graph.Request{Path: "/groups"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get groups: %w", err)
+	}
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get groups: %w", err)
-		}
-		defer resp.Body.Close()
+	return allGroups, nil
+}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response: %w", err)
-		}
+// GetGroup retrieves a specific group by ID
+func GetGroup(client *graph.Client, groupID string) (*Group, error) {
+	var group Group
+	if err := client.Get("/groups/"+url.PathEscape(groupID), &group); err != nil {
+		return nil, fmt.Errorf("failed to get group: %w", err)
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("failed to get groups (status %d): %s", resp.StatusCode, string(body))
-		}
+	return &group, nil
+}
 
-		var groupResponse GroupResponse
-		if err := json.Unmarshal(body, &groupResponse); err != nil {
-			return nil, fmt.Errorf("failed to parse response: %w", err)
-		}
+// GetUserGroups retrieves all groups that a user is a member of. Directory roles and administrative
+// units the user belongs to are left out.
+func GetUserGroups(client *graph.Client, userPrincipalName string) ([]Group, error) {
+	path := fmt.Sprintf("/users/%s/memberOf/microsoft.graph.group", url.PathEscape(userPrincipalName))
 
-		allGroups = append(allGroups, groupResponse.Value...)
-		url = groupResponse.NextLink
+	allGroups, err := graph.List[Group](client, &graph.Request{Path: path})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user groups: %w", err)
 	}
 
 	return allGroups, nil
 }
 
-// GetUserGroups retrieves all groups that a user is a member of
-func GetUserGroups(accessToken, userPrincipalName string) ([]Group, error) {
-	url := fmt.Sprintf("%s/users/%s/memberOf", baseURL, userPrincipalName)
-	var allGroups []Group
+// AddMemberToGroup adds a user to a group
+func AddMemberToGroup(client *graph.Client, groupID, userID string) error {
+	path := fmt.Sprintf("/groups/%s/members/$ref", url.PathEscape(groupID))
 
-	for url != "" {
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create request: %w", err)
-		}
+	// Create request body with the user's directory object ID; the reference must use the
+	// same cloud's Graph endpoint as the request itself
+	requestBody := map[string]string{
+		"@odata.id": fmt.Sprintf("%s/directoryObjects/%s", client.BaseURL, userID),
+	}
 
-		req.Header.Set("Authorization", "Bearer "+accessToken)
-		req.Header.Set("Content-Type", "application/json")
+	if err := client.Post(path, requestBody, nil); err != nil {
+		return fmt.Errorf("failed to add member to group: %w", err)
+	}
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get user groups: %w", err)
-		}
-		defer resp.Body.Close()
+	return nil
+}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response: %w", err)
-		}
+// AddMembersToGroup adds many users to a group through JSON batching and returns the errors in request order
+func AddMembersToGroup(client *graph.Client, groupID string, userIDs []string) []error {
+	path := fmt.Sprintf("/groups/%s/members/$ref", url.PathEscape(groupID))
 
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("failed to get user groups (status %d): %s", resp.StatusCode, string(body))
+	items := make([]*graph.BatchItem, len(userIDs))
+	for i, userID := range userIDs {
+		requestBody := map[string]string{
+			"@odata.id": fmt.Sprintf("%s/directoryObjects/%s", client.BaseURL, userID),
 		}
+		items[i] = &graph.BatchItem{Request: &graph.Request{Method: http.MethodPost, Path: path, Body: requestBody}}
+	}
 
-		var groupResponse GroupResponse
-		if err := json.Unmarshal(body, &groupResponse); err != nil {
-			return nil, fmt.Errorf("failed to parse response: %w", err)
-		}
+	client.Batch(items)
 
-		allGroups = append(allGroups, groupResponse.Value...)
-		url = groupResponse.NextLink
+	errs := make([]error, len(items))
+	for i, item := range items {
+		if item.Err != nil {
+			errs[i] = fmt.Errorf("failed to add member to group: %w", item.Err)
+		}
 	}
+	return errs
+}
 
-	return allGroups, nil
+// CreateGroupRequest is the body of a group creation request
+type CreateGroupRequest struct {
+	DisplayName     string   `json:"displayName"`
+	Description     string   `json:"description,omitempty"`
+	MailNickname    string   `json:"mailNickname"`
+	MailEnabled     bool     `json:"mailEnabled"`
+	SecurityEnabled bool     `json:"securityEnabled"`
+	GroupTypes      []string `json:"groupTypes"`
+	Visibility      string   `json:"visibility,omitempty"`
 }
 
-// AddMemberToGroup adds a user to a group
-func AddMemberToGroup(accessToken, groupID, userID string) error {
-	url := fmt.Sprintf("%s/groups/%s/members/$ref", baseURL, groupID)
+// Types of group that can be created
+const (
+	TypeSecurity     = "security"
+	TypeMicrosoft365 = "m365"
+)
 
-	// Create request body with the user's directory object ID
-	requestBody := map[string]string{
-		"@odata.id": fmt.Sprintf("https://graph.microsoft.com/v1.0/directoryObjects/%s", userID),
+// Visibilities lists the visibility values of a Microsoft 365 group
+var Visibilities = []string{"Private", "Public", "HiddenMembership"}
+
+// NewCreateGroupRequest builds the request for a group of the given type
+func NewCreateGroupRequest(groupType, displayName, mailNickname string) (CreateGroupRequest, error) {
+	createReq := CreateGroupRequest{DisplayName: displayName, MailNickname: mailNickname, GroupTypes: []string{}}
+
+	switch strings.ToLower(groupType) {
+	case TypeSecurity:
+		createReq.SecurityEnabled = true
+	case TypeMicrosoft365, "unified":
+		createReq.MailEnabled = true
+		createReq.GroupTypes = []string{"Unified"}
+	case "mail-security", "distribution":
+		// Graph can only create security and Microsoft 365 groups
+		return CreateGroupRequest{}, fmt.Errorf("Microsoft Graph can't create mail-enabled security groups or distribution lists: create them in the Exchange admin center")
+	default:
+		return CreateGroupRequest{}, fmt.Errorf("unknown group type %q: use %s or %s", groupType, TypeSecurity, TypeMicrosoft365)
 	}
 
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
+	return createReq, nil
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+// CreateGroup creates a group
+func CreateGroup(client *graph.Client, createReq CreateGroupRequest) (*Group, error) {
+	var group Group
+	if err := client.Post("/groups", createReq, &group); err != nil {
+		return nil, fmt.Errorf("failed to create group: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
+	return &group, nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to add member to group: %w", err)
+// UpdateGroup updates properties of a group
+func UpdateGroup(client *graph.Client, groupID string, properties map[string]interface{}) error {
+	if err := client.Patch("/groups/"+url.PathEscape(groupID), properties); err != nil {
+		return fmt.Errorf("failed to update group: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to add member to group (status %d): %s", resp.StatusCode, string(body))
+	return nil
+}
+
+// DeleteGroup deletes a group. Microsoft 365 groups can be restored for RetentionDays days;
+// other groups are deleted for good.
+func DeleteGroup(client *graph.Client, groupID string) error {
+	if err := client.Delete("/groups/" + url.PathEscape(groupID)); err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
 	}
 
 	return nil
 }
 
 // RemoveMemberFromGroup removes a user from a group
-func RemoveMemberFromGroup(accessToken, groupID, userID string) error {
-	url := fmt.Sprintf("%s/groups/%s/members/%s/$ref", baseURL, groupID, userID)
+func RemoveMemberFromGroup(client *graph.Client, groupID, userID string) error {
+	path := fmt.Sprintf("/groups/%s/members/%s/$ref", url.PathEscape(groupID), url.PathEscape(userID))
 
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
+	if err := client.Delete(path); err != nil {
 		return fmt.Errorf("failed to remove member from group: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to remove member from group (status %d): %s", resp.StatusCode, string(body))
-	}
 
 	return nil
 }
@@ -0,0 +1,46 @@
+package groups
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewCreateGroupRequest(t *testing.T) {
+	tests := []struct {
+		groupType string
+		want      string
+		wantErr   string
+	}{
+		{"security", `{"displayName":"Sales","mailNickname":"sales","mailEnabled":false,"securityEnabled":true,"groupTypes":[]}`, ""},
+		{"Security", `{"displayName":"Sales","mailNickname":"sales","mailEnabled":false,"securityEnabled":true,"groupTypes":[]}`, ""},
+		{"m365", `{"displayName":"Sales","mailNickname":"sales","mailEnabled":true,"securityEnabled":false,"groupTypes":["Unified"]}`, ""},
+		{"unified", `{"displayName":"Sales","mailNickname":"sales","mailEnabled":true,"securityEnabled":false,"groupTypes":["Unified"]}`, ""},
+		{"distribution", "", "Exchange admin center"},
+		{"mail-security", "", "Exchange admin center"},
+		{"dynamic", "", `unknown group type "dynamic"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.groupType, func(t *testing.T) {
+			createReq, err := NewCreateGroupRequest(test.groupType, "Sales", "sales")
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("error is %v, want one about %s", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewCreateGroupRequest: %v", err)
+			}
+
+			body, err := json.Marshal(createReq)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != test.want {
+				t.Errorf("body is %s, want %s", body, test.want)
+			}
+		})
+	}
+}
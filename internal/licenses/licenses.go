@@ -1,14 +1,14 @@
 package licenses
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-)
+	"net/url"
+	"strings"
 
-const baseURL = "https://graph.microsoft.com/v1.0"
+	"GraphUserAdmin/internal/graph"
+)
 
 // PrepaidUnits represents the prepaid units for a SKU
 type PrepaidUnits struct {
@@ -26,12 +26,6 @@ type SubscribedSku struct {
 	PrepaidUnits  PrepaidUnits `json:"prepaidUnits"`
 }
 
-// SkuResponse represents the response when listing SKUs
-type SkuResponse struct {
-	Value    []SubscribedSku `json:"value"`
-	NextLink string          `json:"@odata.nextLink,omitempty"`
-}
-
 // LicenseDetail represents a user's license detail
 type LicenseDetail struct {
 	ID            string `json:"id,omitempty"`
@@ -39,9 +33,12 @@ type LicenseDetail struct {
 	SkuPartNumber string `json:"skuPartNumber,omitempty"`
 }
 
-// LicenseDetailResponse represents the response when getting user licenses
-type LicenseDetailResponse struct {
-	Value []LicenseDetail `json:"value"`
+// LicenseAssignmentState is one way a user holds a license: directly, or through a group
+type LicenseAssignmentState struct {
+	SkuID string `json:"skuId"`
+	// AssignedByGroup is the ID of the group the license comes from; empty for a direct assignment
+	AssignedByGroup string `json:"assignedByGroup"`
+	State           string `json:"state"`
 }
 
 // AddLicense represents a license to add
@@ -56,262 +53,195 @@ type AssignLicenseRequest struct {
 }
 
 // GetSubscribedSkus retrieves all subscribed SKUs for the tenant
-func GetSubscribedSkus(accessToken string) ([]SubscribedSku, error) {
-	url := fmt.Sprintf("%s/subscribedSkus", baseURL)
-	var allSkus []SubscribedSku
-
-	for url != "" {
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create request: %w", err)
-		}
-
-		req.Header.Set("Authorization", "Bearer "+accessToken)
-		req.Header.Set("Content-Type", "application/json")
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get SKUs: %w", err)
-		}
-		defer resp.Body.Close()
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response: %w", err)
-		}
-
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("failed to get SKUs (status %d): %s", resp.StatusCode, string(body))
-		}
-
-		var skuResponse SkuResponse
-		if err := json.Unmarshal(body, &skuResponse); err != nil {
-			return nil, fmt.Errorf("failed to parse response: %w", err)
-		}
-
-		allSkus = append(allSkus, skuResponse.Value...)
-		url = skuResponse.NextLink
+func GetSubscribedSkus(client *graph.Client) ([]SubscribedSku, error) {
+	allSkus, err := graph.List[SubscribedSku](client, &graph.Request{Path: "/subscribedSkus"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SKUs: %w", err)
 	}
 
 	return allSkus, nil
 }
 
-// GetUserLicenses retrieves licenses assigned to a specific user
-func GetUserLicenses(accessToken, userPrincipalName string) ([]LicenseDetail, error) {
-	url := fmt.Sprintf("%s/users/%s/licenseDetails", baseURL, userPrincipalName)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// ResolveSkuIDs converts SKU part numbers such as ENTERPRISEPACK to SKU IDs. Values that are
+// already SKU IDs are kept as they are, and are checked against the tenant's SKUs when verify is set.
+func ResolveSkuIDs(client *graph.Client, values []string, verify bool) ([]string, error) {
+	needLookup := verify
+	for _, value := range values {
+		if !isGUID(value) {
+			needLookup = true
+		}
 	}
-
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user licenses: %w", err)
+	if !needLookup {
+		return values, nil
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	skus, err := GetSubscribedSkus(client)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get user licenses (status %d): %s", resp.StatusCode, string(body))
+		return nil, err
 	}
 
-	var licenseResponse LicenseDetailResponse
-	if err := json.Unmarshal(body, &licenseResponse); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	skuIDs := make([]string, len(values))
+	for i, value := range values {
+		for _, sku := range skus {
+			if strings.EqualFold(sku.SkuID, value) || strings.EqualFold(sku.SkuPartNumber, value) {
+				skuIDs[i] = sku.SkuID
+				break
+			}
+		}
+		if skuIDs[i] == "" {
+			return nil, fmt.Errorf("SKU %q is not subscribed in this tenant; use 'licenses list-skus' to see available SKUs", value)
+		}
 	}
 
-	return licenseResponse.Value, nil
+	return skuIDs, nil
 }
 
-// AssignLicense adds or removes licenses for a user
-func AssignLicense(accessToken, userPrincipalName string, addLicenses []string, removeLicenses []string) error {
-	url := fmt.Sprintf("%s/users/%s/assignLicense", baseURL, userPrincipalName)
-
-	// Convert string slices to proper structures
-	addLicenseObjs := make([]AddLicense, len(addLicenses))
-	for i, skuID := range addLicenses {
-		addLicenseObjs[i] = AddLicense{SkuID: skuID}
-	}
-
-	assignReq := AssignLicenseRequest{
-		AddLicenses:    addLicenseObjs,
-		RemoveLicenses: removeLicenses,
-	}
-
-	jsonData, err := json.Marshal(assignReq)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to assign license: %w", err)
+// isGUID reports whether s has the form of a GUID
+func isGUID(s string) bool {
+	if len(s) != 36 {
+		return false
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-
-	if resp.StatusCode != http.StatusOK {
-		// Parse error response for better messages
-		var errorResponse map[string]interface{}
-		if json.Unmarshal(body, &errorResponse) == nil {
-			if errorObj, ok := errorResponse["error"].(map[string]interface{}); ok {
-				if message, ok := errorObj["message"].(string); ok {
-					// Provide helpful context for common errors
-					if contains(message, "No available licenses") || contains(message, "license") {
-						return fmt.Errorf("license assignment failed: %s\n\nPossible causes:\n  - Not enough available licenses (check with 'gua licenses list-skus')\n  - User doesn't have usageLocation set (use 'gua users update <UPN> usageLocation US')", message)
-					}
-					if contains(message, "usageLocation") {
-						return fmt.Errorf("license assignment failed: %s\n\nUser must have a usageLocation set. Use:\n  gua users update <UPN> usageLocation <country-code>\n  Example: gua users update user@example.com usageLocation US", message)
-					}
-					return fmt.Errorf("license assignment failed: %s", message)
-				}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return false
 			}
 		}
-		return fmt.Errorf("failed to assign license (status %d): %s", resp.StatusCode, string(body))
 	}
-
-	return nil
+	return true
 }
 
-// Helper function to check if a string contains a substring (case-insensitive)
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
-		(len(s) > 0 && len(substr) > 0 && findSubstring(s, substr)))
-}
+// GetUserLicenses retrieves licenses assigned to a specific user
+func GetUserLicenses(client *graph.Client, userPrincipalName string) ([]LicenseDetail, error) {
+	path := fmt.Sprintf("/users/%s/licenseDetails", url.PathEscape(userPrincipalName))
 
-func findSubstring(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if matchAt(s, substr, i) {
-			return true
-		}
+	licenseList, err := graph.List[LicenseDetail](client, &graph.Request{Path: path})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user licenses: %w", err)
 	}
-	return false
-}
 
-func matchAt(s, substr string, pos int) bool {
-	for i := 0; i < len(substr); i++ {
-		if toLower(s[pos+i]) != toLower(substr[i]) {
-			return false
-		}
-	}
-	return true
+	return licenseList, nil
 }
 
-func toLower(c byte) byte {
-	if c >= 'A' && c <= 'Z' {
-		return c + 32
+// GetLicenseAssignmentStates retrieves how each of a user's licenses is assigned. A license can be
+// held both directly and through groups; only direct assignments can be removed with AssignLicense.
+func GetLicenseAssignmentStates(client *graph.Client, userPrincipalName string) ([]LicenseAssignmentState, error) {
+	var user struct {
+		LicenseAssignmentStates []LicenseAssignmentState `json:"licenseAssignmentStates"`
 	}
-	return c
+	query := url.Values{"$select": {"licenseAssignmentStates"}}
+	req := &graph.Request{Method: http.MethodGet, Path: "/users/" + url.PathEscape(userPrincipalName), Query: query}
+	if err := client.Do(req, &user); err != nil {
+		return nil, fmt.Errorf("failed to get user license assignments: %w", err)
+	}
+
+	return user.LicenseAssignmentStates, nil
 }
 
-// GetGroupLicenses retrieves licenses assigned to a specific group
-func GetGroupLicenses(accessToken, groupID string) ([]LicenseDetail, error) {
-	url := fmt.Sprintf("%s/groups/%s/assignedLicenses", baseURL, groupID)
+// AssignLicense adds or removes licenses for a user
+func AssignLicense(client *graph.Client, userPrincipalName string, addLicenses []string, removeLicenses []string) error {
+	path := fmt.Sprintf("/users/%s/assignLicense", url.PathEscape(userPrincipalName))
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	if err := client.Post(path, newAssignLicenseRequest(addLicenses, removeLicenses), nil); err != nil {
+		// Provide helpful context for common errors
+		return fmt.Errorf("license assignment failed: %w%s", err, assignmentHint(err, false))
 	}
 
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get group licenses: %w", err)
-	}
-	defer resp.Body.Close()
+	return nil
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+// AssignLicenses adds or removes the same licenses for many users through JSON batching and returns
+// the errors in request order. When usageLocation is set it is set on each user first, since
+// Graph refuses to license a user without one; the assignment then depends on that update.
+func AssignLicenses(client *graph.Client, userPrincipalNames []string, addLicenses []string, removeLicenses []string, usageLocation string) []error {
+	body := newAssignLicenseRequest(addLicenses, removeLicenses)
+
+	var items []*graph.BatchItem
+	assignments := make([]*graph.BatchItem, len(userPrincipalNames))
+	for i, upn := range userPrincipalNames {
+		userPath := "/users/" + url.PathEscape(upn)
+
+		assignment := &graph.BatchItem{Request: &graph.Request{Method: http.MethodPost, Path: userPath + "/assignLicense", Body: body}}
+		if usageLocation != "" {
+			items = append(items, &graph.BatchItem{Request: &graph.Request{
+				Method: http.MethodPatch,
+				Path:   userPath,
+				Body:   map[string]string{"usageLocation": usageLocation},
+			}})
+			assignment.DependsOn = []int{len(items) - 1}
+		}
+		items = append(items, assignment)
+		assignments[i] = assignment
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get group licenses (status %d): %s", resp.StatusCode, string(body))
-	}
+	client.Batch(items)
 
-	var licenseResponse LicenseDetailResponse
-	if err := json.Unmarshal(body, &licenseResponse); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	errs := make([]error, len(assignments))
+	for i, assignment := range assignments {
+		if assignment.Err != nil {
+			errs[i] = fmt.Errorf("license assignment failed: %w", assignment.Err)
+		}
 	}
-
-	return licenseResponse.Value, nil
+	return errs
 }
 
-// AssignGroupLicense adds or removes licenses for a group
-func AssignGroupLicense(accessToken, groupID string, addLicenses []string, removeLicenses []string) error {
-	url := fmt.Sprintf("%s/groups/%s/assignLicense", baseURL, groupID)
-
-	// Convert string slices to proper structures
+// newAssignLicenseRequest converts SKU ID slices to the assignLicense request body
+func newAssignLicenseRequest(addLicenses []string, removeLicenses []string) AssignLicenseRequest {
 	addLicenseObjs := make([]AddLicense, len(addLicenses))
 	for i, skuID := range addLicenses {
 		addLicenseObjs[i] = AddLicense{SkuID: skuID}
 	}
 
-	assignReq := AssignLicenseRequest{
+	return AssignLicenseRequest{
 		AddLicenses:    addLicenseObjs,
 		RemoveLicenses: removeLicenses,
 	}
+}
 
-	jsonData, err := json.Marshal(assignReq)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+// assignmentHint returns troubleshooting advice for common license assignment failures
+func assignmentHint(err error, group bool) string {
+	var graphErr *graph.GraphError
+	if !errors.As(err, &graphErr) {
+		return ""
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	message := strings.ToLower(graphErr.Message)
+	switch {
+	case !group && (strings.Contains(message, "usagelocation") || strings.Contains(message, "usage location")):
+		return "\n\nUser must have a usageLocation set. Use:\n  gua users update <UPN> usageLocation <country-code>\n  Example: gua users update user@example.com usageLocation US"
+	case strings.Contains(message, "license"):
+		if group {
+			return "\n\nPossible causes:\n  - Not enough available licenses (check with 'gua licenses list-skus')\n  - Group members don't have usageLocation set"
+		}
+		return "\n\nPossible causes:\n  - Not enough available licenses (check with 'gua licenses list-skus')\n  - User doesn't have usageLocation set (use 'gua users update <UPN> usageLocation US')"
 	}
+	return ""
+}
 
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
+// GetGroupLicenses retrieves licenses assigned to a specific group
+func GetGroupLicenses(client *graph.Client, groupID string) ([]LicenseDetail, error) {
+	path := fmt.Sprintf("/groups/%s/assignedLicenses", url.PathEscape(groupID))
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	licenseList, err := graph.List[LicenseDetail](client, &graph.Request{Path: path})
 	if err != nil {
-		return fmt.Errorf("failed to assign group license: %w", err)
+		return nil, fmt.Errorf("failed to get group licenses: %w", err)
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-
-	if resp.StatusCode != http.StatusOK {
-		// Parse error response for better messages
-		var errorResponse map[string]interface{}
-		if json.Unmarshal(body, &errorResponse) == nil {
-			if errorObj, ok := errorResponse["error"].(map[string]interface{}); ok {
-				if message, ok := errorObj["message"].(string); ok {
-					// Provide helpful context for common errors
-					if contains(message, "No available licenses") || contains(message, "license") {
-						return fmt.Errorf("group license assignment failed: %s\n\nPossible causes:\n  - Not enough available licenses (check with 'gua licenses list-skus')\n  - Group members don't have usageLocation set", message)
-					}
-					return fmt.Errorf("group license assignment failed: %s", message)
-				}
-			}
-		}
-		return fmt.Errorf("failed to assign group license (status %d): %s", resp.StatusCode, string(body))
+
+	return licenseList, nil
+}
+
+// AssignGroupLicense adds or removes licenses for a group
+func AssignGroupLicense(client *graph.Client, groupID string, addLicenses []string, removeLicenses []string) error {
+	path := fmt.Sprintf("/groups/%s/assignLicense", url.PathEscape(groupID))
+
+	if err := client.Post(path, newAssignLicenseRequest(addLicenses, removeLicenses), nil); err != nil {
+		// Provide helpful context for common errors
+		return fmt.Errorf("group license assignment failed: %w%s", err, assignmentHint(err, true))
 	}
 
 	return nil
@@ -0,0 +1,144 @@
+package offboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"GraphUserAdmin/internal/fileutil"
+)
+
+// Step names, in the order the workflow runs them
+const (
+	Disable        = "disable"
+	RevokeSessions = "revoke-sessions"
+	Licenses       = "licenses"
+	Groups         = "groups"
+	HideFromGAL    = "hide-from-gal"
+	Delete         = "delete"
+)
+
+// Steps lists the workflow's steps in order
+var Steps = []string{Disable, RevokeSessions, Licenses, Groups, HideFromGAL, Delete}
+
+// Step statuses
+const (
+	Done      = "done"
+	Failed    = "failed"
+	Skipped   = "skipped"
+	Scheduled = "scheduled"
+	Planned   = "planned"
+)
+
+// StepState is the recorded outcome of one step
+type StepState struct {
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+	Detail string    `json:"detail,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// State is the progress of offboarding one user. It is saved after every step, so an interrupted
+// or partly failed run can be resumed by running the workflow again.
+type State struct {
+	UserPrincipalName string `json:"userPrincipalName"`
+	// UserID keeps the user addressable after a rename and identifies them in the report after deletion.
+	// A UPN can be reused for a new user later, so the state only applies to the user with this ID.
+	UserID  string    `json:"userId"`
+	Started time.Time `json:"started"`
+	// DeleteAfterDays is how long after being disabled the user is deleted; nil means never
+	DeleteAfterDays *int                  `json:"deleteAfterDays,omitempty"`
+	Steps           map[string]*StepState `json:"steps"`
+
+	path string
+}
+
+// DefaultDir returns the directory for offboarding state files in the user's configuration directory
+func DefaultDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config directory: %w", err)
+	}
+	return filepath.Join(dir, "gua", "offboard"), nil
+}
+
+// Load reads the state of offboarding the user from dir, or returns a new state when there is none
+func Load(dir, userPrincipalName string) (*State, error) {
+	path := filepath.Join(dir, fileName(userPrincipalName))
+	state := &State{UserPrincipalName: userPrincipalName, Steps: map[string]*StepState{}, path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read offboarding state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse offboarding state %s: %w", path, err)
+	}
+	if state.Steps == nil {
+		state.Steps = map[string]*StepState{}
+	}
+	return state, nil
+}
+
+// Path returns the file the state is saved to
+func (s *State) Path() string {
+	return s.path
+}
+
+// Save writes the state to its file, readable only by the current user. The file is replaced in one
+// step, so an interrupted save leaves the previous state intact.
+func (s *State) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode offboarding state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create offboarding state directory: %w", err)
+	}
+	// Two runs for the same user can't mix their writes
+	if err := fileutil.WriteFileAtomic(s.path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write offboarding state: %w", err)
+	}
+	return nil
+}
+
+// Done reports whether the step has completed in this or an earlier run
+func (s *State) Done(step string) bool {
+	return s.Steps[step] != nil && s.Steps[step].Status == Done
+}
+
+// Reset forgets all progress, including the user's ID and the deletion schedule
+func (s *State) Reset() {
+	s.UserID = ""
+	s.Started = time.Time{}
+	s.DeleteAfterDays = nil
+	s.Steps = map[string]*StepState{}
+}
+
+// Record sets the outcome of a step
+func (s *State) Record(step, status, detail string, err error) {
+	state := &StepState{Status: status, Time: time.Now().UTC(), Detail: detail}
+	if err != nil {
+		state.Status = Failed
+		state.Error = err.Error()
+	}
+	s.Steps[step] = state
+}
+
+// fileName turns a UPN into a file name, keeping it readable
+func fileName(userPrincipalName string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.ToLower(userPrincipalName))
+	return name + ".json"
+}
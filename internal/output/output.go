@@ -0,0 +1,297 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is an output format selected with --output
+type Format string
+
+const (
+	Table Format = "table"
+	JSON  Format = "json"
+	JSONL Format = "jsonl"
+	CSV   Format = "csv"
+	YAML  Format = "yaml"
+)
+
+// Formats lists the supported formats in the order they are shown to users
+var Formats = []Format{Table, JSON, JSONL, CSV, YAML}
+
+// ParseFormat validates a format name; an empty name is the table format
+func ParseFormat(name string) (Format, error) {
+	if name == "" {
+		return Table, nil
+	}
+	for _, format := range Formats {
+		if strings.EqualFold(string(format), name) {
+			return format, nil
+		}
+	}
+
+	names := make([]string, len(Formats))
+	for i, format := range Formats {
+		names[i] = string(format)
+	}
+	return "", fmt.Errorf("unknown output format %q: use one of %s", name, strings.Join(names, ", "))
+}
+
+// Column is one field shown in table and CSV output. JSON, JSON Lines and YAML output
+// always contain the complete value, so columns only affect the tabular formats.
+type Column struct {
+	Header string
+	// Field is the JSON property name; use dots for nested properties (e.g. "prepaidUnits.enabled")
+	Field string
+	// Compute derives the cell from the whole record instead of reading Field
+	Compute func(record map[string]interface{}) interface{}
+}
+
+// Printer renders command results in the selected format
+type Printer struct {
+	Format Format
+	Out    io.Writer
+}
+
+// List renders a slice of values
+func (p *Printer) List(items interface{}, columns []Column) error {
+	// A nil slice is rendered as an empty list, not as JSON null
+	if v := reflect.ValueOf(items); v.Kind() == reflect.Slice && v.IsNil() {
+		items = []interface{}{}
+	}
+
+	switch p.Format {
+	case JSON:
+		return p.writeJSON(items, true)
+	case JSONL:
+		records, err := toRawList(items)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := p.writeCompact(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	case YAML:
+		return p.writeYAML(items)
+	}
+
+	records, err := toRecords(items)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(records))
+	for i, record := range records {
+		rows[i] = cells(record, columns)
+	}
+
+	if p.Format == CSV {
+		return p.writeCSV(headers(columns), rows)
+	}
+
+	w := tabwriter.NewWriter(p.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers(columns), "\t"))
+	fmt.Fprintln(w, strings.Join(underlines(columns), "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// Object renders a single value; the table format shows one "Header: value" line per column
+func (p *Printer) Object(item interface{}, columns []Column) error {
+	switch p.Format {
+	case JSON:
+		return p.writeJSON(item, true)
+	case JSONL:
+		return p.writeJSON(item, false)
+	case YAML:
+		return p.writeYAML(item)
+	}
+
+	records, err := toRecords([]interface{}{item})
+	if err != nil {
+		return err
+	}
+	row := cells(records[0], columns)
+
+	if p.Format == CSV {
+		return p.writeCSV(headers(columns), [][]string{row})
+	}
+
+	w := tabwriter.NewWriter(p.Out, 0, 0, 1, ' ', 0)
+	for i, column := range columns {
+		fmt.Fprintf(w, "%s:\t%s\n", column.Header, row[i])
+	}
+	return w.Flush()
+}
+
+func (p *Printer) writeJSON(v interface{}, indent bool) error {
+	var data []byte
+	var err error
+	if indent {
+		data, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		data, err = json.Marshal(v)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	_, err = fmt.Fprintln(p.Out, string(data))
+	return err
+}
+
+func (p *Printer) writeCompact(raw json.RawMessage) error {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	_, err := fmt.Fprintln(p.Out, buf.String())
+	return err
+}
+
+func (p *Printer) writeCSV(header []string, rows [][]string) error {
+	w := csv.NewWriter(p.Out)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	return w.Error()
+}
+
+func (p *Printer) writeYAML(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	node, err := yamlNode(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	_, err = p.Out.Write(buf.Bytes())
+	return err
+}
+
+// toRawList marshals a slice and splits it into its JSON elements
+func toRawList(items interface{}) ([]json.RawMessage, error) {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode output: %w", err)
+	}
+	var records []json.RawMessage
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to encode output: %w", err)
+	}
+	return records, nil
+}
+
+// toRecords converts a slice of values to generic JSON objects so columns can address them by property name
+func toRecords(items interface{}) ([]map[string]interface{}, error) {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode output: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var records []map[string]interface{}
+	if err := decoder.Decode(&records); err != nil {
+		return nil, fmt.Errorf("failed to encode output: %w", err)
+	}
+	return records, nil
+}
+
+func headers(columns []Column) []string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Header
+	}
+	return names
+}
+
+func underlines(columns []Column) []string {
+	lines := make([]string, len(columns))
+	for i, column := range columns {
+		lines[i] = strings.Repeat("-", len([]rune(column.Header)))
+	}
+	return lines
+}
+
+func cells(record map[string]interface{}, columns []Column) []string {
+	row := make([]string, len(columns))
+	for i, column := range columns {
+		if column.Compute != nil {
+			row[i] = FormatValue(column.Compute(record))
+		} else {
+			row[i] = FormatValue(Lookup(record, column.Field))
+		}
+	}
+	return row
+}
+
+// Lookup reads a (possibly dotted) property from a record
+func Lookup(record map[string]interface{}, field string) interface{} {
+	var value interface{} = record
+	for _, part := range strings.Split(field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[part]
+	}
+	return value
+}
+
+// FormatValue renders a JSON value as a single table or CSV cell
+func FormatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = FormatValue(item)
+		}
+		return strings.Join(parts, "; ")
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,130 @@
+package output
+
+import (
+	"strings"
+	"testing"
+)
+
+type testUser struct {
+	Name    string            `json:"displayName"`
+	Enabled bool              `json:"accountEnabled"`
+	Manager map[string]string `json:"manager,omitempty"`
+	Groups  []string          `json:"groups"`
+}
+
+var testUsers = []testUser{
+	{Name: "Jane Doe", Enabled: true, Manager: map[string]string{"displayName": "Ann Lee"}, Groups: []string{"Sales", "All"}},
+	{Name: "Smith, John", Enabled: false},
+}
+
+var testColumns = []Column{
+	{Header: "Name", Field: "displayName"},
+	{Header: "Enabled", Field: "accountEnabled"},
+	{Header: "Manager", Field: "manager.displayName"},
+	{Header: "Groups", Field: "groups"},
+	{Header: "Initial", Compute: func(record map[string]interface{}) interface{} {
+		return Lookup(record, "displayName").(string)[:1]
+	}},
+}
+
+func TestPrinterList(t *testing.T) {
+	tests := []struct {
+		format Format
+		items  interface{}
+		want   string
+	}{
+		{Table, testUsers, `Name         Enabled  Manager  Groups      Initial
+----         -------  -------  ------      -------
+Jane Doe     true     Ann Lee  Sales; All  J
+Smith, John  false                         S
+`},
+		{Table, []testUser(nil), `Name  Enabled  Manager  Groups  Initial
+----  -------  -------  ------  -------
+`},
+		{JSON, testUsers, `[
+  {
+    "displayName": "Jane Doe",
+    "accountEnabled": true,
+    "manager": {
+      "displayName": "Ann Lee"
+    },
+    "groups": [
+      "Sales",
+      "All"
+    ]
+  },
+  {
+    "displayName": "Smith, John",
+    "accountEnabled": false,
+    "groups": null
+  }
+]
+`},
+		{JSON, []testUser(nil), "[]\n"},
+		{JSONL, testUsers, `{"displayName":"Jane Doe","accountEnabled":true,"manager":{"displayName":"Ann Lee"},"groups":["Sales","All"]}
+{"displayName":"Smith, John","accountEnabled":false,"groups":null}
+`},
+		{JSONL, []testUser(nil), ""},
+		{CSV, testUsers, `Name,Enabled,Manager,Groups,Initial
+Jane Doe,true,Ann Lee,Sales; All,J
+"Smith, John",false,,,S
+`},
+		{CSV, []testUser(nil), "Name,Enabled,Manager,Groups,Initial\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			var out strings.Builder
+			printer := &Printer{Format: test.format, Out: &out}
+			if err := printer.List(test.items, testColumns); err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if out.String() != test.want {
+				t.Errorf("output is\n%s\nwant\n%s", out.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestPrinterObject(t *testing.T) {
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{Table, `Name:    Jane Doe
+Enabled: true
+Manager: Ann Lee
+Groups:  Sales; All
+Initial: J
+`},
+		{JSONL, `{"displayName":"Jane Doe","accountEnabled":true,"manager":{"displayName":"Ann Lee"},"groups":["Sales","All"]}
+`},
+		{CSV, `Name,Enabled,Manager,Groups,Initial
+Jane Doe,true,Ann Lee,Sales; All,J
+`},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			var out strings.Builder
+			printer := &Printer{Format: test.format, Out: &out}
+			if err := printer.Object(testUsers[0], testColumns); err != nil {
+				t.Fatalf("Object: %v", err)
+			}
+			if out.String() != test.want {
+				t.Errorf("output is\n%s\nwant\n%s", out.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for name, want := range map[string]Format{"": Table, "JSON": JSON, "jsonl": JSONL, "Csv": CSV, "yaml": YAML} {
+		if format, err := ParseFormat(name); err != nil || format != want {
+			t.Errorf("ParseFormat(%q) = %q (%v), want %q", name, format, err, want)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil || !strings.Contains(err.Error(), "table, json, jsonl, csv, yaml") {
+		t.Errorf("error for an unknown format is %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlNode parses JSON into a YAML node tree. Object keys keep their JSON order, so YAML
+// output matches the struct layout, and every scalar is tagged with its JSON type so the
+// encoder quotes strings that a YAML reader would take for another type.
+func yamlNode(data []byte) (*yaml.Node, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decodeNode(decoder)
+}
+
+func decodeNode(decoder *json.Decoder) (*yaml.Node, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := token.(type) {
+	case json.Delim:
+		switch v {
+		case '{':
+			node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeNode(decoder)
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, stringNode(key.(string)), value)
+			}
+			_, err = decoder.Token()
+			return node, err
+		case '[':
+			node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			for decoder.More() {
+				item, err := decodeNode(decoder)
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, item)
+			}
+			_, err = decoder.Token()
+			return node, err
+		}
+		return nil, fmt.Errorf("unexpected JSON delimiter %v", v)
+	case string:
+		return stringNode(v), nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(v.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: v.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: fmt.Sprint(v)}, nil
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+	return nil, fmt.Errorf("unexpected JSON token %v", token)
+}
+
+// stringNode returns a string scalar, quoted when a YAML 1.1 or 1.2 reader would take it for another type
+func stringNode(s string) *yaml.Node {
+	// "<<" is a merge key, which Encode tags as such rather than quoting it
+	if s == "<<" {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s, Style: yaml.DoubleQuotedStyle}
+	}
+
+	// Encode also quotes the YAML 1.1 booleans (yes, off, ...) and sexagesimal numbers (1:20),
+	// which the encoder leaves plain in a node built by hand
+	node := &yaml.Node{}
+	if err := node.Encode(s); err != nil {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s, Style: yaml.DoubleQuotedStyle}
+	}
+	return node
+}
@@ -0,0 +1,168 @@
+package output
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestYAMLStrings(t *testing.T) {
+	tests := []struct {
+		in string
+		// quoted is whether the string must be quoted to be read back as a string
+		quoted bool
+	}{
+		{"John Smith", false},
+		{"john@contoso.com", false},
+		{"/users/x", false},
+		{".hidden", false},
+		{"", true},
+
+		// YAML 1.1 booleans and null
+		{"yes", true},
+		{"No", true},
+		{"ON", true},
+		{"off", true},
+		{"y", true},
+		{"true", true},
+		{"False", true},
+		{"null", true},
+		{"NULL", true},
+		{"~", true},
+
+		// Numbers and timestamps, including the YAML 1.1 forms
+		{"123", true},
+		{"1.5", true},
+		{"1e3", true},
+		{"0x1F", true},
+		{"0o17", true},
+		{"0b101", true},
+		{"017", true},
+		{"1_000", true},
+		{"+1", true},
+		{".inf", true},
+		{".NaN", true},
+		{".5", true},
+		{"1:20", true},
+		{"2024-01-15", true},
+		{"2024-01-15T10:00:00Z", true},
+
+		// Merge key and indicators
+		{"<<", true},
+		{"-1", true},
+		{"- item", true},
+		{"@contoso", true},
+		{"*alias", true},
+		{"&anchor", true},
+		{"!tag", true},
+		{"#comment", true},
+		{" leading", true},
+		{"trailing ", true},
+		{"key: value", true},
+		{"value # comment", true},
+		{"[x]", true},
+		{"{x}", true},
+		{`say "hi"`, false},
+		{"tab\there", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			var out strings.Builder
+			printer := &Printer{Format: YAML, Out: &out}
+			if err := printer.Object(test.in, nil); err != nil {
+				t.Fatalf("Object: %v", err)
+			}
+
+			quoted := strings.HasPrefix(out.String(), `"`) || strings.HasPrefix(out.String(), `'`)
+			if quoted != test.quoted {
+				t.Errorf("YAML is %q, want quoted %v", out.String(), test.quoted)
+			}
+
+			var value interface{}
+			if err := yaml.Unmarshal([]byte(out.String()), &value); err != nil {
+				t.Fatalf("YAML %q does not parse: %v", out.String(), err)
+			}
+			if value != test.in {
+				t.Errorf("YAML %q reads back as %#v", out.String(), value)
+			}
+		})
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want string
+	}{
+		{"scalar", "yes", `"yes"` + "\n"},
+		{"empty map", map[string]interface{}{}, "{}\n"},
+		{"empty list", []string{}, "[]\n"},
+		{"nil list", []string(nil), "null\n"},
+		{
+			"object keeps field order",
+			struct {
+				Name    string   `json:"name"`
+				Enabled bool     `json:"enabled"`
+				Count   int      `json:"count"`
+				Ratio   float64  `json:"ratio"`
+				Manager *string  `json:"manager"`
+				Tags    []string `json:"tags"`
+				Empty   []string `json:"empty"`
+				Props   struct{} `json:"props"`
+			}{Name: "John", Enabled: true, Count: 3, Ratio: 0.5, Tags: []string{"a", "no"}, Empty: []string{}},
+			`name: John
+enabled: true
+count: 3
+ratio: 0.5
+manager: null
+tags:
+  - a
+  - "no"
+empty: []
+props: {}
+`,
+		},
+		{
+			"list of objects",
+			[]map[string]interface{}{
+				{"id": "1", "groups": []string{"x"}},
+				{},
+				{"id": "2", "note": "first\nsecond"},
+			},
+			`- groups:
+    - x
+  id: "1"
+- {}
+- id: "2"
+  note: |-
+    first
+    second
+`,
+		},
+		{
+			"nested lists",
+			[][]interface{}{{"a", 1}, {}, {[]string{"deep"}}},
+			`- - a
+  - 1
+- []
+- - - deep
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			printer := &Printer{Format: YAML, Out: &out}
+			if err := printer.Object(test.in, nil); err != nil {
+				t.Fatalf("Object: %v", err)
+			}
+			if out.String() != test.want {
+				t.Errorf("YAML is\n%s\nwant\n%s", out.String(), test.want)
+			}
+		})
+	}
+}
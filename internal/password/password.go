@@ -0,0 +1,140 @@
+package password
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Character classes that generated passwords draw from
+const (
+	Lower   = "lower"
+	Upper   = "upper"
+	Digits  = "digits"
+	Symbols = "symbols"
+)
+
+// classChars are the characters of each class
+var classChars = map[string]string{
+	Lower:   "abcdefghijklmnopqrstuvwxyz",
+	Upper:   "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	Digits:  "0123456789",
+	Symbols: "!@#$%^&*-_=+?",
+}
+
+// Classes lists the character classes in the order they are shown to users
+var Classes = []string{Lower, Upper, Digits, Symbols}
+
+// ambiguous are characters that are easily confused when read out or typed from a printout
+const ambiguous = "0O1lI"
+
+// Length limits for generated passwords. Microsoft Entra ID accepts 8 to 256 characters.
+const (
+	MinLength = 8
+	MaxLength = 256
+)
+
+// minClasses is how many character classes Microsoft Entra ID requires in a password
+const minClasses = 3
+
+// Policy describes the passwords Generate produces
+type Policy struct {
+	Length int
+	// Classes are the character classes to use; every password contains at least one character of each
+	Classes []string
+	// ExcludeAmbiguous leaves out look-alike characters such as 0/O and 1/l/I
+	ExcludeAmbiguous bool
+}
+
+// DefaultPolicy generates 16 characters from all classes without ambiguous characters
+var DefaultPolicy = Policy{
+	Length:           16,
+	Classes:          Classes,
+	ExcludeAmbiguous: true,
+}
+
+// Validate checks that the policy produces passwords Microsoft Entra ID accepts
+func (p Policy) Validate() error {
+	if p.Length < MinLength || p.Length > MaxLength {
+		return fmt.Errorf("password length must be between %d and %d", MinLength, MaxLength)
+	}
+
+	seen := map[string]bool{}
+	for _, class := range p.Classes {
+		if _, ok := classChars[class]; !ok {
+			return fmt.Errorf("unknown character class %q: use %s", class, strings.Join(Classes, ", "))
+		}
+		seen[class] = true
+	}
+	if len(seen) < minClasses {
+		return fmt.Errorf("passwords need at least %d character classes of %s", minClasses, strings.Join(Classes, ", "))
+	}
+
+	return nil
+}
+
+// Generate returns a random password that follows the policy
+func (p Policy) Generate() (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+
+	var sets []string
+	for _, class := range p.Classes {
+		set := classChars[class]
+		if p.ExcludeAmbiguous {
+			set = strings.Map(func(r rune) rune {
+				if strings.ContainsRune(ambiguous, r) {
+					return -1
+				}
+				return r
+			}, set)
+		}
+		sets = append(sets, set)
+	}
+
+	// One character from each class, then the rest from all of them
+	all := strings.Join(sets, "")
+	password := make([]byte, p.Length)
+	for i := range password {
+		set := all
+		if i < len(sets) {
+			set = sets[i]
+		}
+		c, err := randomChar(set)
+		if err != nil {
+			return "", err
+		}
+		password[i] = c
+	}
+
+	// Move the guaranteed characters away from the start
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := randomInt(i + 1)
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j] = password[j], password[i]
+	}
+
+	return string(password), nil
+}
+
+// randomChar picks a character from set
+func randomChar(set string) (byte, error) {
+	i, err := randomInt(len(set))
+	if err != nil {
+		return 0, err
+	}
+	return set[i], nil
+}
+
+// randomInt returns a uniformly distributed integer in [0, n)
+func randomInt(n int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate password: %w", err)
+	}
+	return int(v.Int64()), nil
+}
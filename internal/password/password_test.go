@@ -0,0 +1,75 @@
+package password
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+	}{
+		{"default", DefaultPolicy},
+		{"shortest", Policy{Length: MinLength, Classes: Classes, ExcludeAmbiguous: true}},
+		{"longest", Policy{Length: MaxLength, Classes: Classes}},
+		{"three classes", Policy{Length: 12, Classes: []string{Lower, Upper, Digits}, ExcludeAmbiguous: true}},
+		{"ambiguous allowed", Policy{Length: 20, Classes: []string{Upper, Digits, Symbols}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allowed := ""
+			for _, class := range test.policy.Classes {
+				allowed += classChars[class]
+			}
+
+			for n := 0; n < 200; n++ {
+				password, err := test.policy.Generate()
+				if err != nil {
+					t.Fatalf("Generate: %v", err)
+				}
+
+				if len(password) != test.policy.Length {
+					t.Fatalf("password %q has %d characters, want %d", password, len(password), test.policy.Length)
+				}
+				for _, class := range test.policy.Classes {
+					if !strings.ContainsAny(password, classChars[class]) {
+						t.Fatalf("password %q has no %s character", password, class)
+					}
+				}
+				for _, r := range password {
+					if !strings.ContainsRune(allowed, r) {
+						t.Fatalf("password %q contains %q, which is not in its classes", password, r)
+					}
+				}
+				if test.policy.ExcludeAmbiguous && strings.ContainsAny(password, ambiguous) {
+					t.Fatalf("password %q contains an ambiguous character", password)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateRejectsInvalidPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		err    string
+	}{
+		{"too short", Policy{Length: MinLength - 1, Classes: Classes}, "password length must be between 8 and 256"},
+		{"too long", Policy{Length: MaxLength + 1, Classes: Classes}, "password length must be between 8 and 256"},
+		{"two classes", Policy{Length: 16, Classes: []string{Lower, Upper}}, "passwords need at least 3 character classes"},
+		{"repeated class", Policy{Length: 16, Classes: []string{Lower, Lower, Upper}}, "passwords need at least 3 character classes"},
+		{"unknown class", Policy{Length: 16, Classes: []string{Lower, Upper, "emoji"}}, `unknown character class "emoji"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			password, err := test.policy.Generate()
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("Generate returned %q, %v, want error %q", password, err, test.err)
+			}
+		})
+	}
+}
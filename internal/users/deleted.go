@@ -0,0 +1,108 @@
+package users
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"GraphUserAdmin/internal/graph"
+)
+
+// RetentionDays is how long Microsoft Entra ID keeps a deleted user before removing it for good
+const RetentionDays = 30
+
+// DeletedUser is a user in the directory's recycle bin
+type DeletedUser struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+	// UserPrincipalName is the deleted object's UPN, which Graph prefixes with the object ID
+	UserPrincipalName string    `json:"userPrincipalName"`
+	Mail              string    `json:"mail,omitempty"`
+	DeletedDateTime   time.Time `json:"deletedDateTime"`
+}
+
+// OriginalUserPrincipalName returns the UPN the user had before deletion
+func (u DeletedUser) OriginalUserPrincipalName() string {
+	prefix := strings.ReplaceAll(u.ID, "-", "")
+	if len(u.UserPrincipalName) > len(prefix) && strings.EqualFold(u.UserPrincipalName[:len(prefix)], prefix) {
+		return u.UserPrincipalName[len(prefix):]
+	}
+	return u.UserPrincipalName
+}
+
+// PurgeDate returns when the user is removed for good and can no longer be restored
+func (u DeletedUser) PurgeDate() time.Time {
+	return u.DeletedDateTime.AddDate(0, 0, RetentionDays)
+}
+
+// DaysRemaining returns the whole days left to restore the user, counting a started day
+func (u DeletedUser) DaysRemaining(now time.Time) int {
+	left := u.PurgeDate().Sub(now)
+	if left <= 0 {
+		return 0
+	}
+	return int((left + 24*time.Hour - 1) / (24 * time.Hour))
+}
+
+// deletedUsersPath lists the deleted users in the recycle bin
+const deletedUsersPath = "/directory/deletedItems/microsoft.graph.user"
+
+// ListDeletedUsers retrieves the users that were deleted in the last RetentionDays days
+func ListDeletedUsers(client *graph.Client) ([]DeletedUser, error) {
+	query := url.Values{"$select": {"id,displayName,userPrincipalName,mail,deletedDateTime"}}
+
+	deleted, err := graph.List[DeletedUser](client, &graph.Request{Path: deletedUsersPath, Query: query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deleted users: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// FindDeletedUser looks up a deleted user by object ID or by the UPN they had before deletion
+func FindDeletedUser(client *graph.Client, idOrUserPrincipalName string) (*DeletedUser, error) {
+	deleted, err := ListDeletedUsers(client)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []DeletedUser
+	for _, user := range deleted {
+		if strings.EqualFold(user.ID, idOrUserPrincipalName) ||
+			strings.EqualFold(user.OriginalUserPrincipalName(), idOrUserPrincipalName) {
+			matches = append(matches, user)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no deleted user %s; it may have been restored or purged, or deleted more than %d days ago", idOrUserPrincipalName, RetentionDays)
+	case 1:
+		return &matches[0], nil
+	default:
+		return nil, fmt.Errorf("%d deleted users had the UPN %s; use the object ID from 'gua users deleted list'", len(matches), idOrUserPrincipalName)
+	}
+}
+
+// RestoreDeletedUser restores a deleted user with its licenses, group memberships and original UPN
+func RestoreDeletedUser(client *graph.Client, id string) (*User, error) {
+	path := fmt.Sprintf("/directory/deletedItems/%s/restore", url.PathEscape(id))
+
+	var user User
+	if err := client.Do(&graph.Request{Method: http.MethodPost, Path: path}, &user); err != nil {
+		return nil, fmt.Errorf("failed to restore user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// PurgeDeletedUser removes a deleted user for good
+func PurgeDeletedUser(client *graph.Client, id string) error {
+	if err := client.Delete("/directory/deletedItems/" + url.PathEscape(id)); err != nil {
+		return fmt.Errorf("failed to purge user: %w", err)
+	}
+
+	return nil
+}
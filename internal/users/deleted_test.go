@@ -0,0 +1,59 @@
+package users
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOriginalUserPrincipalName(t *testing.T) {
+	const id = "3f2504e0-4f89-11d3-9a0c-0305e82c3301"
+
+	tests := []struct {
+		name string
+		upn  string
+		want string
+	}{
+		{"ID prefix", "3f2504e04f8911d39a0c0305e82c3301jdoe@contoso.com", "jdoe@contoso.com"},
+		{"upper-case ID prefix", "3F2504E04F8911D39A0C0305E82C3301jdoe@contoso.com", "jdoe@contoso.com"},
+		{"no ID prefix", "jdoe@contoso.com", "jdoe@contoso.com"},
+		{"another object's ID", "0000000000000000000000000000000ajdoe@contoso.com", "0000000000000000000000000000000ajdoe@contoso.com"},
+		{"only the ID", "3f2504e04f8911d39a0c0305e82c3301", "3f2504e04f8911d39a0c0305e82c3301"},
+		{"shorter than the ID", "jd@contoso.com", "jd@contoso.com"},
+		{"empty", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user := DeletedUser{ID: id, UserPrincipalName: test.upn}
+			if got := user.OriginalUserPrincipalName(); got != test.want {
+				t.Errorf("OriginalUserPrincipalName() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDaysRemaining(t *testing.T) {
+	now := time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		deleted time.Time
+		want    int
+	}{
+		{"just deleted", now, 30},
+		{"a day ago", now.AddDate(0, 0, -1), 29},
+		{"a started day counts", now.AddDate(0, 0, -29).Add(-time.Hour), 1},
+		{"last minute", now.AddDate(0, 0, -30).Add(time.Minute), 1},
+		{"exactly 30 days ago", now.AddDate(0, 0, -30), 0},
+		{"more than 30 days ago", now.AddDate(0, 0, -45), 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user := DeletedUser{DeletedDateTime: test.deleted}
+			if got := user.DaysRemaining(now); got != test.want {
+				t.Errorf("DaysRemaining() = %d, want %d (purged %v)", got, test.want, user.PurgeDate())
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package users
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ImportRow is one user read from an import CSV file
+type ImportRow struct {
+	// Line is the row's line number in the file, for reporting
+	Line int
+	// Request is the user to create; PasswordProfile.Password is empty when the file has none
+	Request CreateUserRequest
+	// Manager is the UPN or object ID of the user's manager, if any
+	Manager string
+	// Err is set when the row cannot be imported
+	Err error
+}
+
+// collectionProperties maps the lowercase names of user properties that take a list to Graph's
+// spelling; their CSV values are separated by semicolons
+var collectionProperties = map[string]string{
+	"businessphones": "businessPhones",
+	"othermails":     "otherMails",
+}
+
+// ReadImportFile reads users from CSV. The header row names the properties: userPrincipalName (or upn)
+// and displayName are required; mailNickname defaults to the UPN's local part; password,
+// forceChangePasswordNextSignIn, accountEnabled and manager are optional. Every other column is set
+// as the user property it names, such as usageLocation, department or jobTitle. Empty cells are skipped.
+func ReadImportFile(r io.Reader) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	// A row with the wrong number of columns is reported on its own rather than failing the file
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("the file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	for i, name := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+	}
+	if !hasColumn(header, "userPrincipalName", "upn") || !hasColumn(header, "displayName") {
+		return nil, fmt.Errorf("the CSV header must include userPrincipalName and displayName columns")
+	}
+
+	var rows []ImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := ImportRow{Line: line}
+		row.Request, row.Manager, row.Err = parseImportRecord(header, record)
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// parseImportRecord maps one CSV record onto a create request
+func parseImportRecord(header, record []string) (CreateUserRequest, string, error) {
+	req := CreateUserRequest{
+		AccountEnabled:  true,
+		PasswordProfile: PasswordProfile{ForceChangePasswordNextSignIn: true},
+	}
+	var manager string
+
+	if len(record) != len(header) {
+		return req, manager, fmt.Errorf("the row has %d columns, the header has %d", len(record), len(header))
+	}
+
+	for i, name := range header {
+		value := strings.TrimSpace(record[i])
+		if value == "" || name == "" {
+			continue
+		}
+
+		var err error
+		switch strings.ToLower(name) {
+		case "userprincipalname", "upn":
+			req.UserPrincipalName = value
+		case "displayname":
+			req.DisplayName = value
+		case "mailnickname":
+			req.MailNickname = value
+		case "password":
+			req.PasswordProfile.Password = value
+		case "forcechangepasswordnextsignin", "forcechangepassword":
+			req.PasswordProfile.ForceChangePasswordNextSignIn, err = strconv.ParseBool(value)
+		case "accountenabled":
+			req.AccountEnabled, err = strconv.ParseBool(value)
+		case "manager":
+			manager = value
+		default:
+			if req.Extra == nil {
+				req.Extra = map[string]interface{}{}
+			}
+			if property, ok := collectionProperties[strings.ToLower(name)]; ok {
+				req.Extra[property] = splitList(value)
+			} else {
+				req.Extra[name] = value
+			}
+		}
+		if err != nil {
+			return req, manager, fmt.Errorf("invalid %s %q: use true or false", name, value)
+		}
+	}
+
+	if req.UserPrincipalName == "" {
+		return req, manager, fmt.Errorf("userPrincipalName is empty")
+	}
+	if req.DisplayName == "" {
+		return req, manager, fmt.Errorf("displayName is empty")
+	}
+	if req.MailNickname == "" {
+		req.MailNickname = strings.SplitN(req.UserPrincipalName, "@", 2)[0]
+	}
+
+	return req, manager, nil
+}
+
+// hasColumn reports whether the header contains one of the names, ignoring case
+func hasColumn(header []string, names ...string) bool {
+	for _, column := range header {
+		for _, name := range names {
+			if strings.EqualFold(column, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitList splits a semicolon-separated cell into its non-empty values
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ";") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,131 @@
+package users
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseImportRecord(t *testing.T) {
+	header := []string{"upn", "displayName", "accountEnabled", "forceChangePassword", "manager", "department", "BusinessPhones"}
+
+	tests := []struct {
+		name    string
+		record  []string
+		want    func(req *CreateUserRequest)
+		manager string
+		err     string
+	}{
+		{
+			name:   "defaults",
+			record: []string{"john@contoso.com", "John Doe", "", "", "", "", ""},
+			want: func(req *CreateUserRequest) {
+				req.UserPrincipalName = "john@contoso.com"
+				req.DisplayName = "John Doe"
+				req.MailNickname = "john"
+			},
+		},
+		{
+			name:   "booleans and properties",
+			record: []string{"john@contoso.com", "John Doe", "false", "FALSE", "", " Sales ", "+1 555 0100; +1 555 0101"},
+			want: func(req *CreateUserRequest) {
+				req.UserPrincipalName = "john@contoso.com"
+				req.DisplayName = "John Doe"
+				req.MailNickname = "john"
+				req.AccountEnabled = false
+				req.PasswordProfile.ForceChangePasswordNextSignIn = false
+				req.Extra = map[string]interface{}{
+					"department":     "Sales",
+					"businessPhones": []string{"+1 555 0100", "+1 555 0101"},
+				}
+			},
+		},
+		{
+			name:    "manager",
+			record:  []string{"john@contoso.com", "John Doe", "", "", "jane@contoso.com", "", ""},
+			manager: "jane@contoso.com",
+			want: func(req *CreateUserRequest) {
+				req.UserPrincipalName = "john@contoso.com"
+				req.DisplayName = "John Doe"
+				req.MailNickname = "john"
+			},
+		},
+		{
+			name:   "missing UPN",
+			record: []string{"", "John Doe", "", "", "", "", ""},
+			err:    "userPrincipalName is empty",
+		},
+		{
+			name:   "missing display name",
+			record: []string{"john@contoso.com", " ", "", "", "", "", ""},
+			err:    "displayName is empty",
+		},
+		{
+			name:   "invalid boolean",
+			record: []string{"john@contoso.com", "John Doe", "maybe", "", "", "", ""},
+			err:    `invalid accountEnabled "maybe": use true or false`,
+		},
+		{
+			name:   "too few columns",
+			record: []string{"john@contoso.com", "John Doe"},
+			err:    "the row has 2 columns, the header has 7",
+		},
+		{
+			name:   "too many columns",
+			record: []string{"john@contoso.com", "John Doe", "", "", "", "", "", "extra"},
+			err:    "the row has 8 columns, the header has 7",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, manager, err := parseImportRecord(header, test.record)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("error is %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseImportRecord: %v", err)
+			}
+
+			want := CreateUserRequest{
+				AccountEnabled:  true,
+				PasswordProfile: PasswordProfile{ForceChangePasswordNextSignIn: true},
+			}
+			test.want(&want)
+			if !reflect.DeepEqual(req, want) {
+				t.Errorf("request is %+v, want %+v", req, want)
+			}
+			if manager != test.manager {
+				t.Errorf("manager is %q, want %q", manager, test.manager)
+			}
+		})
+	}
+}
+
+func TestReadImportFileReportsRaggedRows(t *testing.T) {
+	file := "userPrincipalName,displayName,department\n" +
+		"john@contoso.com,John Doe,Sales\n" +
+		"jane@contoso.com,Jane Doe\n" +
+		"joe@contoso.com,Joe Doe,Sales,extra\n" +
+		"amy@contoso.com,Amy Doe,Finance\n"
+
+	rows, err := ReadImportFile(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("ReadImportFile: %v", err)
+	}
+
+	if len(rows) != 4 {
+		t.Fatalf("read %d rows, want 4", len(rows))
+	}
+	for i, row := range rows {
+		if failed := i == 1 || i == 2; failed != (row.Err != nil) {
+			t.Errorf("row %d error is %v", i, row.Err)
+		}
+		if row.Line != i+2 {
+			t.Errorf("row %d is on line %d, want %d", i, row.Line, i+2)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package users
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds of problems found while building an org chart
+const (
+	IssueNoManager       = "no-manager"
+	IssueManagerMissing  = "manager-not-found"
+	IssueDisabledManager = "disabled-manager"
+	IssueCycle           = "cycle"
+)
+
+// OrgIssue is a problem in the manager relationships of an org chart
+type OrgIssue struct {
+	Kind string `json:"kind"`
+	// User is the UPN of the user the issue is about
+	User   string `json:"user"`
+	Detail string `json:"detail"`
+}
+
+// OrgEdge is a manager relationship between two users of the chart
+type OrgEdge struct {
+	ManagerID string `json:"managerId"`
+	UserID    string `json:"userId"`
+	// Cycle marks a relationship that is part of a management cycle
+	Cycle bool `json:"cycle,omitempty"`
+}
+
+// OrgChart is the reporting structure of a set of users
+type OrgChart struct {
+	// Roots are the users at the top of the chart: those without a manager in the chart, and one user of each cycle
+	Roots  []*ReportNode `json:"roots"`
+	Edges  []OrgEdge     `json:"-"`
+	Issues []OrgIssue    `json:"issues"`
+
+	// Users are the chart's users in display name order
+	Users []*ReportNode `json:"-"`
+}
+
+// BuildOrgChart arranges users, listed with their manager expanded, into trees and reports users
+// without a manager, managers that are not among the users, disabled managers and cycles.
+// The expanded manager must include accountEnabled, so that disabled managers outside the chart are found too.
+func BuildOrgChart(userList []User) *OrgChart {
+	chart := &OrgChart{Roots: []*ReportNode{}, Issues: []OrgIssue{}}
+
+	nodes := map[string]*ReportNode{}
+	byID := map[string]*User{}
+	for i := range userList {
+		user := &userList[i]
+		byID[user.ID] = user
+		nodes[user.ID] = newReportNode(user)
+		chart.Users = append(chart.Users, nodes[user.ID])
+	}
+	sort.SliceStable(chart.Users, func(i, j int) bool {
+		return strings.ToLower(chart.Users[i].DisplayName) < strings.ToLower(chart.Users[j].DisplayName)
+	})
+
+	// managerOf holds the manager of every user whose manager is in the chart
+	managerOf := map[string]string{}
+	reports := map[string][]*ReportNode{}
+	// outside holds the managers that are not in the chart, with the number of users they manage in it
+	var outside []*User
+	outsideReports := map[string]int{}
+	for _, node := range chart.Users {
+		user := byID[node.ID]
+		switch {
+		case user.Manager == nil:
+			chart.Issues = append(chart.Issues, OrgIssue{Kind: IssueNoManager, User: user.UserPrincipalName, Detail: "has no manager"})
+		case byID[user.Manager.ID] == nil:
+			chart.Issues = append(chart.Issues, OrgIssue{Kind: IssueManagerMissing, User: user.UserPrincipalName,
+				Detail: fmt.Sprintf("manager %s is not in the chart", managerName(user.Manager))})
+			if outsideReports[user.Manager.ID] == 0 {
+				outside = append(outside, user.Manager)
+			}
+			outsideReports[user.Manager.ID]++
+		default:
+			managerOf[user.ID] = user.Manager.ID
+			reports[user.Manager.ID] = append(reports[user.Manager.ID], node)
+		}
+	}
+
+	for _, node := range chart.Users {
+		if !node.AccountEnabled && len(reports[node.ID]) > 0 {
+			chart.Issues = append(chart.Issues, OrgIssue{Kind: IssueDisabledManager, User: node.UserPrincipalName,
+				Detail: fmt.Sprintf("disabled account manages %d user(s)", len(reports[node.ID]))})
+		}
+	}
+	for _, manager := range outside {
+		if !manager.AccountEnabled {
+			chart.Issues = append(chart.Issues, OrgIssue{Kind: IssueDisabledManager, User: managerName(manager),
+				Detail: fmt.Sprintf("disabled account outside the chart manages %d user(s) in it", outsideReports[manager.ID])})
+		}
+	}
+
+	// Walk up from every user; reaching a user already on the current path means a cycle
+	inCycle := map[string]bool{}
+	finished := map[string]bool{}
+	for _, node := range chart.Users {
+		var path []string
+		onPath := map[string]int{}
+		id := node.ID
+		for id != "" && !finished[id] {
+			if start, ok := onPath[id]; ok {
+				cycle := path[start:]
+				var names []string
+				for _, member := range cycle {
+					inCycle[member] = true
+					names = append(names, nodes[member].UserPrincipalName)
+				}
+				names = append(names, nodes[id].UserPrincipalName)
+				chart.Issues = append(chart.Issues, OrgIssue{Kind: IssueCycle, User: nodes[id].UserPrincipalName,
+					Detail: "management cycle: " + strings.Join(names, " → ")})
+				// The first user of the cycle heads it in the chart
+				chart.Roots = append(chart.Roots, nodes[id])
+				break
+			}
+			onPath[id] = len(path)
+			path = append(path, id)
+			id = managerOf[id]
+		}
+		for _, member := range path {
+			finished[member] = true
+		}
+	}
+
+	for _, node := range chart.Users {
+		if _, ok := managerOf[node.ID]; !ok {
+			chart.Roots = append(chart.Roots, node)
+		}
+		if manager, ok := managerOf[node.ID]; ok {
+			chart.Edges = append(chart.Edges, OrgEdge{ManagerID: manager, UserID: node.ID, Cycle: inCycle[node.ID] && inCycle[manager]})
+		}
+	}
+	sort.SliceStable(chart.Roots, func(i, j int) bool {
+		return strings.ToLower(chart.Roots[i].DisplayName) < strings.ToLower(chart.Roots[j].DisplayName)
+	})
+
+	// Build the trees from the roots; the relationship that closes a cycle is left out
+	placed := map[string]bool{}
+	var attach func(node *ReportNode)
+	attach = func(node *ReportNode) {
+		placed[node.ID] = true
+		for _, report := range reports[node.ID] {
+			if placed[report.ID] {
+				continue
+			}
+			node.Reports = append(node.Reports, report)
+			attach(report)
+		}
+	}
+	for _, root := range chart.Roots {
+		attach(root)
+	}
+
+	return chart
+}
+
+// managerName names a manager for messages
+func managerName(manager *User) string {
+	if manager.UserPrincipalName != "" {
+		return manager.UserPrincipalName
+	}
+	if manager.DisplayName != "" {
+		return manager.DisplayName
+	}
+	return manager.ID
+}
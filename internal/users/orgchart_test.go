@@ -0,0 +1,148 @@
+package users
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// orgUser returns a user listed with their manager expanded; an empty managerID means no manager
+func orgUser(id, displayName, managerID string) User {
+	user := User{ID: id, DisplayName: displayName, UserPrincipalName: id + "@contoso.com", AccountEnabled: true}
+	if managerID != "" {
+		user.Manager = &User{ID: managerID, UserPrincipalName: managerID + "@contoso.com", AccountEnabled: true}
+	}
+	return user
+}
+
+// treeString writes a node and its reports as "Name(Report,Report(...))"
+func treeString(node *ReportNode) string {
+	if len(node.Reports) == 0 {
+		return node.DisplayName
+	}
+	var reports []string
+	for _, report := range node.Reports {
+		reports = append(reports, treeString(report))
+	}
+	return node.DisplayName + "(" + strings.Join(reports, ",") + ")"
+}
+
+// checkChart compares the chart's trees, edges and issues with the expected ones
+func checkChart(t *testing.T, chart *OrgChart, trees, edges, issues []string) {
+	t.Helper()
+
+	var gotTrees []string
+	for _, root := range chart.Roots {
+		gotTrees = append(gotTrees, treeString(root))
+	}
+	if fmt.Sprint(gotTrees) != fmt.Sprint(trees) {
+		t.Errorf("trees are %q, want %q", gotTrees, trees)
+	}
+
+	var gotEdges []string
+	for _, edge := range chart.Edges {
+		edgeString := edge.ManagerID + "->" + edge.UserID
+		if edge.Cycle {
+			edgeString += " cycle"
+		}
+		gotEdges = append(gotEdges, edgeString)
+	}
+	if fmt.Sprint(gotEdges) != fmt.Sprint(edges) {
+		t.Errorf("edges are %q, want %q", gotEdges, edges)
+	}
+
+	var gotIssues []string
+	for _, issue := range chart.Issues {
+		gotIssues = append(gotIssues, issue.Kind+" "+issue.User+": "+issue.Detail)
+	}
+	if fmt.Sprint(gotIssues) != fmt.Sprint(issues) {
+		t.Errorf("issues are %q, want %q", gotIssues, issues)
+	}
+}
+
+func TestBuildOrgChartTree(t *testing.T) {
+	chart := BuildOrgChart([]User{
+		orgUser("dev2", "Dev B", "cto"),
+		orgUser("cto", "CTO", "ceo"),
+		orgUser("ceo", "CEO", ""),
+		orgUser("dev1", "Dev A", "cto"),
+	})
+
+	checkChart(t, chart,
+		[]string{"CEO(CTO(Dev A,Dev B))"},
+		[]string{"ceo->cto", "cto->dev1", "cto->dev2"},
+		[]string{"no-manager ceo@contoso.com: has no manager"})
+
+	var names []string
+	for _, node := range chart.Users {
+		names = append(names, node.DisplayName)
+	}
+	if strings.Join(names, ",") != "CEO,CTO,Dev A,Dev B" {
+		t.Errorf("users are ordered %v, want by display name", names)
+	}
+}
+
+func TestBuildOrgChartManagerOutsideChart(t *testing.T) {
+	chart := BuildOrgChart([]User{
+		orgUser("rep", "Sales Rep", "lead"),
+		orgUser("lead", "Sales Lead", "vp"),
+	})
+
+	// The user whose manager was filtered out heads the chart
+	checkChart(t, chart,
+		[]string{"Sales Lead(Sales Rep)"},
+		[]string{"lead->rep"},
+		[]string{"manager-not-found lead@contoso.com: manager vp@contoso.com is not in the chart"})
+}
+
+func TestBuildOrgChartDisabledManagerOutsideChart(t *testing.T) {
+	rep1 := orgUser("rep1", "Sales Rep A", "vp")
+	rep1.Manager.AccountEnabled = false
+	rep2 := orgUser("rep2", "Sales Rep B", "vp")
+	rep2.Manager.AccountEnabled = false
+
+	// The filter left out the disabled VP, so only the expanded manager says they are disabled
+	chart := BuildOrgChart([]User{rep2, rep1, orgUser("rep3", "Sales Rep C", "lead")})
+
+	checkChart(t, chart,
+		[]string{"Sales Rep A", "Sales Rep B", "Sales Rep C"},
+		nil,
+		[]string{
+			"manager-not-found rep1@contoso.com: manager vp@contoso.com is not in the chart",
+			"manager-not-found rep2@contoso.com: manager vp@contoso.com is not in the chart",
+			"manager-not-found rep3@contoso.com: manager lead@contoso.com is not in the chart",
+			"disabled-manager vp@contoso.com: disabled account outside the chart manages 2 user(s) in it",
+		})
+}
+
+func TestBuildOrgChartSelfManaged(t *testing.T) {
+	chart := BuildOrgChart([]User{
+		orgUser("self", "Self", "self"),
+		orgUser("rep", "Rep", "self"),
+	})
+
+	checkChart(t, chart,
+		[]string{"Self(Rep)"},
+		[]string{"self->rep", "self->self cycle"},
+		[]string{"cycle self@contoso.com: management cycle: self@contoso.com → self@contoso.com"})
+}
+
+func TestBuildOrgChartCycleWithTail(t *testing.T) {
+	carol := orgUser("carol", "Carol", "alice")
+	carol.AccountEnabled = false
+	chart := BuildOrgChart([]User{
+		orgUser("dave", "Dave", "carol"),
+		orgUser("bob", "Bob", "alice"),
+		carol,
+		orgUser("alice", "Alice", "bob"),
+	})
+
+	// Only the relationships between Alice and Bob form the cycle; Carol and Dave lead into it
+	checkChart(t, chart,
+		[]string{"Alice(Bob,Carol(Dave))"},
+		[]string{"bob->alice cycle", "alice->bob cycle", "alice->carol", "carol->dave"},
+		[]string{
+			"disabled-manager carol@contoso.com: disabled account manages 1 user(s)",
+			"cycle alice@contoso.com: management cycle: alice@contoso.com → bob@contoso.com → alice@contoso.com",
+		})
+}
@@ -0,0 +1,132 @@
+package users
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DefaultProperties are always requested with $select. Graph's default projection omits
+// accountEnabled and mailNickname, which User carries as fields.
+var DefaultProperties = []string{"id", "displayName", "userPrincipalName", "mail", "mailNickname", "accountEnabled"}
+
+// knownProperties are the JSON names of User's own fields
+var knownProperties = jsonNames(reflect.TypeOf(User{}))
+
+// createProperties are the JSON names of CreateUserRequest's own fields
+var createProperties = jsonNames(reflect.TypeOf(CreateUserRequest{}))
+
+// jsonNames returns the JSON property names of a struct type's fields
+func jsonNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// selectProperties returns the $select value for the default properties plus the requested ones.
+// Nested names such as "onPremisesExtensionAttributes.extensionAttribute1" select their top-level property.
+func selectProperties(properties []string) string {
+	selected := append([]string{}, DefaultProperties...)
+	seen := map[string]bool{}
+	for _, name := range selected {
+		seen[strings.ToLower(name)] = true
+	}
+
+	for _, name := range properties {
+		name = strings.TrimSpace(strings.Split(name, ".")[0])
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		selected = append(selected, name)
+	}
+
+	return strings.Join(selected, ",")
+}
+
+// userFields has User's fields without its JSON methods, to avoid recursion
+type userFields User
+
+// UnmarshalJSON fills User's fields and keeps every other returned property in Properties
+func (u *User) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*userFields)(u)); err != nil {
+		return err
+	}
+
+	var all map[string]interface{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+
+	u.Properties = nil
+	for name, value := range all {
+		if knownProperties[name] || strings.HasPrefix(name, "@odata.") {
+			continue
+		}
+		if u.Properties == nil {
+			u.Properties = map[string]interface{}{}
+		}
+		u.Properties[name] = value
+	}
+	return nil
+}
+
+// MarshalJSON writes User's fields followed by the extra properties in name order
+func (u User) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(userFields(u))
+	if err != nil {
+		return nil, err
+	}
+	return appendProperties(data, u.Properties, knownProperties)
+}
+
+// createFields has CreateUserRequest's fields without its JSON methods
+type createFields CreateUserRequest
+
+// MarshalJSON writes the request's fields followed by the extra properties in name order
+func (r CreateUserRequest) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(createFields(r))
+	if err != nil {
+		return nil, err
+	}
+	return appendProperties(data, r.Extra, createProperties)
+}
+
+// appendProperties adds properties to the JSON object in data, skipping names in skip
+func appendProperties(data []byte, properties map[string]interface{}, skip map[string]bool) ([]byte, error) {
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		if !skip[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return data, nil
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.Write(data[:len(data)-1])
+	for _, name := range names {
+		value, err := json.Marshal(properties[name])
+		if err != nil {
+			return nil, err
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
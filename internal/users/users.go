@@ -1,14 +1,15 @@
 package users
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-)
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 
-const baseURL = "https://graph.microsoft.com/v1.0"
+	"GraphUserAdmin/internal/graph"
+)
 
 // User represents a Microsoft 365 user
 type User struct {
@@ -17,19 +18,85 @@ type User struct {
 	UserPrincipalName string `json:"userPrincipalName,omitempty"`
 	Mail              string `json:"mail,omitempty"`
 	MailNickname      string `json:"mailNickname,omitempty"`
-	AccountEnabled    bool   `json:"accountEnabled,omitempty"`
+	AccountEnabled    bool   `json:"accountEnabled"`
+	// Manager is only set when requested with $expand=manager
+	Manager *User `json:"manager,omitempty"`
+
+	// Properties holds any other properties Graph returned, such as those requested with $select
+	Properties map[string]interface{} `json:"-"`
+}
+
+// ListOptions controls which users ListUsers returns and which properties it requests
+type ListOptions struct {
+	// Filter is an OData $filter expression
+	Filter string
+	// Search is a $search expression such as displayName:john, or clauses joined with AND or OR
+	// (displayName:john AND mail:contoso). Each clause is quoted unless the value contains quotes.
+	Search string
+	// OrderBy is an OData $orderby expression such as "displayName desc"
+	OrderBy string
+	// Top limits the number of users returned; 0 returns all of them
+	Top int
+	// Select lists properties to return in addition to DefaultProperties
+	Select []string
+	// Expand is an OData $expand expression such as "manager($select=id)"
+	Expand string
+	// Advanced forces an advanced query (ConsistencyLevel: eventual with $count), which
+	// endsWith, ne, not and filters combined with $orderby require
+	Advanced bool
 }
 
-// UserResponse represents the response when listing users
-type UserResponse struct {
-	Value    []User `json:"value"`
-	NextLink string `json:"@odata.nextLink,omitempty"`
+// maxPageSize is the largest $top Graph accepts for users
+const maxPageSize = 999
+
+// advanced reports whether the options need Graph's advanced query capabilities
+func (o ListOptions) advanced() bool {
+	return o.Advanced || o.Search != "" || (o.Filter != "" && o.OrderBy != "")
+}
+
+// query builds the query parameters and headers shared by ListUsers and CountUsers
+func (o ListOptions) query() (url.Values, http.Header) {
+	query := url.Values{}
+	header := http.Header{}
+	if o.Filter != "" {
+		query.Set("$filter", o.Filter)
+	}
+	if o.Search != "" {
+		query.Set("$search", searchExpression(o.Search))
+	}
+	if o.advanced() {
+		header.Set("ConsistencyLevel", "eventual")
+	}
+
+	return query, header
+}
+
+// searchOperator separates the clauses of a $search expression; Graph only accepts them in upper case
+var searchOperator = regexp.MustCompile(`\s+(AND|OR)\s+`)
+
+// searchExpression quotes each property:value clause of a search, as Graph requires.
+// A search that already contains quotes is passed through unchanged.
+func searchExpression(search string) string {
+	search = strings.TrimSpace(search)
+	if strings.Contains(search, `"`) {
+		return search
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range searchOperator.FindAllStringSubmatchIndex(search, -1) {
+		b.WriteString(`"` + search[last:match[0]] + `" ` + search[match[2]:match[3]] + " ")
+		last = match[1]
+	}
+	b.WriteString(`"` + search[last:] + `"`)
+	return b.String()
 }
 
-// PasswordProfile represents password settings for a new user
+// PasswordProfile represents password settings for a new user or a password reset
 type PasswordProfile struct {
-	ForceChangePasswordNextSignIn bool   `json:"forceChangePasswordNextSignIn"`
-	Password                      string `json:"password"`
+	ForceChangePasswordNextSignIn        bool   `json:"forceChangePasswordNextSignIn"`
+	ForceChangePasswordNextSignInWithMfa bool   `json:"forceChangePasswordNextSignInWithMfa,omitempty"`
+	Password                             string `json:"password"`
 }
 
 // CreateUserRequest represents the request body for creating a user
@@ -39,94 +106,75 @@ type CreateUserRequest struct {
 	MailNickname      string          `json:"mailNickname"`
 	UserPrincipalName string          `json:"userPrincipalName"`
 	PasswordProfile   PasswordProfile `json:"passwordProfile"`
+
+	// Extra holds further properties to set, such as usageLocation or department
+	Extra map[string]interface{} `json:"-"`
 }
 
 // ListUsers retrieves all users from Microsoft 365
-func ListUsers(accessToken string, filter string) ([]User, error) {
-	url := fmt.Sprintf("%s/users", baseURL)
-	if filter != "" {
-		url += fmt.Sprintf("?$filter=%s", filter)
+func ListUsers(client *graph.Client, opts ListOptions) ([]User, error) {
+	if opts.Top < 0 {
+		return nil, fmt.Errorf("top must not be negative")
 	}
 
-	var allUsers []User
-
-	for url != "" {
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create request: %w", err)
-		}
-
-		req.Header.Set("Authorization", "Bearer "+accessToken)
-		req.Header.Set("Content-Type", "application/json")
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get users: %w", err)
-		}
-		defer resp.Body.Close()
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response: %w", err)
-		}
-
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("failed to get users (status %d): %s", resp.StatusCode, string(body))
-		}
-
-		var userResponse UserResponse
-		if err := json.Unmarshal(body, &userResponse); err != nil {
-			return nil, fmt.Errorf("failed to parse response: %w", err)
-		}
+	query, header := opts.query()
+	query.Set("$select", selectProperties(opts.Select))
+	if opts.OrderBy != "" {
+		query.Set("$orderby", opts.OrderBy)
+	}
+	if opts.Expand != "" {
+		query.Set("$expand", opts.Expand)
+	}
+	if opts.Top > 0 {
+		query.Set("$top", strconv.Itoa(min(opts.Top, maxPageSize)))
+	}
+	if opts.advanced() {
+		query.Set("$count", "true")
+	}
 
-		allUsers = append(allUsers, userResponse.Value...)
-		url = userResponse.NextLink
+	allUsers, err := graph.ListLimit[User](client, &graph.Request{Path: "/users", Query: query, Header: header}, opts.Top)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
 	}
 
 	return allUsers, nil
 }
 
-// GetUser retrieves a specific user by UPN
-func GetUser(accessToken, userPrincipalName string) (*User, error) {
-	url := fmt.Sprintf("%s/users/%s", baseURL, userPrincipalName)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// CountUsers returns the number of users matching the filter and search options; Top, OrderBy and Select are ignored
+func CountUsers(client *graph.Client, opts ListOptions) (int, error) {
+	query, header := opts.query()
+	// @odata.count on a one-item page avoids /users/$count, which answers in plain text
+	query.Set("$count", "true")
+	query.Set("$top", "1")
+	query.Set("$select", "id")
+	header.Set("ConsistencyLevel", "eventual")
+
+	var result struct {
+		Count int `json:"@odata.count"`
 	}
-
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+	if err := client.Do(&graph.Request{Method: http.MethodGet, Path: "/users", Query: query, Header: header}, &result); err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
+	return result.Count, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get user (status %d): %s", resp.StatusCode, string(body))
-	}
+// GetUser retrieves a specific user by UPN, including any additional properties requested
+func GetUser(client *graph.Client, userPrincipalName string, properties ...string) (*User, error) {
+	query := url.Values{}
+	query.Set("$select", selectProperties(properties))
 
 	var user User
-	if err := json.Unmarshal(body, &user); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	req := &graph.Request{Method: http.MethodGet, Path: "/users/" + url.PathEscape(userPrincipalName), Query: query}
+	if err := client.Do(req, &user); err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
 	return &user, nil
 }
 
 // CreateUser creates a new user in Microsoft 365
-func CreateUser(accessToken, displayName, userPrincipalName, mailNickname, password string, forceChange bool) (*User, error) {
-	url := fmt.Sprintf("%s/users", baseURL)
-
+func CreateUser(client *graph.Client, displayName, userPrincipalName, mailNickname, password string, forceChange bool) (*User, error) {
 	createReq := CreateUserRequest{
 		AccountEnabled:    true,
 		DisplayName:       displayName,
@@ -138,97 +186,281 @@ func CreateUser(accessToken, displayName, userPrincipalName, mailNickname, passw
 		},
 	}
 
-	jsonData, err := json.Marshal(createReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	return CreateUserFrom(client, createReq)
+}
+
+// CreateUserFrom creates a user from a complete request, including any extra properties
+func CreateUserFrom(client *graph.Client, createReq CreateUserRequest) (*User, error) {
+	var user User
+	if err := client.Post("/users", createReq, &user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	return &user, nil
+}
+
+// CreateUsers creates many users through JSON batching. The created users and errors are returned
+// in request order; for each request exactly one of them is set.
+func CreateUsers(client *graph.Client, createReqs []CreateUserRequest) ([]*User, []error) {
+	created := make([]*User, len(createReqs))
+	items := make([]*graph.BatchItem, len(createReqs))
+	for i := range createReqs {
+		created[i] = &User{}
+		items[i] = &graph.BatchItem{
+			Request: &graph.Request{Method: http.MethodPost, Path: "/users", Body: createReqs[i]},
+			Out:     created[i],
+		}
 	}
 
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
+	client.Batch(items)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+	errs := make([]error, len(items))
+	for i, item := range items {
+		if item.Err != nil {
+			created[i] = nil
+			errs[i] = fmt.Errorf("failed to create user: %w", item.Err)
+		}
 	}
-	defer resp.Body.Close()
+	return created, errs
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+// GetUserIDs looks up the object IDs of many users through JSON batching, in request order
+func GetUserIDs(client *graph.Client, userPrincipalNames []string) ([]string, []error) {
+	found := make([]User, len(userPrincipalNames))
+	items := make([]*graph.BatchItem, len(userPrincipalNames))
+	for i, upn := range userPrincipalNames {
+		query := url.Values{"$select": {"id"}}
+		items[i] = &graph.BatchItem{
+			Request: &graph.Request{Method: http.MethodGet, Path: "/users/" + url.PathEscape(upn), Query: query},
+			Out:     &found[i],
+		}
 	}
 
-	if resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("failed to create user (status %d): %s", resp.StatusCode, string(body))
+	client.Batch(items)
+
+	ids := make([]string, len(items))
+	errs := make([]error, len(items))
+	for i, item := range items {
+		if item.Err != nil {
+			errs[i] = fmt.Errorf("failed to get user: %w", item.Err)
+			continue
+		}
+		ids[i] = found[i].ID
 	}
+	return ids, errs
+}
 
-	var user User
-	if err := json.Unmarshal(body, &user); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+// ManagerAssignment makes ManagerID the manager of User
+type ManagerAssignment struct {
+	// User is the UPN or object ID of the user
+	User      string
+	ManagerID string
+}
+
+// SetManagers assigns many managers through JSON batching and returns the errors in request order
+func SetManagers(client *graph.Client, assignments []ManagerAssignment) []error {
+	items := make([]*graph.BatchItem, len(assignments))
+	for i, assignment := range assignments {
+		items[i] = &graph.BatchItem{Request: newSetManagerRequest(client, assignment.User, assignment.ManagerID)}
 	}
 
-	return &user, nil
+	client.Batch(items)
+
+	errs := make([]error, len(items))
+	for i, item := range items {
+		if item.Err != nil {
+			errs[i] = fmt.Errorf("failed to set manager: %w", item.Err)
+		}
+	}
+	return errs
 }
 
-// UpdateUser updates properties of an existing user
-func UpdateUser(accessToken, userPrincipalName string, properties map[string]interface{}) error {
-	url := fmt.Sprintf("%s/users/%s", baseURL, userPrincipalName)
+// SetManager makes managerID the manager of the user
+func SetManager(client *graph.Client, userPrincipalName, managerID string) error {
+	if err := client.Do(newSetManagerRequest(client, userPrincipalName, managerID), nil); err != nil {
+		return fmt.Errorf("failed to set manager: %w", err)
+	}
 
-	jsonData, err := json.Marshal(properties)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+	return nil
+}
+
+// newSetManagerRequest builds the request that makes managerID the manager of the user
+func newSetManagerRequest(client *graph.Client, userPrincipalName, managerID string) *graph.Request {
+	path := fmt.Sprintf("/users/%s/manager/$ref", url.PathEscape(userPrincipalName))
+
+	// The reference must use the same cloud's Graph endpoint as the request itself
+	requestBody := map[string]string{
+		"@odata.id": fmt.Sprintf("%s/users/%s", client.BaseURL, managerID),
 	}
 
-	req, err := http.NewRequest("PATCH", url, bytes.NewBuffer(jsonData))
+	return &graph.Request{Method: http.MethodPut, Path: path, Body: requestBody}
+}
+
+// GetManager retrieves the manager of a user, or nil when the user has none
+func GetManager(client *graph.Client, userPrincipalName string) (*User, error) {
+	query := url.Values{}
+	query.Set("$select", "id")
+	query.Set("$expand", fmt.Sprintf("manager($select=%s)", selectProperties([]string{"jobTitle"})))
+
+	var user struct {
+		Manager *User `json:"manager"`
+	}
+	req := &graph.Request{Method: http.MethodGet, Path: "/users/" + url.PathEscape(userPrincipalName), Query: query}
+	if err := client.Do(req, &user); err != nil {
+		return nil, fmt.Errorf("failed to get manager: %w", err)
+	}
+
+	return user.Manager, nil
+}
+
+// RemoveManager removes the manager of a user
+func RemoveManager(client *graph.Client, userPrincipalName string) error {
+	path := fmt.Sprintf("/users/%s/manager/$ref", url.PathEscape(userPrincipalName))
+
+	if err := client.Delete(path); err != nil {
+		return fmt.Errorf("failed to remove manager: %w", err)
+	}
+
+	return nil
+}
+
+// GetDirectReports retrieves the users who report directly to a user. Organizational contacts
+// are left out.
+func GetDirectReports(client *graph.Client, userPrincipalName string) ([]User, error) {
+	path := fmt.Sprintf("/users/%s/directReports/microsoft.graph.user", url.PathEscape(userPrincipalName))
+	query := url.Values{}
+	query.Set("$select", selectProperties([]string{"jobTitle"}))
+
+	reports, err := graph.List[User](client, &graph.Request{Path: path, Query: query})
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to get direct reports: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
+	return reports, nil
+}
+
+// ReportNode is a user in a reporting tree, with the people who report to them
+type ReportNode struct {
+	ID                string        `json:"id"`
+	DisplayName       string        `json:"displayName"`
+	UserPrincipalName string        `json:"userPrincipalName"`
+	JobTitle          string        `json:"jobTitle,omitempty"`
+	AccountEnabled    bool          `json:"accountEnabled"`
+	Reports           []*ReportNode `json:"reports,omitempty"`
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// newReportNode converts a user with the jobTitle property to a tree node
+func newReportNode(user *User) *ReportNode {
+	jobTitle, _ := user.Properties["jobTitle"].(string)
+	return &ReportNode{
+		ID:                user.ID,
+		DisplayName:       user.DisplayName,
+		UserPrincipalName: user.UserPrincipalName,
+		JobTitle:          jobTitle,
+		AccountEnabled:    user.AccountEnabled,
+	}
+}
+
+// GetReportingTree walks the full reporting chain below a user. A user who appears twice because
+// of a manager cycle is only included the first time.
+func GetReportingTree(client *graph.Client, userPrincipalName string) (*ReportNode, error) {
+	root, err := GetUser(client, userPrincipalName, "jobTitle")
 	if err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to update user (status %d): %s", resp.StatusCode, string(body))
+	tree := newReportNode(root)
+	visited := map[string]bool{root.ID: true}
+
+	var walk func(node *ReportNode) error
+	walk = func(node *ReportNode) error {
+		reports, err := GetDirectReports(client, node.ID)
+		if err != nil {
+			return err
+		}
+		for i := range reports {
+			if visited[reports[i].ID] {
+				continue
+			}
+			visited[reports[i].ID] = true
+
+			child := newReportNode(&reports[i])
+			node.Reports = append(node.Reports, child)
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// UpdateUser updates properties of an existing user
+func UpdateUser(client *graph.Client, userPrincipalName string, properties map[string]interface{}) error {
+	if err := client.Patch("/users/"+url.PathEscape(userPrincipalName), properties); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
 	}
 
 	return nil
 }
 
-// DeleteUser deletes a user from Microsoft 365
-func DeleteUser(accessToken, userPrincipalName string) error {
-	url := fmt.Sprintf("%s/users/%s", baseURL, userPrincipalName)
+// ResetPassword sets a new password for a user
+func ResetPassword(client *graph.Client, userPrincipalName string, profile PasswordProfile) error {
+	return UpdateUser(client, userPrincipalName, map[string]interface{}{"passwordProfile": profile})
+}
 
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+// SetAccountsEnabled allows or blocks sign-in for many users through JSON batching and returns
+// the errors in request order
+func SetAccountsEnabled(client *graph.Client, userPrincipalNames []string, enabled bool) []error {
+	requestBody := map[string]bool{"accountEnabled": enabled}
+	items := make([]*graph.BatchItem, len(userPrincipalNames))
+	for i, upn := range userPrincipalNames {
+		items[i] = &graph.BatchItem{Request: &graph.Request{Method: http.MethodPatch, Path: "/users/" + url.PathEscape(upn), Body: requestBody}}
 	}
 
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
+	client.Batch(items)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+	action := "enable"
+	if !enabled {
+		action = "disable"
+	}
+	errs := make([]error, len(items))
+	for i, item := range items {
+		if item.Err != nil {
+			errs[i] = fmt.Errorf("failed to %s user: %w", action, item.Err)
+		}
+	}
+	return errs
+}
+
+// RevokeSignInSessions invalidates the refresh tokens and session cookies of many users through
+// JSON batching, so they must sign in again, and returns the errors in request order
+func RevokeSignInSessions(client *graph.Client, userPrincipalNames []string) []error {
+	items := make([]*graph.BatchItem, len(userPrincipalNames))
+	for i, upn := range userPrincipalNames {
+		path := fmt.Sprintf("/users/%s/revokeSignInSessions", url.PathEscape(upn))
+		items[i] = &graph.BatchItem{Request: &graph.Request{Method: http.MethodPost, Path: path}}
+	}
+
+	client.Batch(items)
+
+	errs := make([]error, len(items))
+	for i, item := range items {
+		if item.Err != nil {
+			errs[i] = fmt.Errorf("failed to revoke sign-in sessions: %w", item.Err)
+		}
 	}
-	defer resp.Body.Close()
+	return errs
+}
 
-	if resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to delete user (status %d): %s", resp.StatusCode, string(body))
+// DeleteUser deletes a user from Microsoft 365
+func DeleteUser(client *graph.Client, userPrincipalName string) error {
+	if err := client.Delete("/users/" + url.PathEscape(userPrincipalName)); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
 	}
 
 	return nil
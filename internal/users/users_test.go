@@ -0,0 +1,160 @@
+package users
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"GraphUserAdmin/internal/graph"
+)
+
+func TestSearchExpression(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"displayName:john", `"displayName:john"`},
+		{"displayName:john smith", `"displayName:john smith"`},
+		{"displayName:john AND mail:contoso", `"displayName:john" AND "mail:contoso"`},
+		{"displayName:john OR displayName:jane AND mail:contoso", `"displayName:john" OR "displayName:jane" AND "mail:contoso"`},
+		{"displayName:tom and jerry", `"displayName:tom and jerry"`},
+		{"  mail:contoso  ", `"mail:contoso"`},
+		{`"displayName:john"`, `"displayName:john"`},
+		{`"displayName:john" AND "mail:contoso"`, `"displayName:john" AND "mail:contoso"`},
+	}
+
+	for _, test := range tests {
+		if got := searchExpression(test.in); got != test.want {
+			t.Errorf("searchExpression(%q) = %s, want %s", test.in, got, test.want)
+		}
+	}
+}
+
+// newTestClient returns a client that sends its requests to srv
+func newTestClient(srv *httptest.Server) *graph.Client {
+	client := graph.NewClient(graph.StaticToken("test-token"))
+	client.BaseURL = srv.URL + "/v1.0"
+	client.HTTPClient = srv.Client()
+	return client
+}
+
+// listRequest runs ListUsers against a fake Graph and returns the request it sent
+func listRequest(t *testing.T, opts ListOptions) *http.Request {
+	t.Helper()
+
+	var sent *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = r
+		fmt.Fprint(w, `{"value":[{"id":"1"}]}`)
+	}))
+	defer srv.Close()
+
+	if _, err := ListUsers(newTestClient(srv), opts); err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	return sent
+}
+
+func TestListUsersQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     ListOptions
+		want     url.Values
+		advanced bool
+	}{
+		{
+			name: "plain list",
+			opts: ListOptions{},
+			want: url.Values{"$select": {selectProperties(nil)}},
+		},
+		{
+			name: "filter",
+			opts: ListOptions{Filter: "startsWith(displayName,'J&J') and accountEnabled eq true"},
+			want: url.Values{
+				"$select": {selectProperties(nil)},
+				"$filter": {"startsWith(displayName,'J&J') and accountEnabled eq true"},
+			},
+		},
+		{
+			name: "filter with orderby",
+			opts: ListOptions{Filter: "accountEnabled eq true", OrderBy: "displayName desc"},
+			want: url.Values{
+				"$select":  {selectProperties(nil)},
+				"$filter":  {"accountEnabled eq true"},
+				"$orderby": {"displayName desc"},
+				"$count":   {"true"},
+			},
+			advanced: true,
+		},
+		{
+			name: "orderby alone",
+			opts: ListOptions{OrderBy: "displayName"},
+			want: url.Values{"$select": {selectProperties(nil)}, "$orderby": {"displayName"}},
+		},
+		{
+			name: "search",
+			opts: ListOptions{Search: "displayName:john AND mail:a+b@contoso.com"},
+			want: url.Values{
+				"$select": {selectProperties(nil)},
+				"$search": {`"displayName:john" AND "mail:a+b@contoso.com"`},
+				"$count":  {"true"},
+			},
+			advanced: true,
+		},
+		{
+			name: "advanced",
+			opts: ListOptions{Filter: "endsWith(mail,'@contoso.com')", Advanced: true, Top: 5},
+			want: url.Values{
+				"$select": {selectProperties(nil)},
+				"$filter": {"endsWith(mail,'@contoso.com')"},
+				"$top":    {"5"},
+				"$count":  {"true"},
+			},
+			advanced: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := listRequest(t, test.opts)
+
+			// Values with &, + and spaces must arrive intact
+			got := r.URL.Query()
+			if got.Encode() != test.want.Encode() {
+				t.Errorf("query is %v, want %v", got, test.want)
+			}
+
+			consistency := r.Header.Get("ConsistencyLevel")
+			if test.advanced && consistency != "eventual" {
+				t.Errorf("ConsistencyLevel header is %q, want eventual", consistency)
+			}
+			if !test.advanced && consistency != "" {
+				t.Errorf("ConsistencyLevel header is %q on a simple query", consistency)
+			}
+		})
+	}
+}
+
+func TestCountUsersQuery(t *testing.T) {
+	var sent *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = r
+		fmt.Fprint(w, `{"@odata.count":42,"value":[{"id":"1"}]}`)
+	}))
+	defer srv.Close()
+
+	count, err := CountUsers(newTestClient(srv), ListOptions{Filter: "accountEnabled eq false"})
+	if err != nil || count != 42 {
+		t.Fatalf("count is %d (%v), want 42", count, err)
+	}
+
+	query := sent.URL.Query()
+	if query.Get("$count") != "true" || query.Get("$filter") != "accountEnabled eq false" || query.Get("$top") != "1" {
+		t.Errorf("query is %v", query)
+	}
+	if sent.Header.Get("ConsistencyLevel") != "eventual" {
+		t.Errorf("ConsistencyLevel header is %q, want eventual", sent.Header.Get("ConsistencyLevel"))
+	}
+}